@@ -0,0 +1,10 @@
+// Package api embeds the OpenAPI specification of the HTTP API, so the server
+// can serve it and tests can check it against the routes
+package api
+
+import _ "embed"
+
+// Spec is the OpenAPI 3 document describing every route
+//
+//go:embed openapi.json
+var Spec []byte
@@ -2,62 +2,86 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 	"github.com/owenhochwald/harmonia/internal/config"
+	"github.com/owenhochwald/harmonia/internal/migrate"
 	"github.com/owenhochwald/harmonia/internal/server"
+	"github.com/owenhochwald/harmonia/internal/tracing"
 	"github.com/owenhochwald/harmonia/pkg/logger"
 )
 
 func main() {
-	err := godotenv.Load()
-
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		panic("Error loading .env file")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	log := logger.NewLogger(os.Getenv("ENVIRONMENT"))
-	cfg := config.NewConfig()
+	log := logger.NewLogger(cfg.Env)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Cannot set up tracing")
+	}
 
-	db, err := ConnectDB(cfg)
+	db, err := server.ConnectDB(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Cannot connect to database")
 	}
+
+	if cfg.MigrateOnStart {
+		applied, err := migrate.Up(context.Background(), db)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Cannot migrate database")
+		}
+		log.Info().Int("applied", len(applied)).Msg("database migrated")
+	}
+
 	app, err := server.NewApplication(cfg, log, db)
 	if err != nil {
 		panic(err)
 	}
 
-	r := gin.Default()
-
-	server.SetupRoutes(r, app)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	r.Run(":" + app.Config.Port)
-}
-
-func ConnectDB(cfg config.Config) (*sql.DB, error) {
-	var err error
-	db, err := sql.Open("postgres", cfg.DBURL)
+	if err := app.JobService.Start(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Cannot start ingest workers")
+	}
 
-	if err != nil {
-		return nil, err
+	// Not gin.Default: SetupRoutes logs requests and recovers panics through zerolog
+	r := gin.New()
+	// Without trusted proxies ClientIP is the peer address, so clients can't pick
+	// their own rate limit bucket with X-Forwarded-For
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("Invalid trusted proxies")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	server.SetupRoutes(r, app)
 
-	if err = db.PingContext(ctx); err != nil {
-		return nil, err
+	if err := app.Serve(ctx, r); err != nil {
+		log.Error().Err(err).Msg("Server stopped with an error")
 	}
 
-	db.SetConnMaxLifetime(time.Hour)
-	db.SetMaxOpenConns(25)
-	db.SetConnMaxIdleTime(10 * time.Minute)
+	if err := db.Close(); err != nil {
+		log.Error().Err(err).Msg("Cannot close database")
+	}
 
-	return db, nil
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Error().Err(err).Msg("Cannot flush traces")
+	}
+	log.Info().Msg("stopped")
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+)
+
+func runAPIKey(args []string) error {
+	flags := flag.NewFlagSet("apikey", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: harmonia apikey create -name <name> -scopes <scopes> [-tenant <tenant>] [-search-global]")
+		fmt.Fprintln(flags.Output(), "       harmonia apikey revoke <id>")
+		fmt.Fprintln(flags.Output(), "       harmonia apikey list")
+		fmt.Fprintln(flags.Output(), "\nScopes are identify, ingest and admin, comma separated; admin grants everything.")
+		flags.PrintDefaults()
+	}
+	name := flags.String("name", "", "who the key is for (create)")
+	scopes := flags.String("scopes", string(models.ScopeIdentify), "comma separated scopes (create)")
+	tenantID := flags.String("tenant", tenant.Global, "catalog the key works on (create)")
+	searchGlobal := flags.Bool("search-global", false, "let the key search the global catalog too (create)")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return errors.New("expected one of create, revoke or list")
+	}
+	// Allow flags after the command too: harmonia apikey create -name app
+	command := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+
+	app, err := newApplication()
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	ctx := context.Background()
+
+	switch command {
+	case "create":
+		var parsed []models.Scope
+		for _, s := range strings.Split(*scopes, ",") {
+			scope, err := models.ParseScope(strings.TrimSpace(s))
+			if err != nil {
+				return err
+			}
+			parsed = append(parsed, scope)
+		}
+
+		token, key, err := app.APIKeyService.Create(ctx, services.APIKeySpec{
+			Name:         *name,
+			Scopes:       parsed,
+			TenantID:     *tenantID,
+			SearchGlobal: *searchGlobal,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created key %s (%s) for tenant %s with scopes %s\n", key.ID, key.Name, key.TenantID, joinScopes(key.Scopes))
+		fmt.Println("Store it now, it can't be shown again:")
+		fmt.Println(token)
+	case "revoke":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("revoke expects the key id")
+		}
+		if err := app.APIKeyService.Revoke(ctx, flags.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Println("Revoked key", flags.Arg(0))
+	case "list":
+		keys, err := app.APIKeyService.List(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tTENANT\tSCOPES\tCREATED\tREVOKED")
+		for _, key := range keys {
+			revoked := "-"
+			if key.Revoked() {
+				revoked = key.RevokedAt.Local().Format(time.DateTime)
+			}
+			tenantID := key.TenantID
+			if key.SearchGlobal {
+				tenantID += "+global"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s…\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix, tenantID, joinScopes(key.Scopes), key.CreatedAt.Local().Format(time.DateTime), revoked)
+		}
+		return w.Flush()
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown apikey command %q", command)
+	}
+
+	return nil
+}
+
+func joinScopes(scopes []models.Scope) string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/archive"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+)
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: harmonia export -o <file>")
+		flags.PrintDefaults()
+	}
+	output := flags.String("o", "", "file to write the archive to")
+	tenantID := flags.String("tenant", tenant.Global, "catalog to export")
+	flags.Parse(args)
+
+	if *output == "" {
+		flags.Usage()
+		return errors.New("-o is required")
+	}
+	if err := tenant.Validate(*tenantID); err != nil {
+		return err
+	}
+
+	app, err := newApplication()
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	// Write next to the target and rename, so a failed run never leaves a truncated archive
+	tmp, err := os.CreateTemp(filepath.Dir(*output), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	ctx, stop := signal.NotifyContext(tenant.With(context.Background(), *tenantID, false), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	buffered := bufio.NewWriter(tmp)
+	stats, err := archive.Export(ctx, buffered, app.SongRepo, app.FingerprintRepo, services.DefaultFingerprintParams())
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), *output); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d songs and %d fingerprints to %s in %s\n",
+		stats.Songs, stats.Fingerprints, *output, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: harmonia import [flags] <file>")
+		fmt.Fprintln(flags.Output(), "\nSongs whose content hash is already in the catalog are skipped.")
+		flags.PrintDefaults()
+	}
+	keepIDs := flags.Bool("keep-ids", false, "save songs under their archived IDs instead of new ones")
+	force := flags.Bool("force", false, "import even if the archive was fingerprinted with different params")
+	tenantID := flags.String("tenant", tenant.Global, "catalog to import into")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one archive")
+	}
+	if err := tenant.Validate(*tenantID); err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	app, err := newApplication()
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	ctx, stop := signal.NotifyContext(tenant.With(context.Background(), *tenantID, false), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	stats, err := archive.Import(ctx, bufio.NewReader(file), app.UnitOfWork, archive.ImportOptions{
+		Params:       services.DefaultFingerprintParams(),
+		IgnoreParams: *force,
+		KeepIDs:      *keepIDs,
+	})
+
+	fmt.Printf("Imported %d songs and %d fingerprints, skipped %d already in the catalog (%s)\n",
+		stats.Songs, stats.Fingerprints, stats.Skipped, time.Since(started).Round(time.Millisecond))
+	if errors.Is(err, archive.ErrParamsMismatch) {
+		return fmt.Errorf("%w\nre-fingerprint the source audio, or pass -force to import anyway", err)
+	}
+	return err
+}
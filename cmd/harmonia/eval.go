@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/owenhochwald/harmonia/internal/eval"
+)
+
+func runEval(args []string) error {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: harmonia eval [flags] <reference dir>")
+		fmt.Fprintln(flags.Output(), "\nFingerprints the references into memory and identifies degraded clips of them.")
+		flags.PrintDefaults()
+	}
+	defaults := eval.DefaultConfig()
+	queries := flags.Int("queries", defaults.QueriesPerTrack, "clips cut from each track per scenario")
+	clip := flags.Float64("clip", defaults.ClipLength, "clip length in seconds")
+	seed := flags.Int64("seed", defaults.Seed, "random seed for clip positions, noise and the holdout split")
+	holdout := flags.Int("holdout", 0, "tracks left out of the catalog to measure false positives")
+	scenarios := flags.String("scenarios", "", "JSON file with a list of scenarios to run instead of the defaults")
+	output := flags.String("o", "", "write the JSON report to this file instead of stdout")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one directory")
+	}
+
+	cfg := defaults
+	cfg.QueriesPerTrack = *queries
+	cfg.ClipLength = *clip
+	cfg.Seed = *seed
+	cfg.Holdout = *holdout
+	if *scenarios != "" {
+		data, err := os.ReadFile(*scenarios)
+		if err != nil {
+			return err
+		}
+		cfg.Scenarios = nil
+		if err := json.Unmarshal(data, &cfg.Scenarios); err != nil {
+			return fmt.Errorf("%s: %w", *scenarios, err)
+		}
+	}
+
+	root := flags.Arg(0)
+	files, err := findAudioFiles(root)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no WAV files found under %s", root)
+	}
+
+	tracks := make([]eval.Track, 0, len(files))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		tracks = append(tracks, eval.Track{Name: filepath.ToSlash(rel), Data: data})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := eval.Run(ctx, tracks, cfg)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		printSummary(report)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// printSummary shows one line per scenario when the full report goes to a file
+func printSummary(report *eval.Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCENARIO\tQUERIES\tPRECISION\tRECALL\tTOP-1\tP50\tP99")
+	for _, result := range report.Results {
+		fmt.Fprintf(w, "%s\t%d\t%.3f\t%.3f\t%.3f\t%.1fms\t%.1fms\n", result.Scenario, result.Queries,
+			result.Precision, result.Recall, result.Top1, result.Latency.P50, result.Latency.P99)
+	}
+	w.Flush()
+}
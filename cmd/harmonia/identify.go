@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/archive"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+)
+
+type identifyOutput struct {
+	File      string           `json:"file"`
+	Source    string           `json:"source"`
+	ElapsedMs int64            `json:"elapsed_ms"`
+	Matches   []services.Match `json:"matches"`
+}
+
+func runIdentify(args []string) error {
+	flags := flag.NewFlagSet("identify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: harmonia identify [flags] <file>")
+		flags.PrintDefaults()
+	}
+	index := flags.String("index", "", "match against an archive written by \"harmonia export\" instead of the database")
+	asJSON := flags.Bool("json", false, "print matches as JSON")
+	tenantID := flags.String("tenant", tenant.Global, "catalog to search in the database")
+	searchGlobal := flags.Bool("search-global", false, "search the global catalog along with -tenant")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one audio file")
+	}
+	path := flags.Arg(0)
+	if err := tenant.Validate(*tenantID); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	audioService := services.NewAudioService()
+	if err := audioService.ValidateFile(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// An index holds a single catalog, so -tenant only applies to the database
+	ctx := context.Background()
+	var musicService services.MusicServiceInterface
+	source := "database"
+	if *index != "" {
+		musicService, err = loadIndex(*index, audioService)
+		if err != nil {
+			return err
+		}
+		source = *index
+	} else {
+		app, err := newApplication()
+		if err != nil {
+			return err
+		}
+		defer app.DB.Close()
+		musicService = app.MusicService
+		ctx = tenant.With(ctx, *tenantID, *searchGlobal)
+	}
+
+	started := time.Now()
+	matches, err := musicService.Identify(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	output := identifyOutput{
+		File:      path,
+		Source:    source,
+		ElapsedMs: time.Since(started).Milliseconds(),
+		Matches:   matches,
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	printMatches(output)
+	return nil
+}
+
+// loadIndex builds the identification pipeline on top of an archive loaded into memory
+func loadIndex(path string, audioService services.AudioServiceInterface) (services.MusicServiceInterface, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	songs, fingerprints, err := archive.Load(context.Background(), bufio.NewReader(file), services.DefaultFingerprintParams())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	fingerprintService := services.NewFingerprintService(fingerprints)
+	return services.NewMusicService(nil, songs, repo.NewMemoryUnitOfWork(songs, fingerprints), audioService, fingerprintService, services.DuplicatePolicy{}), nil
+}
+
+func printMatches(output identifyOutput) {
+	if len(output.Matches) == 0 {
+		fmt.Printf("No matches for %s (%dms)\n", output.File, output.ElapsedMs)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tSONG\tTITLE\tARTIST\tSCORE\tCONFIDENCE\tOFFSET")
+	for i, match := range output.Matches {
+		title, artist := "-", "-"
+		if match.Song != nil {
+			title, artist = match.Song.Title, match.Song.Artist
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%.3f\t%.2fs\n", i+1, match.SongID, title, artist, match.Score, match.Confidence, match.Offset)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d matches for %s from %s (%dms)\n", len(output.Matches), output.File, output.Source, output.ElapsedMs)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/server"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+)
+
+type ingestStatus string
+
+const (
+	ingestOK      ingestStatus = "ingested"
+	ingestSkipped ingestStatus = "skipped"
+	ingestFailed  ingestStatus = "failed"
+)
+
+type ingestResult struct {
+	Path   string
+	Status ingestStatus
+	Detail string
+}
+
+type ingester struct {
+	app      *server.Application
+	root     string
+	pattern  *services.FilenamePattern
+	defaults models.Song
+
+	mu   sync.Mutex
+	seen map[string]string // content hash -> first path seen in this run
+}
+
+func runIngest(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: harmonia ingest [flags] <dir>")
+		fmt.Fprintln(flags.Output(), "\nMetadata is read from WAV INFO tags, then from -pattern, then from the defaults below.")
+		flags.PrintDefaults()
+	}
+	pattern := flags.String("pattern", "", `filename pattern such as "{artist}/{album}/{track} - {title}"; fields: title, artist, album, year, track, _`)
+	workers := flags.Int("workers", runtime.NumCPU(), "number of files to fingerprint in parallel")
+	artist := flags.String("artist", "", "artist for files without one")
+	album := flags.String("album", "", "album for files without one")
+	year := flags.Int("year", 0, "year for files without one")
+	tenantID := flags.String("tenant", tenant.Global, "catalog to add the songs to")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one directory")
+	}
+	if *workers < 1 {
+		return errors.New("-workers must be at least 1")
+	}
+	if err := tenant.Validate(*tenantID); err != nil {
+		return err
+	}
+
+	in := &ingester{
+		root:     flags.Arg(0),
+		defaults: models.Song{Artist: *artist, Album: *album, Year: *year},
+		seen:     make(map[string]string),
+	}
+	if *pattern != "" {
+		parsed, err := services.ParseFilenamePattern(*pattern)
+		if err != nil {
+			return err
+		}
+		in.pattern = parsed
+	}
+
+	files, err := findAudioFiles(in.root)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Printf("No WAV files found under %s\n", in.root)
+		return nil
+	}
+
+	in.app, err = newApplication()
+	if err != nil {
+		return err
+	}
+	defer in.app.DB.Close()
+
+	ctx, stop := signal.NotifyContext(tenant.With(context.Background(), *tenantID, false), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	fmt.Printf("Ingesting %d files from %s with %d workers\n", len(files), in.root, *workers)
+
+	paths := make(chan string)
+	results := make(chan ingestResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				results <- in.ingestFile(ctx, path)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(paths)
+		for _, path := range files {
+			select {
+			case paths <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	counts := make(map[ingestStatus]int)
+	var failures []ingestResult
+	for result := range results {
+		counts[result.Status]++
+		if result.Status == ingestFailed {
+			failures = append(failures, result)
+		}
+		fmt.Printf("%-8s %s: %s\n", result.Status, in.relative(result.Path), result.Detail)
+	}
+
+	processed := counts[ingestOK] + counts[ingestSkipped] + counts[ingestFailed]
+	fmt.Printf("\nIngested %d, skipped %d, failed %d of %d files in %s\n",
+		counts[ingestOK], counts[ingestSkipped], counts[ingestFailed], len(files), time.Since(started).Round(time.Millisecond))
+
+	if len(failures) > 0 {
+		fmt.Println("\nFailed files:")
+		for _, failure := range failures {
+			fmt.Printf("  %s: %s\n", in.relative(failure.Path), failure.Detail)
+		}
+	}
+
+	if processed < len(files) {
+		return fmt.Errorf("interrupted, %d files were not processed", len(files)-processed)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d files failed", len(failures))
+	}
+	return nil
+}
+
+func (in *ingester) ingestFile(ctx context.Context, path string) ingestResult {
+	result := ingestResult{Path: path, Status: ingestFailed}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+
+	hash := services.ContentHash(data)
+	if first, duplicate := in.claim(hash, path); duplicate {
+		result.Status = ingestSkipped
+		result.Detail = "same content as " + in.relative(first)
+		return result
+	}
+
+	existing, err := in.app.SongRepo.FindByContentHash(ctx, hash)
+	if err != nil {
+		result.Detail = fmt.Sprintf("error checking for a previous ingest: %v", err)
+		return result
+	}
+	if existing != nil {
+		result.Status = ingestSkipped
+		result.Detail = "already ingested as song " + existing.ID
+		return result
+	}
+
+	song, err := in.metadata(path, data)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+
+	if err := in.app.AudioService.ValidateFile(bytes.NewReader(data)); err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+
+	// Keyed by catalog, so discarding a rejected file never removes the audio of
+	// another catalog's song with the same content
+	song.S3Key = fmt.Sprintf("library/%s/%s.wav", tenant.From(ctx), hash)
+	song.ContentHash = hash
+	if err := in.app.Storage.Upload(ctx, song.S3Key, data); err != nil {
+		result.Detail = fmt.Sprintf("error storing audio: %v", err)
+		return result
+	}
+
+	saved, err := in.app.MusicService.HandleUpload(ctx, song, data)
+	if err != nil {
+		// No song refers to the audio, so nothing would ever read or remove it
+		result.Detail = err.Error()
+		if err := in.app.Storage.Delete(ctx, song.S3Key); err != nil {
+			result.Detail += fmt.Sprintf(" (stored audio %s not deleted: %v)", song.S3Key, err)
+		}
+
+		var duplicate *services.DuplicateError
+		if errors.As(err, &duplicate) {
+			result.Status = ingestSkipped
+		}
+		return result
+	}
+
+	result.Status = ingestOK
+	result.Detail = fmt.Sprintf("song %s, %q by %s", saved.ID, saved.Title, saved.Artist)
+	if saved.DuplicateOf != "" {
+		result.Detail += ", flagged as a duplicate of song " + saved.DuplicateOf
+	}
+	return result
+}
+
+// metadata merges the file's tags, the filename pattern and the defaults, in that order
+func (in *ingester) metadata(path string, data []byte) (models.Song, error) {
+	// Untagged or unusual files simply fall through to the pattern and defaults
+	song, _ := services.ReadWAVTags(data)
+
+	if in.pattern != nil {
+		if fromName, ok := in.pattern.Match(in.relative(path)); ok {
+			song = services.MergeMetadata(song, fromName)
+		}
+	}
+	song = services.MergeMetadata(song, in.defaults)
+
+	var missing []string
+	if strings.TrimSpace(song.Title) == "" {
+		missing = append(missing, "title")
+	}
+	if strings.TrimSpace(song.Artist) == "" {
+		missing = append(missing, "artist")
+	}
+	if song.Year == 0 {
+		missing = append(missing, "year")
+	}
+	if len(missing) > 0 {
+		return song, fmt.Errorf("no %s in tags or filename", strings.Join(missing, ", "))
+	}
+
+	return song, nil
+}
+
+// claim records the first path seen with a content hash, so the same file
+// appearing twice in the tree is only ingested once
+func (in *ingester) claim(hash, path string) (string, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if first, ok := in.seen[hash]; ok {
+		return first, true
+	}
+	in.seen[hash] = path
+	return path, false
+}
+
+func (in *ingester) relative(path string) string {
+	rel, err := filepath.Rel(in.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// findAudioFiles lists the WAV files under root, skipping hidden files and directories
+func findAudioFiles(root string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".wav") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %w", root, err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/server"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/owenhochwald/harmonia/internal/testaudio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStorage keeps objects in a map so tests can see what was left behind
+type memoryStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memoryStorage) Upload(_ context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryStorage) Download(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (s *memoryStorage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryStorage) Ping(context.Context) error { return nil }
+
+func newTestIngester(t *testing.T) (*ingester, *memoryStorage, *services.MockMusicService, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "Band - Song.wav")
+	require.NoError(t, os.WriteFile(path, testaudio.WAV(t, testaudio.Mono16k, testaudio.Melody(16000, 1, 1)), 0o644))
+
+	pattern, err := services.ParseFilenamePattern("{artist} - {title}")
+	require.NoError(t, err)
+
+	songs := repo.NewMockSongRepo()
+	songs.On("FindByContentHash", mock.Anything, mock.Anything).Return(nil, nil)
+	store := &memoryStorage{objects: make(map[string][]byte)}
+	music := &services.MockMusicService{}
+
+	in := &ingester{
+		app: &server.Application{
+			Storage:      store,
+			SongRepo:     songs,
+			AudioService: services.NewAudioService(),
+			MusicService: music,
+		},
+		root:     root,
+		pattern:  pattern,
+		defaults: models.Song{Year: 2020},
+		seen:     make(map[string]string),
+	}
+	return in, store, music, path
+}
+
+func TestIngestFile_Storage(t *testing.T) {
+	ctx := tenant.With(context.Background(), "acme", false)
+
+	t.Run("keeps the audio of an ingested song", func(t *testing.T) {
+		in, store, music, path := newTestIngester(t)
+		music.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).
+			Return(&models.Song{ID: "1", Title: "Song", Artist: "Band"}, nil).Once()
+
+		result := in.ingestFile(ctx, path)
+		assert.Equal(t, ingestOK, result.Status, result.Detail)
+		require.Len(t, store.objects, 1)
+		for key := range store.objects {
+			assert.Regexp(t, `^library/acme/[0-9a-f]{64}\.wav$`, key)
+		}
+	})
+
+	for name, err := range map[string]error{
+		"duplicate": &services.DuplicateError{SongID: "7", Coverage: 0.9},
+		"failure":   errors.New("error saving song: connection reset"),
+	} {
+		t.Run("deletes the audio of a rejected "+name, func(t *testing.T) {
+			in, store, music, path := newTestIngester(t)
+			music.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).Return(nil, err).Once()
+
+			result := in.ingestFile(ctx, path)
+			assert.NotEqual(t, ingestOK, result.Status)
+			assert.Equal(t, err.Error(), result.Detail)
+			assert.Empty(t, store.objects, "no object is left without a song")
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/owenhochwald/harmonia/internal/config"
+	"github.com/owenhochwald/harmonia/internal/server"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+)
+
+const usage = `Usage: harmonia <command> [flags]
+
+Commands:
+  ingest <dir>      Fingerprint and store every WAV file under a directory
+  identify <file>   Print the catalog songs matching an audio clip
+  export -o <file>  Write the catalog to a portable archive
+  import <file>     Add the songs of an archive to the catalog
+  eval <dir>        Measure identification accuracy on degraded clips
+  migrate <cmd>     Apply (up), roll back (down) or list (status) database migrations
+  apikey <cmd>      Create, revoke or list API keys
+
+Run "harmonia <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "ingest":
+		err = runIngest(os.Args[2:])
+	case "identify":
+		err = runIdentify(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "eval":
+		err = runEval(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "apikey":
+		err = runAPIKey(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "harmonia: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "harmonia:", err)
+		os.Exit(1)
+	}
+}
+
+// newApplication wires the same repos and services as the API server, without HTTP
+func newApplication() (*server.Application, error) {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := server.ConnectDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	app, err := server.NewApplication(cfg, logger.NewLogger(cfg.Env), db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return app, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/config"
+	"github.com/owenhochwald/harmonia/internal/migrate"
+	"github.com/owenhochwald/harmonia/internal/server"
+	"github.com/pressly/goose/v3"
+)
+
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: harmonia migrate up|down|status")
+		fmt.Fprintln(flags.Output(), "\nup applies every pending migration, down rolls back the latest one.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one of up, down or status")
+	}
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return err
+	}
+	db, err := server.ConnectDB(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot connect to database: %w", err)
+	}
+	defer db.Close()
+
+	provider, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch command := flags.Arg(0); command {
+	case "up":
+		results, err := provider.Up(ctx)
+		printMigrations(results)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		result, err := provider.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Println("No migrations to roll back")
+			return nil
+		}
+		if result != nil {
+			printMigrations([]*goose.MigrationResult{result})
+		}
+		return err
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tFILE")
+		for _, status := range statuses {
+			applied := "-"
+			if !status.AppliedAt.IsZero() {
+				applied = status.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, applied, filepath.Base(status.Source.Path))
+		}
+		return w.Flush()
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	return nil
+}
+
+func printMigrations(results []*goose.MigrationResult) {
+	for _, result := range results {
+		if result.Error != nil {
+			continue
+		}
+		fmt.Printf("%-4s %s (%s)\n", result.Direction, filepath.Base(result.Source.Path), result.Duration.Round(time.Millisecond))
+	}
+}
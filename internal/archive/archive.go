@@ -0,0 +1,72 @@
+// Package archive reads and writes portable catalog archives.
+//
+// An archive starts with an 8 byte uncompressed header:
+//
+//	magic   [4]byte  "HRMA"
+//	version uint16   little-endian, currently 1
+//	flags   uint16   little-endian, reserved, must be 0
+//
+// followed by a single gzip stream of records. Each record is
+//
+//	type    byte
+//	length  uvarint  size of payload in bytes
+//	payload [length]byte
+//
+// Record types, in the order they appear:
+//
+//	1 params  JSON encoded services.FingerprintParams the hashes were generated with
+//	2 song    one per song, see below
+//	3 end     uvarint song count, uvarint fingerprint count, then the SHA-256
+//	          of every record byte (type, length and payload) before the end record
+//
+// A song payload is
+//
+//	meta_len     uvarint
+//	meta         [meta_len]byte  JSON encoded models.Song
+//	count        uvarint         number of fingerprints
+//	count times:
+//	  hash       uint32          little-endian
+//	  delta      uvarint         time offset minus the previous fingerprint's time offset
+//
+// Fingerprints are sorted by time offset so the deltas stay small. Songs are
+// written and read one at a time so neither side holds the whole catalog.
+package archive
+
+import (
+	"errors"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+)
+
+const (
+	magic   = "HRMA"
+	Version = 1
+
+	headerSize = 8
+
+	recordParams byte = 1
+	recordSong   byte = 2
+	recordEnd    byte = 3
+
+	// maxRecordSize guards against corrupt lengths allocating unbounded memory
+	maxRecordSize = 256 << 20
+)
+
+var (
+	ErrNotArchive       = errors.New("not a harmonia archive")
+	ErrChecksumMismatch = errors.New("archive checksum mismatch")
+	ErrTruncated        = errors.New("archive is truncated")
+)
+
+// Entry is one song and its fingerprints
+type Entry struct {
+	Song         models.Song
+	Fingerprints []models.Fingerprint
+}
+
+// Stats counts what went through an archive
+type Stats struct {
+	Songs        int `json:"songs"`
+	Fingerprints int `json:"fingerprints"`
+	Skipped      int `json:"skipped,omitempty"` // Songs already in the catalog on import
+}
@@ -0,0 +1,197 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func testCatalog(t *testing.T, count int) (*repo.MemorySongRepo, *repo.MemoryFingerprintRepo) {
+	t.Helper()
+
+	songs := repo.NewMemorySongRepo()
+	fingerprints := repo.NewMemoryFingerprintRepo()
+	for i := 1; i <= count; i++ {
+		id := strconv.Itoa(i)
+		require.NoError(t, songs.SaveSong(ctx, models.Song{
+			ID:          id,
+			Title:       "Song " + id,
+			Artist:      "Artist",
+			Album:       "Album",
+			Year:        2000 + i,
+			S3Key:       "songs/" + id + ".wav",
+			ContentHash: "hash-" + id,
+			PCMHash:     "pcm-" + id,
+			CreatedAt:   time.Date(2025, 1, i, 0, 0, 0, 0, time.UTC),
+		}))
+
+		fps := make([]models.Fingerprint, 0, 100)
+		for j := 0; j < 100; j++ {
+			fps = append(fps, models.Fingerprint{SongID: int64(i), Hash: uint32(i*1000 + j), TimeOffset: uint32(j * 3)})
+		}
+		require.NoError(t, fingerprints.SaveFingerprints(ctx, fps))
+	}
+
+	return songs, fingerprints
+}
+
+func exportCatalog(t *testing.T, count int) []byte {
+	t.Helper()
+
+	songs, fingerprints := testCatalog(t, count)
+	var buf bytes.Buffer
+	stats, err := Export(ctx, &buf, songs, fingerprints, services.DefaultFingerprintParams())
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Songs: count, Fingerprints: count * 100}, stats)
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := exportCatalog(t, 3)
+
+	reader, err := NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, Version, reader.Version)
+	assert.Equal(t, services.DefaultFingerprintParams(), reader.Params)
+
+	var entries []*Entry
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, "Song 2", entries[1].Song.Title)
+	assert.Equal(t, "hash-2", entries[1].Song.ContentHash)
+	require.Len(t, entries[1].Fingerprints, 100)
+	assert.Equal(t, models.Fingerprint{Hash: 2050, TimeOffset: 150}, entries[1].Fingerprints[50])
+}
+
+func TestReader_RejectsDamage(t *testing.T) {
+	data := exportCatalog(t, 2)
+
+	t.Run("bad magic", func(t *testing.T) {
+		damaged := append([]byte("NOPE"), data[4:]...)
+		_, err := NewReader(bytes.NewReader(damaged))
+		assert.ErrorIs(t, err, ErrNotArchive)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, _, err := Load(ctx, bytes.NewReader(data[:len(data)-40]), services.DefaultFingerprintParams())
+		assert.Error(t, err)
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		// Rewrite the body with one song record altered but the original end record
+		reader, err := NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		first, err := reader.Next()
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		writer, err := NewWriter(&buf, reader.Params)
+		require.NoError(t, err)
+		first.Song.Title = "Tampered"
+		require.NoError(t, writer.WriteSong(first.Song, first.Fingerprints))
+		second, err := reader.Next()
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteSong(second.Song, second.Fingerprints))
+
+		// Hash of the untampered records
+		writer.checksum = reader.checksum
+		require.NoError(t, writer.Close())
+
+		_, _, err = Load(ctx, &buf, services.DefaultFingerprintParams())
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+	})
+}
+
+func TestImport(t *testing.T) {
+	data := exportCatalog(t, 2)
+
+	t.Run("assigns new ids and skips known songs", func(t *testing.T) {
+		songs, fingerprints := repo.NewMemorySongRepo(), repo.NewMemoryFingerprintRepo()
+		require.NoError(t, songs.SaveSong(ctx, models.Song{
+			ID: "10", Title: "Existing", Artist: "Artist", Year: 2001, S3Key: "songs/1.wav",
+			ContentHash: "hash-1", CreatedAt: time.Now(),
+		}))
+
+		stats, err := Import(ctx, bytes.NewReader(data), repo.NewMemoryUnitOfWork(songs, fingerprints), ImportOptions{Params: services.DefaultFingerprintParams()})
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Songs: 1, Fingerprints: 100, Skipped: 1}, stats)
+
+		imported, err := songs.FindByContentHash(ctx, "hash-2")
+		require.NoError(t, err)
+		require.NotNil(t, imported)
+		assert.Equal(t, "11", imported.ID)
+
+		fps, err := fingerprints.FindAllBySongId(ctx, "11")
+		require.NoError(t, err)
+		assert.Len(t, fps, 100)
+	})
+
+	t.Run("skips songs with known audio", func(t *testing.T) {
+		songs, fingerprints := repo.NewMemorySongRepo(), repo.NewMemoryFingerprintRepo()
+		require.NoError(t, songs.SaveSong(ctx, models.Song{
+			ID: "10", Title: "Retagged", Artist: "Artist", Year: 2001, S3Key: "songs/1.wav",
+			ContentHash: "other-hash", PCMHash: "pcm-1", CreatedAt: time.Now(),
+		}))
+
+		stats, err := Import(ctx, bytes.NewReader(data), repo.NewMemoryUnitOfWork(songs, fingerprints), ImportOptions{Params: services.DefaultFingerprintParams()})
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Songs: 1, Fingerprints: 100, Skipped: 1}, stats)
+	})
+
+	t.Run("keeps ids and advances the id sequence", func(t *testing.T) {
+		songs := repo.NewMockSongRepo()
+		songs.On("FindByContentHash", mock.Anything, mock.Anything).Return(nil, nil)
+		songs.On("FindByPCMHash", mock.Anything, mock.Anything).Return(nil, nil)
+		songs.On("SaveSong", mock.Anything, mock.Anything).Return(nil)
+		songs.On("SyncNextID", mock.Anything).Return(nil).Once()
+		catalog := repo.NewMockUnitOfWork(repo.Repos{Songs: songs, Fingerprints: repo.NewMemoryFingerprintRepo()})
+		catalog.On("WithTx", mock.Anything).Return(nil)
+
+		stats, err := Import(ctx, bytes.NewReader(data), catalog, ImportOptions{Params: services.DefaultFingerprintParams(), KeepIDs: true})
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.Songs)
+		songs.AssertCalled(t, "SaveSong", mock.Anything, mock.MatchedBy(func(song models.Song) bool { return song.ID == "2" }))
+		songs.AssertNotCalled(t, "NextID", mock.Anything)
+		songs.AssertExpectations(t)
+	})
+
+	t.Run("imports nothing from a damaged archive", func(t *testing.T) {
+		songs := repo.NewMemorySongRepo()
+		catalog := repo.NewMockUnitOfWork(repo.Repos{Songs: songs, Fingerprints: repo.NewMemoryFingerprintRepo()})
+		catalog.On("WithTx", mock.Anything).Return(nil)
+
+		_, err := Import(ctx, bytes.NewReader(data[:len(data)-40]), catalog, ImportOptions{Params: services.DefaultFingerprintParams()})
+		assert.Error(t, err)
+		assert.Equal(t, 0, catalog.Commits)
+		assert.Equal(t, 1, catalog.Rollbacks)
+	})
+
+	t.Run("rejects other fingerprint params", func(t *testing.T) {
+		params := services.DefaultFingerprintParams()
+		params.TargetZone = 10
+
+		_, err := Import(ctx, bytes.NewReader(data), repo.NewMemoryUnitOfWork(repo.NewMemorySongRepo(), repo.NewMemoryFingerprintRepo()), ImportOptions{Params: params})
+		assert.ErrorIs(t, err, ErrParamsMismatch)
+	})
+}
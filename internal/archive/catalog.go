@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/services"
+)
+
+// Export writes every song in the catalog to w, loading one song's fingerprints at a time
+func Export(ctx context.Context, w io.Writer, songs repo.SongRepo, fingerprints repo.FingerprintRepo, params services.FingerprintParams) (Stats, error) {
+	writer, err := NewWriter(w, params)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	err = songs.EachSong(ctx, func(song models.Song) error {
+		fps, err := fingerprints.FindAllBySongId(ctx, song.ID)
+		if err != nil {
+			return fmt.Errorf("error loading fingerprints of song %s: %w", song.ID, err)
+		}
+		return writer.WriteSong(song, fps)
+	})
+	if err != nil {
+		return writer.Stats(), err
+	}
+
+	return writer.Stats(), writer.Close()
+}
+
+// ImportOptions controls how archived songs are added to a catalog
+type ImportOptions struct {
+	// Params are the fingerprint params of the target catalog. Archives built with
+	// other params are rejected unless IgnoreParams is set.
+	Params       services.FingerprintParams
+	IgnoreParams bool
+	// KeepIDs saves songs under their archived IDs instead of reserving new ones
+	KeepIDs bool
+}
+
+var ErrParamsMismatch = errors.New("archive was fingerprinted with different params")
+
+// Import reads songs from an archive into the catalog in a single transaction, which
+// rolls back if the archive turns out truncated or its checksum doesn't match, so a
+// damaged archive imports nothing. Songs whose content hash is already in the
+// catalog are skipped, so re-importing is safe.
+func Import(ctx context.Context, r io.Reader, catalog repo.UnitOfWork, opts ImportOptions) (Stats, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer reader.Close()
+
+	if !opts.IgnoreParams && reader.Params != opts.Params {
+		return Stats{}, fmt.Errorf("%w: archive %+v, catalog %+v", ErrParamsMismatch, reader.Params, opts.Params)
+	}
+
+	var stats Stats
+	err = catalog.WithTx(ctx, func(tx repo.Repos) error {
+		for {
+			entry, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			imported, err := importEntry(ctx, entry, tx.Songs, tx.Fingerprints, opts)
+			if err != nil {
+				return err
+			}
+			if !imported {
+				stats.Skipped++
+				continue
+			}
+			stats.Songs++
+			stats.Fingerprints += len(entry.Fingerprints)
+		}
+
+		// Archived IDs bypass the ID sequence, move it past them so new uploads
+		// don't collide
+		if opts.KeepIDs && stats.Songs > 0 {
+			if err := tx.Songs.SyncNextID(ctx); err != nil {
+				return fmt.Errorf("error advancing song ids: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return stats, nil
+}
+
+func importEntry(ctx context.Context, entry *Entry, songs repo.SongRepo, fingerprints repo.FingerprintRepo, opts ImportOptions) (bool, error) {
+	song := entry.Song
+
+	if song.ContentHash != "" {
+		existing, err := songs.FindByContentHash(ctx, song.ContentHash)
+		if err != nil {
+			return false, fmt.Errorf("error checking song %s: %w", song.ID, err)
+		}
+		if existing != nil {
+			return false, nil
+		}
+	}
+	if song.PCMHash != "" {
+		existing, err := songs.FindByPCMHash(ctx, song.PCMHash)
+		if err != nil {
+			return false, fmt.Errorf("error checking song %s: %w", song.ID, err)
+		}
+		if existing != nil {
+			return false, nil
+		}
+	}
+
+	if !opts.KeepIDs {
+		id, err := songs.NextID(ctx)
+		if err != nil {
+			return false, fmt.Errorf("error reserving song id: %w", err)
+		}
+		song.ID = id
+	}
+
+	songID, err := strconv.ParseInt(song.ID, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("song id %q is not numeric: %w", song.ID, err)
+	}
+
+	if err := songs.SaveSong(ctx, song); err != nil {
+		return false, fmt.Errorf("error saving song %s: %w", song.ID, err)
+	}
+
+	for i := range entry.Fingerprints {
+		entry.Fingerprints[i].SongID = songID
+	}
+	if err := fingerprints.SaveFingerprints(ctx, entry.Fingerprints); err != nil {
+		return false, fmt.Errorf("error saving fingerprints of song %s: %w", song.ID, err)
+	}
+
+	return true, nil
+}
+
+// Load reads a whole archive into memory repos, for identifying without a database.
+// The archive must have been fingerprinted with params.
+func Load(ctx context.Context, r io.Reader, params services.FingerprintParams) (*repo.MemorySongRepo, *repo.MemoryFingerprintRepo, error) {
+	songs := repo.NewMemorySongRepo()
+	fingerprints := repo.NewMemoryFingerprintRepo()
+
+	_, err := Import(ctx, r, repo.NewMemoryUnitOfWork(songs, fingerprints), ImportOptions{Params: params, KeepIDs: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return songs, fingerprints, nil
+}
@@ -0,0 +1,211 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+)
+
+// Reader streams songs out of an archive
+type Reader struct {
+	Version int
+	Params  services.FingerprintParams
+
+	compressed *gzip.Reader
+	records    *bufio.Reader
+	checksum   hash.Hash
+	stats      Stats
+	done       bool
+}
+
+// NewReader checks the header and reads the fingerprint params
+func NewReader(r io.Reader) (*Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrNotArchive
+	}
+	if string(header[:4]) != magic {
+		return nil, ErrNotArchive
+	}
+
+	version := int(binary.LittleEndian.Uint16(header[4:]))
+	if version != Version {
+		return nil, fmt.Errorf("unsupported archive version %d", version)
+	}
+
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive body: %w", err)
+	}
+
+	reader := &Reader{
+		Version:    version,
+		compressed: compressed,
+		records:    bufio.NewReader(compressed),
+		checksum:   sha256.New(),
+	}
+
+	kind, payload, err := reader.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	if kind != recordParams {
+		return nil, fmt.Errorf("expected params record, got type %d", kind)
+	}
+	if err := json.Unmarshal(payload, &reader.Params); err != nil {
+		return nil, fmt.Errorf("invalid params record: %w", err)
+	}
+
+	return reader, nil
+}
+
+// Next returns the next song. It returns io.EOF once the end record has been
+// read and the checksum and counts verified.
+func (r *Reader) Next() (*Entry, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+
+	// Snapshot the running checksum before the end record is hashed in
+	sum := r.checksum.Sum(nil)
+
+	kind, payload, err := r.readRecord()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case recordSong:
+		entry, err := decodeSong(payload)
+		if err != nil {
+			return nil, err
+		}
+		r.stats.Songs++
+		r.stats.Fingerprints += len(entry.Fingerprints)
+		return entry, nil
+	case recordEnd:
+		if err := r.verifyEnd(payload, sum); err != nil {
+			return nil, err
+		}
+		r.done = true
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("unknown record type %d", kind)
+	}
+}
+
+func (r *Reader) Stats() Stats {
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	return r.compressed.Close()
+}
+
+func (r *Reader) verifyEnd(payload, sum []byte) error {
+	buf := bytes.NewReader(payload)
+	songs, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return ErrTruncated
+	}
+	fingerprints, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return ErrTruncated
+	}
+
+	expected := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(buf, expected); err != nil {
+		return ErrTruncated
+	}
+	if !bytes.Equal(expected, sum) {
+		return ErrChecksumMismatch
+	}
+	if int(songs) != r.stats.Songs || int(fingerprints) != r.stats.Fingerprints {
+		return fmt.Errorf("archive lists %d songs and %d fingerprints but contains %d and %d",
+			songs, fingerprints, r.stats.Songs, r.stats.Fingerprints)
+	}
+
+	return nil
+}
+
+func (r *Reader) readRecord() (byte, []byte, error) {
+	kind, err := r.records.ReadByte()
+	if err != nil {
+		return 0, nil, truncated(err)
+	}
+	length, err := binary.ReadUvarint(r.records)
+	if err != nil {
+		return 0, nil, truncated(err)
+	}
+	if length > maxRecordSize {
+		return 0, nil, fmt.Errorf("record of %d bytes exceeds the %d byte limit", length, maxRecordSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r.records, payload); err != nil {
+		return 0, nil, truncated(err)
+	}
+
+	if kind != recordEnd {
+		r.checksum.Write(binary.AppendUvarint([]byte{kind}, length))
+		r.checksum.Write(payload)
+	}
+
+	return kind, payload, nil
+}
+
+func decodeSong(payload []byte) (*Entry, error) {
+	buf := bytes.NewReader(payload)
+
+	metaLen, err := binary.ReadUvarint(buf)
+	if err != nil || metaLen > uint64(buf.Len()) {
+		return nil, errors.New("invalid song record")
+	}
+	meta := make([]byte, metaLen)
+	io.ReadFull(buf, meta)
+
+	var entry Entry
+	if err := json.Unmarshal(meta, &entry.Song); err != nil {
+		return nil, fmt.Errorf("invalid song metadata: %w", err)
+	}
+
+	count, err := binary.ReadUvarint(buf)
+	// Each fingerprint takes at least 5 bytes, reject counts the payload can't hold
+	if err != nil || count > uint64(buf.Len())/5 {
+		return nil, fmt.Errorf("invalid fingerprints for song %s", entry.Song.ID)
+	}
+
+	entry.Fingerprints = make([]models.Fingerprint, count)
+	offset := uint32(0)
+	for i := range entry.Fingerprints {
+		var hash uint32
+		if err := binary.Read(buf, binary.LittleEndian, &hash); err != nil {
+			return nil, fmt.Errorf("invalid fingerprints for song %s", entry.Song.ID)
+		}
+		delta, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fingerprints for song %s", entry.Song.ID)
+		}
+		offset += uint32(delta)
+		entry.Fingerprints[i] = models.Fingerprint{Hash: hash, TimeOffset: offset}
+	}
+
+	return &entry, nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	return fmt.Errorf("error reading archive: %w", err)
+}
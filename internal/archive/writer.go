@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+)
+
+// Writer streams songs into an archive. Close must be called to write the
+// end record, otherwise readers will reject the archive as truncated.
+type Writer struct {
+	compressed *gzip.Writer
+	checksum   hash.Hash
+	stats      Stats
+	closed     bool
+}
+
+func NewWriter(w io.Writer, params services.FingerprintParams) (*Writer, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.LittleEndian.PutUint16(header[4:], Version)
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("error writing archive header: %w", err)
+	}
+
+	writer := &Writer{
+		compressed: gzip.NewWriter(w),
+		checksum:   sha256.New(),
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.writeRecord(recordParams, encoded); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+// WriteSong appends a song and its fingerprints
+func (w *Writer) WriteSong(song models.Song, fingerprints []models.Fingerprint) error {
+	if w.closed {
+		return errors.New("archive writer is closed")
+	}
+
+	meta, err := json.Marshal(song)
+	if err != nil {
+		return fmt.Errorf("error encoding song %s: %w", song.ID, err)
+	}
+
+	sorted := append([]models.Fingerprint{}, fingerprints...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].TimeOffset != sorted[j].TimeOffset {
+			return sorted[i].TimeOffset < sorted[j].TimeOffset
+		}
+		return sorted[i].Hash < sorted[j].Hash
+	})
+
+	payload := make([]byte, 0, len(meta)+binary.MaxVarintLen64*2+len(sorted)*6)
+	payload = binary.AppendUvarint(payload, uint64(len(meta)))
+	payload = append(payload, meta...)
+	payload = binary.AppendUvarint(payload, uint64(len(sorted)))
+
+	previous := uint32(0)
+	for _, fingerprint := range sorted {
+		payload = binary.LittleEndian.AppendUint32(payload, fingerprint.Hash)
+		payload = binary.AppendUvarint(payload, uint64(fingerprint.TimeOffset-previous))
+		previous = fingerprint.TimeOffset
+	}
+
+	if err := w.writeRecord(recordSong, payload); err != nil {
+		return err
+	}
+
+	w.stats.Songs++
+	w.stats.Fingerprints += len(sorted)
+	return nil
+}
+
+// Close writes the end record and flushes the compressed stream. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	payload := binary.AppendUvarint(nil, uint64(w.stats.Songs))
+	payload = binary.AppendUvarint(payload, uint64(w.stats.Fingerprints))
+	payload = w.checksum.Sum(payload)
+
+	if err := writeRecord(w.compressed, recordEnd, payload); err != nil {
+		return err
+	}
+	return w.compressed.Close()
+}
+
+func (w *Writer) Stats() Stats {
+	return w.stats
+}
+
+func (w *Writer) writeRecord(kind byte, payload []byte) error {
+	return writeRecord(io.MultiWriter(w.compressed, w.checksum), kind, payload)
+}
+
+func writeRecord(w io.Writer, kind byte, payload []byte) error {
+	prefix := binary.AppendUvarint([]byte{kind}, uint64(len(payload)))
+	if _, err := w.Write(prefix); err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+	return nil
+}
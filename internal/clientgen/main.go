@@ -0,0 +1,464 @@
+// Command clientgen generates the Go client in pkg/client from the OpenAPI spec.
+// It covers the subset of OpenAPI that api/openapi.json uses: object schemas,
+// JSON and multipart bodies, and path and query parameters. Operations without
+// a JSON response, such as streams and the docs, are left out.
+//
+//	go run ./internal/clientgen -spec api/openapi.json -out pkg/client/client.gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+func main() {
+	specPath := flag.String("spec", "api/openapi.json", "OpenAPI document to read")
+	out := flag.String("out", "pkg/client/client.gen.go", "Go file to write")
+	pkg := flag.String("package", "client", "package name of the generated file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := Generate(data, *pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type document struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Parameters  []parameter          `json:"parameters"`
+	RequestBody *body                `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type body struct {
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type response struct {
+	body
+}
+
+type schema struct {
+	Ref                  string     `json:"$ref"`
+	Type                 string     `json:"type"`
+	Format               string     `json:"format"`
+	Description          string     `json:"description"`
+	Required             []string   `json:"required"`
+	Properties           properties `json:"properties"`
+	Items                *schema    `json:"items"`
+	AdditionalProperties *schema    `json:"additionalProperties"`
+}
+
+type property struct {
+	Name   string
+	Schema *schema
+}
+
+// properties keeps the order of the document, so the generated fields read
+// like the hand-written models
+type properties []property
+
+func (p *properties) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var s schema
+		if err := dec.Decode(&s); err != nil {
+			return err
+		}
+		*p = append(*p, property{Name: token.(string), Schema: &s})
+	}
+	return nil
+}
+
+const (
+	jsonType      = "application/json"
+	multipartType = "multipart/form-data"
+)
+
+// Generate returns the gofmt'ed client source for the OpenAPI document in spec
+func Generate(spec []byte, pkg string) ([]byte, error) {
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+
+	g := &generator{doc: &doc, forms: map[string]bool{}, imports: map[string]bool{}}
+	operations := g.operations()
+	for _, op := range operations {
+		if op.form != "" {
+			g.forms[op.form] = true
+		}
+	}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.schemaType(name, doc.Components.Schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range operations {
+		if err := g.method(op); err != nil {
+			return nil, err
+		}
+	}
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by clientgen from api/openapi.json. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&file, "package %s\n\nimport (\n", pkg)
+	imports := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&file, "%q\n", path)
+	}
+	fmt.Fprintf(&file, ")\n\n")
+	file.Write(g.buf.Bytes())
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go: %w", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	doc     *document
+	forms   map[string]bool // Schemas sent as multipart forms
+	imports map[string]bool
+	buf     bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// clientOperation is an operation the client gets a method for
+type clientOperation struct {
+	*operation
+	method   string
+	path     string
+	form     string // Multipart request schema
+	jsonBody string // JSON request schema
+	result   string // Response schema
+	statuses []string
+}
+
+// operations returns the operations answering with a JSON schema, in path order
+func (g *generator) operations() []clientOperation {
+	var ops []clientOperation
+	for path, item := range g.doc.Paths {
+		for method, op := range item {
+			cop := clientOperation{operation: op, method: strings.ToUpper(method), path: path}
+			for status, resp := range op.Responses {
+				content, ok := resp.Content[jsonType]
+				if !ok || content.Schema == nil || content.Schema.Ref == "" {
+					continue
+				}
+				result := refName(content.Schema.Ref)
+				if cop.result != "" && cop.result != result {
+					continue
+				}
+				cop.result = result
+				cop.statuses = append(cop.statuses, status)
+			}
+			if cop.result == "" {
+				continue
+			}
+			sort.Strings(cop.statuses)
+
+			if op.RequestBody != nil {
+				if content, ok := op.RequestBody.Content[multipartType]; ok {
+					cop.form = refName(content.Schema.Ref)
+				} else if content, ok := op.RequestBody.Content[jsonType]; ok {
+					cop.jsonBody = refName(content.Schema.Ref)
+				}
+			}
+			ops = append(ops, cop)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].path != ops[j].path {
+			return ops[i].path < ops[j].path
+		}
+		return ops[i].method < ops[j].method
+	})
+	return ops
+}
+
+func (g *generator) schemaType(name string, s *schema) error {
+	if s.Type != "object" || len(s.Properties) == 0 {
+		return nil
+	}
+
+	comment(&g.buf, typeDoc(name, s.Description))
+	g.printf("type %s struct {\n", name)
+	for _, p := range s.Properties {
+		required := slices.Contains(s.Required, p.Name)
+		typ, err := g.goType(p.Schema, required)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, p.Name, err)
+		}
+		if p.Schema.Description != "" {
+			comment(&g.buf, p.Schema.Description)
+		}
+		if g.forms[name] {
+			g.printf("%s %s\n", fieldName(p.Name), typ)
+			continue
+		}
+		tag := p.Name
+		if !required {
+			tag += ",omitempty"
+		}
+		g.printf("%s %s `json:%q`\n", fieldName(p.Name), typ, tag)
+	}
+	g.printf("}\n\n")
+
+	if g.forms[name] {
+		return g.formWriter(name, s)
+	}
+	return nil
+}
+
+// formWriter generates the method writing a multipart schema's fields
+func (g *generator) formWriter(name string, s *schema) error {
+	g.printf("func (r %s) writeForm(f *formWriter) {\n", name)
+	for _, p := range s.Properties {
+		field := "r." + fieldName(p.Name)
+		required := slices.Contains(s.Required, p.Name)
+		switch {
+		case p.Schema.Type == "array" && p.Schema.Items.Format == "binary":
+			g.printf("for _, file := range %s {\nf.file(%q, file)\n}\n", field, p.Name)
+		case p.Schema.Format == "binary" && required:
+			g.printf("f.file(%q, %s)\n", p.Name, field)
+		case p.Schema.Format == "binary":
+			g.printf("if %s != nil {\nf.file(%q, *%s)\n}\n", field, p.Name, field)
+		case required:
+			g.printf("f.field(%q, %s, true)\n", p.Name, field)
+		default:
+			g.printf("f.field(%q, %s, false)\n", p.Name, field)
+		}
+	}
+	g.printf("}\n\n")
+	return nil
+}
+
+func (g *generator) goType(s *schema, required bool) (string, error) {
+	if s.Ref != "" {
+		if required {
+			return refName(s.Ref), nil
+		}
+		return "*" + refName(s.Ref), nil
+	}
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return "time.Time", nil
+		case "byte":
+			return "[]byte", nil
+		case "binary":
+			if required {
+				return "File", nil
+			}
+			return "*File", nil
+		}
+		return "string", nil
+	case "integer":
+		if s.Format == "int64" {
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		item, err := g.goType(s.Items, true)
+		return "[]" + item, err
+	case "object":
+		if s.AdditionalProperties != nil {
+			value, err := g.goType(s.AdditionalProperties, true)
+			return "map[string]" + value, err
+		}
+		return "map[string]any", nil
+	}
+	return "", fmt.Errorf("unsupported schema type %q", s.Type)
+}
+
+func (g *generator) method(op clientOperation) error {
+	name := exported(op.OperationID)
+	g.imports["context"] = true
+	g.imports["net/http"] = true
+	var args, pathArgs []string
+	path := op.path
+	var query []parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			arg := unexported(p.Name)
+			args = append(args, arg+" string")
+			path = strings.Replace(path, "{"+p.Name+"}", "%s", 1)
+			pathArgs = append(pathArgs, "url.PathEscape("+arg+")")
+			g.imports["fmt"] = true
+			g.imports["net/url"] = true
+		case "query":
+			query = append(query, p)
+			g.imports["net/url"] = true
+		}
+	}
+
+	if len(query) > 0 {
+		comment(&g.buf, name+"Params are the query parameters of "+name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range query {
+			typ, err := g.goType(p.Schema, true)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op.OperationID, err)
+			}
+			if p.Description != "" {
+				comment(&g.buf, p.Description)
+			}
+			g.printf("%s %s\n", fieldName(p.Name), typ)
+		}
+		g.printf("}\n\n")
+		args = append(args, "params "+name+"Params")
+	}
+	switch {
+	case op.form != "":
+		args = append(args, "body "+op.form)
+	case op.jsonBody != "":
+		args = append(args, "body "+op.jsonBody)
+	}
+
+	summary := strings.TrimSuffix(op.Summary, ".")
+	comment(&g.buf, fmt.Sprintf("%s calls %s %s: %s", name, op.method, op.path, lowerFirst(summary)))
+	g.printf("func (c *Client) %s(%s) (*%s, error) {\n", name, strings.Join(append([]string{"ctx context.Context"}, args...), ", "), op.result)
+
+	if len(pathArgs) > 0 {
+		g.printf("path := fmt.Sprintf(%q, %s)\n", path, strings.Join(pathArgs, ", "))
+	} else {
+		g.printf("path := %q\n", path)
+	}
+	g.printf("req := request{method: http.Method%s, path: path, decode: []int{%s}}\n",
+		methodConst(op.method), strings.Join(op.statuses, ", "))
+	if len(query) > 0 {
+		g.printf("req.query = url.Values{}\n")
+		for _, p := range query {
+			g.printf("setQuery(req.query, %q, params.%s)\n", p.Name, fieldName(p.Name))
+		}
+	}
+	switch {
+	case op.form != "":
+		g.printf("req.form = body.writeForm\n")
+	case op.jsonBody != "":
+		g.printf("req.json = body\n")
+	}
+	g.printf("var result %s\n", op.result)
+	g.printf("decoded, err := c.do(ctx, req, &result)\n")
+	g.printf("if !decoded {\nreturn nil, err\n}\n")
+	g.printf("return &result, err\n}\n\n")
+	return nil
+}
+
+func comment(buf *bytes.Buffer, text string) {
+	fmt.Fprintf(buf, "// %s\n", text)
+}
+
+// typeDoc is the doc comment of a schema's type
+func typeDoc(name, description string) string {
+	if description == "" {
+		return name + " is the " + name + " schema"
+	}
+	return name + " is " + lowerFirst(strings.TrimSuffix(description, "."))
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func methodConst(method string) string {
+	return exported(strings.ToLower(method))
+}
+
+// initialisms are written in capitals in Go names
+var initialisms = map[string]string{"id": "ID", "url": "URL", "api": "API", "http": "HTTP", "json": "JSON"}
+
+// fieldName turns a snake_case property into a Go field name
+func fieldName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if initialism, ok := initialisms[word]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		b.WriteString(exported(word))
+	}
+	return b.String()
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func unexported(name string) string {
+	if initialism, ok := initialisms[name]; ok {
+		return strings.ToLower(initialism)
+	}
+	return lowerFirst(name)
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate_UpToDate(t *testing.T) {
+	spec, err := os.ReadFile("../../api/openapi.json")
+	require.NoError(t, err)
+	committed, err := os.ReadFile("../../pkg/client/client.gen.go")
+	require.NoError(t, err)
+
+	generated, err := Generate(spec, "client")
+	require.NoError(t, err)
+	assert.Equal(t, string(committed), string(generated), "pkg/client is stale, run go generate ./pkg/client")
+}
+
+func TestFieldName(t *testing.T) {
+	tests := map[string]string{
+		"id":            "ID",
+		"job_id":        "JobID",
+		"s3_key":        "S3Key",
+		"offset_frames": "OffsetFrames",
+		"api_key":       "APIKey",
+	}
+	for property, want := range tests {
+		assert.Equal(t, want, fieldName(property), property)
+	}
+}
@@ -1,44 +1,359 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/owenhochwald/harmonia/pkg/logger"
-	"github.com/rs/zerolog"
 )
 
 type Config struct {
-	Logger    zerolog.Logger
 	Env       string
 	Port      string
 	DBURL     string
 	S3Bucket  string
 	AWSRegion string
+
+	DBQueryTimeout time.Duration // Applied to queries without a deadline, 0 disables it
+	MigrateOnStart bool          // Apply pending migrations before serving
+
+	MaxMultipartMemory Size // Multipart form bytes kept in memory before spilling to disk
+
+	HTTPReadHeaderTimeout time.Duration
+	HTTPReadTimeout       time.Duration // Whole request including the upload body, 0 disables it
+	HTTPWriteTimeout      time.Duration // 0 disables it, event streams clear it themselves
+	HTTPIdleTimeout       time.Duration
+	ShutdownTimeout       time.Duration // Time to drain requests and ingest jobs after SIGTERM
+
+	TrustedProxies []string // Proxy IPs or CIDRs whose X-Forwarded-For is believed, none by default
+
+	AuthRequired bool // Require API keys, turn off only for local development
+
+	IdentifyLimits Limits
+	IngestLimits   Limits
+
+	StorageDir      string
+	IngestWorkers   int
+	IngestQueueSize int
+
+	IdentifyStreamTimeout  time.Duration
+	IdentifyThreshold      float64
+	IdentifyAllowedOrigins []string // Browser origins that may open identify streams, "*" allows any
+
+	DuplicateThreshold float64 // Fingerprint coverage marking an upload as a duplicate, 0 disables it
+	DuplicateAction    string  // reject or flag
+
+	TracingExporter string // otlp, stdout or none
+}
+
+// Limits throttle the routes of one API key scope. Rates are requests per second,
+// 0 disables a limit.
+type Limits struct {
+	Rate       float64 // Per API key
+	Burst      int
+	IPRate     float64 // Per client IP, whether or not it sends a key
+	IPBurst    int
+	DailyQuota int // Requests per API key per UTC day
+}
+
+// Default is the configuration before any file, env var or flag is applied
+func Default() Config {
+	return Config{
+		Port: "8080",
+
+		DBQueryTimeout: 5 * time.Second,
+
+		MaxMultipartMemory: 32 << 20,
+
+		HTTPReadHeaderTimeout: 10 * time.Second,
+		HTTPReadTimeout:       2 * time.Minute,
+		HTTPWriteTimeout:      2 * time.Minute,
+		HTTPIdleTimeout:       2 * time.Minute,
+		// Below the 30s ECS waits between SIGTERM and SIGKILL
+		ShutdownTimeout: 25 * time.Second,
+
+		AuthRequired: true,
+
+		// Identification is CPU-heavy but quick, uploads queue work for minutes
+		IdentifyLimits: Limits{Rate: 2, Burst: 10, IPRate: 5, IPBurst: 20},
+		IngestLimits:   Limits{Rate: 0.5, Burst: 5, IPRate: 1, IPBurst: 10},
+
+		StorageDir:      "data/audio",
+		IngestWorkers:   2,
+		IngestQueueSize: 64,
+
+		IdentifyStreamTimeout: 30 * time.Second,
+		IdentifyThreshold:     0.05,
+
+		DuplicateThreshold: 0.5,
+		DuplicateAction:    "reject",
+
+		TracingExporter: "none",
+	}
 }
 
-func NewConfig() Config {
-	err := godotenv.Load()
+// field is one setting, named key in config files (with "." between sections),
+// -key in flags (with "-" for "_") and env in the environment
+type field struct {
+	key   string
+	env   string
+	usage string
+	value flag.Value
+}
+
+func (f field) flagName() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+func (c *Config) fields() []field {
+	fields := []field{
+		{"env", "ENVIRONMENT", "environment name, dev enables console logging", stringValue{&c.Env}},
+		{"port", "PORT", "HTTP port", stringValue{&c.Port}},
+		{"db.url", "DB_URL", "Postgres connection URL", stringValue{&c.DBURL}},
+		{"db.query_timeout", "DB_QUERY_TIMEOUT", "timeout for queries without a deadline, 0 disables it", durationValue{&c.DBQueryTimeout}},
+		{"db.migrate_on_start", "MIGRATE_ON_START", "apply pending migrations before serving", boolValue{&c.MigrateOnStart}},
+		{"http.max_multipart_memory", "HTTP_MAX_MULTIPART_MEMORY", "multipart form bytes kept in memory, e.g. 32MiB", sizeValue{&c.MaxMultipartMemory}},
+		{"http.read_header_timeout", "HTTP_READ_HEADER_TIMEOUT", "time to read request headers", durationValue{&c.HTTPReadHeaderTimeout}},
+		{"http.read_timeout", "HTTP_READ_TIMEOUT", "time to read a whole request, 0 disables it", durationValue{&c.HTTPReadTimeout}},
+		{"http.write_timeout", "HTTP_WRITE_TIMEOUT", "time to write a response, 0 disables it", durationValue{&c.HTTPWriteTimeout}},
+		{"http.idle_timeout", "HTTP_IDLE_TIMEOUT", "how long idle keep-alive connections stay open", durationValue{&c.HTTPIdleTimeout}},
+		{"http.shutdown_timeout", "SHUTDOWN_TIMEOUT", "time to drain requests and ingest jobs on shutdown", durationValue{&c.ShutdownTimeout}},
+		{"http.trusted_proxies", "TRUSTED_PROXIES", "comma-separated IPs or CIDRs of proxies whose X-Forwarded-For gives the client IP", listValue{&c.TrustedProxies}},
+		{"auth.required", "AUTH_REQUIRED", "require API keys, turn off only for local development", boolValue{&c.AuthRequired}},
+		{"s3.bucket", "S3_BUCKET", "S3 bucket for raw audio", stringValue{&c.S3Bucket}},
+		{"aws.region", "AWS_REGION", "AWS region", stringValue{&c.AWSRegion}},
+		{"storage.dir", "STORAGE_DIR", "directory for uploaded audio", stringValue{&c.StorageDir}},
+		{"ingest.workers", "INGEST_WORKERS", "ingest jobs fingerprinted at once", intValue{&c.IngestWorkers}},
+		{"ingest.queue_size", "INGEST_QUEUE_SIZE", "ingest jobs waiting for a worker before uploads are refused", intValue{&c.IngestQueueSize}},
+		{"identify.stream_timeout", "IDENTIFY_STREAM_TIMEOUT", "longest live identification stream", durationValue{&c.IdentifyStreamTimeout}},
+		{"identify.match_threshold", "IDENTIFY_MATCH_THRESHOLD", "lowest confidence reported as a match, 0 to 1", floatValue{&c.IdentifyThreshold}},
+		{"identify.allowed_origins", "IDENTIFY_ALLOWED_ORIGINS", "comma-separated origins of web pages allowed to open identify streams, * allows any", listValue{&c.IdentifyAllowedOrigins}},
+		{"duplicates.threshold", "DUPLICATE_THRESHOLD", "share of an upload's fingerprints a catalog song must match to make it a duplicate, 0 disables it", floatValue{&c.DuplicateThreshold}},
+		{"duplicates.action", "DUPLICATE_ACTION", "what to do with duplicate uploads: reject or flag", stringValue{&c.DuplicateAction}},
+		{"tracing.exporter", "TRACING_EXPORTER", "span exporter: otlp, stdout or none", stringValue{&c.TracingExporter}},
+	}
+	fields = append(fields, c.IdentifyLimits.fields("identify")...)
+	return append(fields, c.IngestLimits.fields("ingest")...)
+}
 
-	if err != nil {
-		panic("Error loading .env file")
+// fields names the limits of scope limits.<scope>.rate, LIMITS_<SCOPE>_RATE and so on
+func (l *Limits) fields(scope string) []field {
+	key := "limits." + scope + "."
+	env := "LIMITS_" + strings.ToUpper(scope) + "_"
+	return []field{
+		{key + "rate", env + "RATE", scope + " requests per second per API key, 0 disables it", floatValue{&l.Rate}},
+		{key + "burst", env + "BURST", scope + " requests an API key may make at once", intValue{&l.Burst}},
+		{key + "ip_rate", env + "IP_RATE", scope + " requests per second per client IP, 0 disables it", floatValue{&l.IPRate}},
+		{key + "ip_burst", env + "IP_BURST", scope + " requests a client IP may make at once", intValue{&l.IPBurst}},
+		{key + "daily_quota", env + "DAILY_QUOTA", scope + " requests per API key per UTC day, 0 disables it", intValue{&l.DailyQuota}},
 	}
+}
 
-	env := os.Getenv("ENVIRONMENT")
-	port := os.Getenv("PORT")
-	db_url := os.Getenv("DB_URL")
-	region := os.Getenv("AWS_REGION")
-	s3_bucket := os.Getenv("S3_BUCKET")
+// Load builds the configuration from, lowest precedence first: the defaults, a YAML
+// or TOML file, a .env file, the environment and the flags in args. The file is
+// given with -config or HARMONIA_CONFIG, else harmonia.yaml or harmonia.toml is
+// used when present. Missing .env and config files are fine. Every invalid setting
+// is reported in the returned error, not just the first one.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+	var errs []error
 
-	logger := logger.NewLogger(env)
+	flags := flag.NewFlagSet("harmonia", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("HARMONIA_CONFIG"), "YAML or TOML config file (env HARMONIA_CONFIG)")
+	// Flag values are applied after the file and env, and collected rather than
+	// parsed here so one bad flag doesn't hide the others
+	flagValues := make(map[string]string)
+	for _, f := range fields {
+		name := f.flagName()
+		usage := fmt.Sprintf("%s (env %s, default %q)", f.usage, f.env, f.value.String())
+		set := func(s string) error {
+			flagValues[name] = s
+			return nil
+		}
+		if _, ok := f.value.(boolValue); ok {
+			flags.BoolFunc(name, usage, set)
+		} else {
+			flags.Func(name, usage, set)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
 
-	return Config{
-		Logger:    logger,
-		Env:       env,
-		Port:      port,
-		DBURL:     db_url,
-		S3Bucket:  s3_bucket,
-		AWSRegion: region,
+	file := *path
+	if file == "" {
+		file = findDefaultFile()
+	}
+	if file != "" {
+		values, err := readFile(file)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		errs = append(errs, apply(fields, values, func(f field) string { return f.key }, file+": ")...)
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, fmt.Errorf(".env: %w", err))
+	}
+	env := make(map[string]string)
+	for _, f := range fields {
+		if value := os.Getenv(f.env); value != "" {
+			env[f.env] = value
+		}
+	}
+	errs = append(errs, apply(fields, env, func(f field) string { return f.env }, "")...)
+
+	errs = append(errs, apply(fields, flagValues, func(f field) string { return f.flagName() }, "-")...)
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// apply sets each field found in values, keyed by name(field). Keys matching no
+// field are reported as unknown.
+func apply(fields []field, values map[string]string, name func(field) string, prefix string) []error {
+	var errs []error
+	known := make(map[string]bool)
+	for _, f := range fields {
+		key := name(f)
+		known[key] = true
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if err := f.value.Set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", prefix, key, err))
+		}
+	}
+
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("%s%s: unknown setting", prefix, key))
+	}
+	return errs
+}
+
+// Validate reports every setting out of range at once
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("port", "must be a number between 1 and 65535, got %q", c.Port)
+	}
+	if c.DBURL == "" {
+		invalid("db.url", "is required")
+	}
+	if c.DBQueryTimeout < 0 {
+		invalid("db.query_timeout", "must not be negative")
+	}
+	if c.MaxMultipartMemory <= 0 {
+		invalid("http.max_multipart_memory", "must be positive")
+	}
+	if c.HTTPReadHeaderTimeout <= 0 {
+		invalid("http.read_header_timeout", "must be positive")
+	}
+	if c.HTTPReadTimeout < 0 {
+		invalid("http.read_timeout", "must not be negative")
+	}
+	if c.HTTPWriteTimeout < 0 {
+		invalid("http.write_timeout", "must not be negative")
 	}
+	if c.HTTPIdleTimeout < 0 {
+		invalid("http.idle_timeout", "must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("http.shutdown_timeout", "must be positive")
+	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				invalid("http.trusted_proxies", "must be IPs or CIDRs such as 10.0.0.0/8, got %q", proxy)
+			}
+		}
+	}
+	if c.StorageDir == "" {
+		invalid("storage.dir", "is required")
+	}
+	if c.IngestWorkers < 1 {
+		invalid("ingest.workers", "must be at least 1, got %d", c.IngestWorkers)
+	}
+	if c.IngestQueueSize < 1 {
+		invalid("ingest.queue_size", "must be at least 1, got %d", c.IngestQueueSize)
+	}
+	if c.IdentifyStreamTimeout <= 0 {
+		invalid("identify.stream_timeout", "must be positive")
+	}
+	if c.IdentifyThreshold < 0 || c.IdentifyThreshold > 1 {
+		invalid("identify.match_threshold", "must be between 0 and 1, got %g", c.IdentifyThreshold)
+	}
+	for _, origin := range c.IdentifyAllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			invalid("identify.allowed_origins", "must be origins such as https://example.com, got %q", origin)
+		}
+	}
+	if c.DuplicateThreshold < 0 || c.DuplicateThreshold > 1 {
+		invalid("duplicates.threshold", "must be between 0 and 1, got %g", c.DuplicateThreshold)
+	}
+	switch c.DuplicateAction {
+	case "reject", "flag":
+	default:
+		invalid("duplicates.action", "must be reject or flag, got %q", c.DuplicateAction)
+	}
+	c.IdentifyLimits.validate("limits.identify.", invalid)
+	c.IngestLimits.validate("limits.ingest.", invalid)
+	switch c.TracingExporter {
+	case "otlp", "stdout", "none", "":
+	default:
+		invalid("tracing.exporter", "must be otlp, stdout or none, got %q", c.TracingExporter)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.Join(errs...)
+}
 
+func (l Limits) validate(prefix string, invalid func(key, format string, args ...any)) {
+	if l.Rate < 0 {
+		invalid(prefix+"rate", "must not be negative")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		invalid(prefix+"burst", "must be at least 1, got %d", l.Burst)
+	}
+	if l.IPRate < 0 {
+		invalid(prefix+"ip_rate", "must not be negative")
+	}
+	if l.IPRate > 0 && l.IPBurst < 1 {
+		invalid(prefix+"ip_burst", "must be at least 1, got %d", l.IPBurst)
+	}
+	if l.DailyQuota < 0 {
+		invalid(prefix+"daily_quota", "must not be negative")
+	}
 }
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolate runs the test in an empty directory with none of the config env vars set
+func isolate(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	// t.Setenv restores the old value after the test, and unsetting lets .env
+	// files fill the variable in as they would in a clean environment
+	cfg := Default()
+	names := []string{"HARMONIA_CONFIG"}
+	for _, f := range cfg.fields() {
+		names = append(names, f.env)
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	isolate(t)
+	t.Setenv("DB_URL", "postgres://localhost/harmonia")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err, "no .env or config file is needed")
+
+	want := Default()
+	want.DBURL = "postgres://localhost/harmonia"
+	assert.Equal(t, want, cfg)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := isolate(t)
+	writeFile(t, filepath.Join(dir, "harmonia.yaml"), `
+port: 7000
+db:
+  url: postgres://file/harmonia
+  query_timeout: 2s
+ingest:
+  workers: 3
+  queue_size: 10
+http:
+  max_multipart_memory: 8MiB
+limits:
+  identify:
+    daily_quota: 1000
+identify:
+  allowed_origins:
+    - https://app.example.com
+    - https://admin.example.com
+`)
+	writeFile(t, filepath.Join(dir, ".env"), "INGEST_QUEUE_SIZE=20\nINGEST_WORKERS=4\n")
+	t.Setenv("INGEST_WORKERS", "5")
+	t.Setenv("LIMITS_INGEST_RATE", "0.25")
+
+	cfg, err := Load([]string{"-ingest.workers", "6", "-db.migrate-on-start"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "7000", cfg.Port, "file")
+	assert.Equal(t, "postgres://file/harmonia", cfg.DBURL, "file")
+	assert.Equal(t, 2*time.Second, cfg.DBQueryTimeout, "file")
+	assert.Equal(t, Size(8<<20), cfg.MaxMultipartMemory, "file")
+	assert.Equal(t, 20, cfg.IngestQueueSize, ".env beats the file")
+	assert.Equal(t, 6, cfg.IngestWorkers, "flags beat the environment")
+	assert.True(t, cfg.MigrateOnStart)
+	assert.Equal(t, 1000, cfg.IdentifyLimits.DailyQuota, "file")
+	assert.Equal(t, 0.25, cfg.IngestLimits.Rate, "environment")
+	assert.Equal(t, []string{"https://app.example.com", "https://admin.example.com"}, cfg.IdentifyAllowedOrigins, "file")
+}
+
+func TestLoad_TOMLFile(t *testing.T) {
+	dir := isolate(t)
+	path := filepath.Join(dir, "custom.toml")
+	writeFile(t, path, `
+[db]
+url = "postgres://toml/harmonia"
+
+[identify]
+stream_timeout = "1m"
+match_threshold = 0.2
+
+[duplicates]
+threshold = 0.8
+action = "flag"
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://toml/harmonia", cfg.DBURL)
+	assert.Equal(t, time.Minute, cfg.IdentifyStreamTimeout)
+	assert.Equal(t, 0.2, cfg.IdentifyThreshold)
+	assert.Equal(t, 0.8, cfg.DuplicateThreshold)
+	assert.Equal(t, "flag", cfg.DuplicateAction)
+}
+
+func TestLoad_ReportsEveryError(t *testing.T) {
+	dir := isolate(t)
+	writeFile(t, filepath.Join(dir, "harmonia.yaml"), "ingest:\n  wrokers: 4\n")
+	t.Setenv("DB_QUERY_TIMEOUT", "5")
+	t.Setenv("INGEST_QUEUE_SIZE", "0")
+	t.Setenv("DUPLICATE_ACTION", "merge")
+	t.Setenv("IDENTIFY_ALLOWED_ORIGINS", "https://app.example.com, app.example.com")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,load-balancer")
+
+	_, err := Load([]string{"-identify.match-threshold", "2", "-http.max-multipart-memory", "lots"})
+	require.Error(t, err)
+
+	for _, want := range []string{
+		"harmonia.yaml: ingest.wrokers: unknown setting",
+		"DB_QUERY_TIMEOUT: invalid duration",
+		"-http.max-multipart-memory: invalid size",
+		"db.url: is required",
+		"ingest.queue_size: must be at least 1",
+		"identify.match_threshold: must be between 0 and 1",
+		`duplicates.action: must be reject or flag, got "merge"`,
+		`identify.allowed_origins: must be origins such as https://example.com, got "app.example.com"`,
+		`http.trusted_proxies: must be IPs or CIDRs such as 10.0.0.0/8, got "load-balancer"`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestLoad_MissingExplicitFile(t *testing.T) {
+	isolate(t)
+	t.Setenv("DB_URL", "postgres://localhost/harmonia")
+
+	_, err := Load([]string{"-config", "missing.yaml"})
+	assert.ErrorContains(t, err, "missing.yaml")
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Size
+	}{
+		{"1024", 1024},
+		{"512KiB", 512 << 10},
+		{"10MB", 10_000_000},
+		{"1.5 GiB", 3 << 29},
+		{"32mib", 32 << 20},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, bad := range []string{"", "MB", "-1KB", "ten"} {
+		_, err := ParseSize(bad)
+		assert.Error(t, err, bad)
+	}
+
+	assert.Equal(t, "32MiB", Size(32<<20).String())
+	assert.Equal(t, "1500B", Size(1500).String())
+}
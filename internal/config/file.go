@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultFiles are looked up in the working directory when no file is given
+var defaultFiles = []string{"harmonia.yaml", "harmonia.yml", "harmonia.toml"}
+
+func findDefaultFile() string {
+	for _, name := range defaultFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// readFile decodes a YAML or TOML file into dotted keys, so
+//
+//	db:
+//	  query_timeout: 2s
+//
+// becomes "db.query_timeout" = "2s"
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format %q, use .yaml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten("", tree, values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]any, values map[string]string) error {
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+
+		switch value := tree[key].(type) {
+		case map[string]any:
+			if err := flatten(name, value, values); err != nil {
+				return err
+			}
+		case []any:
+			// Lists reach listValue as the comma-separated form the env var uses
+			items := make([]string, len(value))
+			for i, item := range value {
+				switch item.(type) {
+				case map[string]any, []any:
+					return fmt.Errorf("%s: only lists of values are supported", name)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+			// An empty key keeps the default
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Degradation describes how a query clip is damaged before identification.
+// Zero values leave the clip untouched.
+type Degradation struct {
+	Noise     string  `json:"noise,omitempty"`      // "white" or "pink"
+	SNR       float64 `json:"snr_db,omitempty"`     // Signal to noise ratio of the added noise, in dB
+	LowPass   float64 `json:"lowpass_hz,omitempty"` // Cutoff of a gentle 12 dB/octave low-pass filter
+	BandLimit float64 `json:"bandlimit_hz,omitempty"`
+	Gain      float64 `json:"gain_db,omitempty"`
+	Jitter    float64 `json:"jitter_s,omitempty"` // Clip start moves up to this many seconds from the nominal offset
+}
+
+func (d Degradation) validate() error {
+	switch d.Noise {
+	case "", "white", "pink":
+	default:
+		return fmt.Errorf("unknown noise %q, use white or pink", d.Noise)
+	}
+	if d.LowPass < 0 || d.BandLimit < 0 || d.Jitter < 0 {
+		return fmt.Errorf("lowpass, bandlimit and jitter can't be negative")
+	}
+	return nil
+}
+
+// Apply returns a degraded copy of samples, which are mono in [-1, 1].
+// Jitter is not applied here since it changes where the clip is cut.
+func (d Degradation) Apply(samples []float64, sampleRate int, rng *rand.Rand) []float64 {
+	out := append([]float64{}, samples...)
+
+	if d.LowPass > 0 {
+		lowPass(out, d.LowPass, sampleRate, 1)
+	}
+	if d.BandLimit > 0 {
+		bandLimit(out, d.BandLimit, sampleRate)
+	}
+	if d.Gain != 0 {
+		scale := math.Pow(10, d.Gain/20)
+		for i := range out {
+			out[i] *= scale
+		}
+	}
+	if d.Noise != "" {
+		addNoise(out, d.Noise, d.SNR, rng)
+	}
+
+	for i, v := range out {
+		out[i] = math.Max(-1, math.Min(1, v))
+	}
+	return out
+}
+
+// addNoise mixes in white or pink noise scaled to the requested SNR
+func addNoise(samples []float64, kind string, snr float64, rng *rand.Rand) {
+	signalPower := power(samples)
+	if signalPower == 0 {
+		return
+	}
+
+	noise := make([]float64, len(samples))
+	for i := range noise {
+		noise[i] = rng.NormFloat64()
+	}
+	if kind == "pink" {
+		pinkFilter(noise)
+	}
+
+	scale := math.Sqrt(signalPower / math.Pow(10, snr/10) / power(noise))
+	for i := range samples {
+		samples[i] += noise[i] * scale
+	}
+}
+
+// pinkFilter turns white noise into pink noise (-3 dB/octave) with Paul Kellet's filter
+func pinkFilter(samples []float64) {
+	var b0, b1, b2, b3, b4, b5, b6 float64
+	for i, white := range samples {
+		b0 = 0.99886*b0 + white*0.0555179
+		b1 = 0.99332*b1 + white*0.0750759
+		b2 = 0.96900*b2 + white*0.1538520
+		b3 = 0.86650*b3 + white*0.3104856
+		b4 = 0.55000*b4 + white*0.5329522
+		b5 = -0.7616*b5 - white*0.0168980
+		samples[i] = b0 + b1 + b2 + b3 + b4 + b5 + b6 + white*0.5362
+		b6 = white * 0.115926
+	}
+}
+
+// bandLimit mimics a lossy codec: a steep low-pass at cutoff and the lowest bass removed
+func bandLimit(samples []float64, cutoff float64, sampleRate int) {
+	lowPass(samples, cutoff, sampleRate, 4)
+	highPass(samples, 40, sampleRate)
+}
+
+func lowPass(samples []float64, cutoff float64, sampleRate int, stages int) {
+	nyquist := float64(sampleRate) / 2
+	if cutoff >= nyquist {
+		return
+	}
+	for i := 0; i < stages; i++ {
+		newBiquad(cutoff, sampleRate, false).process(samples)
+	}
+}
+
+func highPass(samples []float64, cutoff float64, sampleRate int) {
+	newBiquad(cutoff, sampleRate, true).process(samples)
+}
+
+const butterworthQ = 1 / math.Sqrt2
+
+// biquad is a second order Butterworth filter (RBJ cookbook)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+func newBiquad(cutoff float64, sampleRate int, highPass bool) biquad {
+	w0 := 2 * math.Pi * cutoff / float64(sampleRate)
+	alpha := math.Sin(w0) / (2 * butterworthQ)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+
+	var b0, b1 float64
+	if highPass {
+		b0 = (1 + cos) / 2
+		b1 = -(1 + cos)
+	} else {
+		b0 = (1 - cos) / 2
+		b1 = 1 - cos
+	}
+
+	return biquad{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b0 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func (f biquad) process(samples []float64) {
+	var x1, x2, y1, y2 float64
+	for i, x := range samples {
+		y := f.b0*x + f.b1*x1 + f.b2*x2 - f.a1*y1 - f.a2*y2
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		samples[i] = y
+	}
+}
+
+func power(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range samples {
+		sum += v * v
+	}
+	return sum / float64(len(samples))
+}
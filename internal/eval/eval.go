@@ -0,0 +1,338 @@
+// Package eval measures identification accuracy. Reference tracks are fingerprinted
+// into an in-memory catalog, then clips cut from them are degraded (noise, filtering,
+// gain, misaligned starts) and identified. Per scenario it reports precision, recall,
+// top-1 accuracy and latency percentiles.
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/youpy/go-wav"
+)
+
+// Track is a reference recording, as WAV file bytes
+type Track struct {
+	Name string
+	Data []byte
+}
+
+// Scenario is a named degradation applied to every query clip
+type Scenario struct {
+	Name string `json:"name"`
+	Degradation
+}
+
+type Config struct {
+	ClipLength      float64    `json:"clip_s"`            // Query length in seconds
+	QueriesPerTrack int        `json:"queries_per_track"` // Clips cut from each track, per scenario
+	Seed            int64      `json:"seed"`
+	Threshold       float64    `json:"threshold"` // Confidence the top match needs to count as reported
+	MinScore        int        `json:"min_score"` // Aligned hashes the top match needs to count as reported
+	Holdout         int        `json:"holdout"`   // Tracks queried but left out of the catalog
+	Scenarios       []Scenario `json:"scenarios"`
+}
+
+// DefaultConfig uses the same reporting thresholds as live identification
+func DefaultConfig() Config {
+	defaults := services.DefaultStreamOptions()
+	return Config{
+		ClipLength:      5,
+		QueriesPerTrack: 3,
+		Seed:            1,
+		Threshold:       defaults.Threshold,
+		MinScore:        defaults.MinScore,
+		Scenarios:       DefaultScenarios(),
+	}
+}
+
+func DefaultScenarios() []Scenario {
+	return []Scenario{
+		{Name: "clean"},
+		{Name: "white-10db", Degradation: Degradation{Noise: "white", SNR: 10}},
+		{Name: "pink-5db", Degradation: Degradation{Noise: "pink", SNR: 5}},
+		{Name: "lowpass-4khz", Degradation: Degradation{LowPass: 4000}},
+		{Name: "mp3-like", Degradation: Degradation{BandLimit: 11000}},
+		{Name: "quiet", Degradation: Degradation{Gain: -12}},
+		{Name: "jitter", Degradation: Degradation{Jitter: 0.5}},
+	}
+}
+
+func (c Config) validate(tracks int) error {
+	if c.ClipLength <= 0 {
+		return errors.New("clip length must be positive")
+	}
+	if c.QueriesPerTrack < 1 {
+		return errors.New("need at least one query per track")
+	}
+	if c.Holdout < 0 || c.Holdout >= tracks {
+		return fmt.Errorf("holdout must leave at least one of %d tracks in the catalog", tracks)
+	}
+	if len(c.Scenarios) == 0 {
+		return errors.New("no scenarios")
+	}
+	for _, scenario := range c.Scenarios {
+		if err := scenario.validate(); err != nil {
+			return fmt.Errorf("scenario %q: %w", scenario.Name, err)
+		}
+	}
+	return nil
+}
+
+type Report struct {
+	Config     Config   `json:"config"`
+	References []string `json:"references"`
+	Holdout    []string `json:"holdout,omitempty"`
+	Results    []Result `json:"results"`
+}
+
+type Result struct {
+	Scenario       string      `json:"scenario"`
+	Degradation    Degradation `json:"degradation"`
+	Queries        int         `json:"queries"`
+	TruePositives  int         `json:"true_positives"`  // Reported the right song
+	FalsePositives int         `json:"false_positives"` // Reported a wrong song, or any song for a holdout clip
+	FalseNegatives int         `json:"false_negatives"` // Reported nothing for a catalogued song
+	Errors         int         `json:"errors"`
+	Precision      float64     `json:"precision"`
+	Recall         float64     `json:"recall"`
+	Top1           float64     `json:"top1_accuracy"` // Best candidate is right, ignoring the thresholds
+	Latency        Latency     `json:"latency_ms"`
+}
+
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// reference is a decoded track, mono at its own sample rate
+type reference struct {
+	name       string
+	data       []byte
+	songID     string // Empty for holdout tracks
+	samples    []float64
+	sampleRate int
+}
+
+// Run builds a catalog from tracks and identifies degraded clips of them for each scenario.
+// Tracks are shuffled with the seed before the holdout is taken, so a run is reproducible.
+func Run(ctx context.Context, tracks []Track, cfg Config) (*Report, error) {
+	if err := cfg.validate(len(tracks)); err != nil {
+		return nil, err
+	}
+
+	refs := make([]*reference, 0, len(tracks))
+	for _, track := range tracks {
+		samples, sampleRate, err := decode(track.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", track.Name, err)
+		}
+		refs = append(refs, &reference{name: track.Name, data: track.Data, samples: samples, sampleRate: sampleRate})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].name < refs[j].name })
+	rand.New(rand.NewSource(cfg.Seed)).Shuffle(len(refs), func(i, j int) { refs[i], refs[j] = refs[j], refs[i] })
+
+	// Every reference is catalogued, however close it sounds to another
+	songs, fingerprints := repo.NewMemorySongRepo(), repo.NewMemoryFingerprintRepo()
+	musicService := services.NewMusicService(nil, songs, repo.NewMemoryUnitOfWork(songs, fingerprints),
+		services.NewAudioService(), services.NewFingerprintService(fingerprints), services.DuplicatePolicy{})
+
+	report := &Report{Config: cfg}
+	catalogued := len(refs) - cfg.Holdout
+	for i, ref := range refs {
+		if i >= catalogued {
+			report.Holdout = append(report.Holdout, ref.name)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		song, err := musicService.HandleUpload(ctx, catalogSong(ref.name), ref.data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ref.name, err)
+		}
+		ref.songID = song.ID
+		report.References = append(report.References, ref.name)
+	}
+
+	for i, scenario := range cfg.Scenarios {
+		// Same clip positions for every scenario, so results are comparable
+		positions := rand.New(rand.NewSource(cfg.Seed))
+		noise := rand.New(rand.NewSource(cfg.Seed + int64(i) + 1))
+
+		result, err := runScenario(ctx, musicService, refs, cfg, scenario, positions, noise)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+func runScenario(ctx context.Context, musicService services.MusicServiceInterface, refs []*reference, cfg Config, scenario Scenario, positions, noise *rand.Rand) (Result, error) {
+	result := Result{Scenario: scenario.Name, Degradation: scenario.Degradation}
+	var latencies []time.Duration
+	known, top1 := 0, 0
+
+	for _, ref := range refs {
+		for q := 0; q < cfg.QueriesPerTrack; q++ {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+
+			clip := cutClip(ref, cfg.ClipLength, scenario.Jitter, positions)
+			clip = scenario.Apply(clip, ref.sampleRate, noise)
+			data := services.EncodePCM16(toPCM16(clip), uint32(ref.sampleRate), 1)
+
+			started := time.Now()
+			matches, err := musicService.Identify(ctx, data)
+			latencies = append(latencies, time.Since(started))
+			result.Queries++
+			if ref.songID != "" {
+				known++
+			}
+
+			if err != nil {
+				result.Errors++
+				if ref.songID != "" {
+					result.FalseNegatives++
+				}
+				continue
+			}
+
+			var best *services.Match
+			if len(matches) > 0 {
+				best = &matches[0]
+			}
+			if best != nil && ref.songID != "" && best.SongID == ref.songID {
+				top1++
+			}
+
+			reported := best != nil && best.Confidence >= cfg.Threshold && best.Score >= cfg.MinScore
+			switch {
+			case reported && best.SongID == ref.songID:
+				result.TruePositives++
+			case reported:
+				result.FalsePositives++
+			case ref.songID != "":
+				result.FalseNegatives++
+			}
+		}
+	}
+
+	result.Precision = ratio(result.TruePositives, result.TruePositives+result.FalsePositives)
+	result.Recall = ratio(result.TruePositives, known)
+	result.Top1 = ratio(top1, known)
+	result.Latency = percentiles(latencies)
+	return result, nil
+}
+
+// cutClip picks a random start aligned to the analysis hop, then moves it by up to
+// jitter seconds either way so frames no longer line up with the reference
+func cutClip(ref *reference, length, jitter float64, rng *rand.Rand) []float64 {
+	size := int(length * float64(ref.sampleRate))
+	if size >= len(ref.samples) {
+		return ref.samples
+	}
+
+	hop := services.SpectrogramHop * ref.sampleRate / services.TargetSampleRate
+	if hop < 1 {
+		hop = 1
+	}
+	start := rng.Intn((len(ref.samples)-size)/hop+1) * hop
+
+	if jitter > 0 {
+		start += int((rng.Float64()*2 - 1) * jitter * float64(ref.sampleRate))
+		start = max(0, min(start, len(ref.samples)-size))
+	}
+
+	return ref.samples[start : start+size]
+}
+
+// decode reads a WAV file into mono samples in [-1, 1]
+func decode(data []byte) ([]float64, int, error) {
+	reader := wav.NewReader(bytes.NewReader(data))
+	format, err := reader.Format()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading wav format: %w", err)
+	}
+
+	channels := int(format.NumChannels)
+	if channels > 2 {
+		channels = 2
+	}
+	scale := math.Pow(2, float64(format.BitsPerSample-1))
+
+	var samples []float64
+	for {
+		batch, err := reader.ReadSamples()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading wav samples: %w", err)
+		}
+		for _, sample := range batch {
+			sum := 0
+			for ch := 0; ch < channels; ch++ {
+				sum += reader.IntValue(sample, uint(ch))
+			}
+			samples = append(samples, float64(sum)/float64(channels)/scale)
+		}
+	}
+
+	if len(samples) == 0 {
+		return nil, 0, errors.New("no audio samples")
+	}
+	return samples, int(format.SampleRate), nil
+}
+
+func toPCM16(samples []float64) []int16 {
+	out := make([]int16, len(samples))
+	for i, v := range samples {
+		out[i] = int16(math.Round(v * math.MaxInt16))
+	}
+	return out
+}
+
+// percentiles uses the nearest rank method
+func percentiles(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	at := func(p float64) float64 {
+		rank := int(math.Ceil(p/100*float64(len(latencies)))) - 1
+		rank = max(0, min(rank, len(latencies)-1))
+		return float64(latencies[rank].Microseconds()) / 1000
+	}
+
+	return Latency{P50: at(50), P90: at(90), P95: at(95), P99: at(99), Max: at(100)}
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// catalogSong fills in what song validation requires; only the ID matters to the harness
+func catalogSong(name string) models.Song {
+	return models.Song{Title: name, Artist: "eval", Year: time.Now().Year(), S3Key: "eval/" + name}
+}
@@ -0,0 +1,92 @@
+package eval
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/owenhochwald/harmonia/internal/testaudio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDegradation_NoiseSNR(t *testing.T) {
+	clean := testaudio.Melody(16000, 2, 1)
+
+	for _, kind := range []string{"white", "pink"} {
+		noisy := Degradation{Noise: kind, SNR: 10}.Apply(clean, 16000, rand.New(rand.NewSource(1)))
+
+		noise := make([]float64, len(clean))
+		for i := range noise {
+			noise[i] = noisy[i] - clean[i]
+		}
+		snr := 10 * math.Log10(power(clean)/power(noise))
+		assert.InDelta(t, 10, snr, 0.5, kind)
+	}
+}
+
+func TestDegradation_LowPass(t *testing.T) {
+	sampleRate := 16000
+	tone := func(freq float64) []float64 { return testaudio.Sine(sampleRate, 1, freq, 0.5) }
+
+	d := Degradation{LowPass: 1000}
+	low := d.Apply(tone(200), sampleRate, nil)
+	high := d.Apply(tone(6000), sampleRate, nil)
+
+	assert.InDelta(t, power(tone(200)), power(low), 0.01, "passband is kept")
+	assert.Less(t, power(high), power(tone(6000))/100, "6kHz is at least 20dB down")
+}
+
+func TestRun(t *testing.T) {
+	var tracks []Track
+	for i := int64(1); i <= 4; i++ {
+		samples := testaudio.Melody(16000, 12, i)
+		tracks = append(tracks, Track{
+			Name: string(rune('a' + i - 1)),
+			Data: testaudio.WAV(t, testaudio.Mono16k, samples),
+		})
+	}
+
+	cfg := DefaultConfig()
+	cfg.QueriesPerTrack = 2
+	cfg.Holdout = 1
+	cfg.Scenarios = []Scenario{
+		{Name: "clean"},
+		{Name: "white-10db", Degradation: Degradation{Noise: "white", SNR: 10}},
+	}
+
+	report, err := Run(context.Background(), tracks, cfg)
+	require.NoError(t, err)
+	assert.Len(t, report.References, 3)
+	assert.Len(t, report.Holdout, 1)
+	require.Len(t, report.Results, 2)
+
+	for _, result := range report.Results {
+		assert.Equal(t, 8, result.Queries, result.Scenario)
+		assert.Zero(t, result.Errors, result.Scenario)
+		assert.Equal(t, 1.0, result.Top1, result.Scenario)
+		assert.Equal(t, 1.0, result.Recall, result.Scenario)
+		assert.Equal(t, 1.0, result.Precision, result.Scenario, "holdout clips are not reported")
+		assert.Positive(t, result.Latency.Max)
+		assert.LessOrEqual(t, result.Latency.P50, result.Latency.Max)
+	}
+
+	again, err := Run(context.Background(), tracks, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, report.Holdout, again.Holdout, "same seed, same split")
+}
+
+func TestRun_RejectsBadConfig(t *testing.T) {
+	tracks := []Track{{Name: "a", Data: testaudio.WAV(t, testaudio.Mono16k, testaudio.Melody(16000, 2, 1))}}
+
+	cfg := DefaultConfig()
+	cfg.Holdout = 1
+	_, err := Run(context.Background(), tracks, cfg)
+	assert.Error(t, err, "holdout takes every track")
+
+	cfg = DefaultConfig()
+	cfg.Scenarios = []Scenario{{Name: "bad", Degradation: Degradation{Noise: "brown"}}}
+	_, err = Run(context.Background(), tracks, cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+// Package metrics holds the Prometheus collectors exposed on /metrics. Collectors
+// live on their own registry so tests and tools can build several applications
+// in one process without clashing with the default registry.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "harmonia"
+
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	StageDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "stage_duration_seconds",
+		Help:      "Time spent in each audio pipeline stage, for uploads and identification alike.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14), // 1ms to ~8s
+	}, []string{"stage"})
+
+	FingerprintsPerUpload = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "ingest",
+		Name:      "fingerprints_per_upload",
+		Help:      "Fingerprints generated for each ingested song.",
+		Buckets:   prometheus.ExponentialBuckets(100, 2, 12), // 100 to ~200k
+	})
+
+	HashLookups = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fingerprint_repo",
+		Name:      "lookups_total",
+		Help:      "Hash lookups run against the fingerprint repo.",
+	})
+
+	HashesLookedUp = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fingerprint_repo",
+		Name:      "hashes_total",
+		Help:      "Hashes queried across all lookups.",
+	})
+
+	HashLookupDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "fingerprint_repo",
+		Name:      "lookup_duration_seconds",
+		Help:      "Latency of hash lookups, including reading the rows.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	IdentifyResults = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "identify",
+		Name:      "requests_total",
+		Help:      "Identification requests by source (upload or stream) and result (hit or miss).",
+	}, []string{"source", "result"})
+
+	RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Requests refused with 429 by scope and limit (key, ip or quota).",
+	}, []string{"scope", "limit"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports the connection pool stats of db, replacing a pool registered earlier
+func RegisterDB(db *sql.DB) error {
+	collector := collectors.NewDBStatsCollector(db, namespace)
+	err := Registry.Register(collector)
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		Registry.Unregister(registered.ExistingCollector)
+		err = Registry.Register(collector)
+	}
+	return err
+}
+
+// ObserveHashLookup records one lookup of hashes started at started
+func ObserveHashLookup(hashes int, started time.Time) {
+	HashLookups.Inc()
+	HashesLookedUp.Add(float64(hashes))
+	HashLookupDuration.Observe(time.Since(started).Seconds())
+}
+
+// ObserveIdentify records whether an identification reported a match
+func ObserveIdentify(source string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	IdentifyResults.WithLabelValues(source, result).Inc()
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/jobs/:id", func(c *gin.Context) { c.Status(http.StatusAccepted) })
+	r.GET("/metrics", gin.WrapH(Handler()))
+
+	before := testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/api/jobs/:id", "202"))
+	for _, path := range []string{"/api/jobs/1", "/api/jobs/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, before+2, testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "/api/jobs/:id", "202")),
+		"requests are labelled by route pattern")
+	assert.Equal(t, 1.0, testutil.ToFloat64(HTTPRequests.WithLabelValues("GET", "unmatched", "404")))
+
+	ObserveHashLookup(120, time.Now())
+	ObserveIdentify("upload", true)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body := recorder.Body.String()
+	for _, series := range []string{
+		`harmonia_http_request_duration_seconds_count{method="GET",route="/api/jobs/:id"} 2`,
+		`harmonia_fingerprint_repo_hashes_total 120`,
+		`harmonia_identify_requests_total{result="hit",source="upload"} 1`,
+		`go_goroutines`,
+	} {
+		assert.True(t, strings.Contains(body, series), "missing %s", series)
+	}
+}
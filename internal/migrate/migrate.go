@@ -0,0 +1,71 @@
+// Package migrate applies the embedded migrations with goose. Every run holds a
+// Postgres advisory lock, so replicas starting together migrate one at a time
+// and the others wait, then find nothing pending.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+
+	"github.com/owenhochwald/harmonia/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// New returns a goose provider for the embedded migrations
+func New(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("error creating migration lock: %w", err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations.FS, goose.WithSessionLocker(locker))
+	if err != nil {
+		return nil, fmt.Errorf("error loading migrations: %w", err)
+	}
+	return provider, nil
+}
+
+// Up applies every pending migration and returns the ones it ran
+func Up(ctx context.Context, db *sql.DB) ([]*goose.MigrationResult, error) {
+	provider, err := New(db)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := provider.Up(ctx)
+	if err != nil {
+		return results, fmt.Errorf("error applying migrations: %w", err)
+	}
+	return results, nil
+}
+
+// Latest returns the version of the newest embedded migration, the version a
+// database should be at for this build
+func Latest() (int64, error) {
+	names, err := fs.Glob(migrations.FS, "*.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, name := range names {
+		version, err := goose.NumericComponent(name)
+		if err != nil {
+			return 0, fmt.Errorf("error reading migration version of %s: %w", name, err)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// Version returns the latest migration applied to the database, 0 for none
+func Version(ctx context.Context, db *sql.DB) (int64, error) {
+	provider, err := New(db)
+	if err != nil {
+		return 0, err
+	}
+	return provider.GetDBVersion(ctx)
+}
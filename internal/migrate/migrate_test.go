@@ -0,0 +1,40 @@
+package migrate
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_LoadsEmbeddedMigrations(t *testing.T) {
+	// sql.Open doesn't connect, loading the sources needs no database
+	db, err := sql.Open("postgres", "host=localhost dbname=unused sslmode=disable")
+	require.NoError(t, err)
+	defer db.Close()
+
+	provider, err := New(db)
+	require.NoError(t, err)
+
+	sources := provider.ListSources()
+	require.NotEmpty(t, sources)
+	for i, source := range sources {
+		assert.Equal(t, int64(i+1), source.Version, "versions have no gaps: %s", source.Path)
+	}
+}
+
+func TestLatest_MatchesNewestSource(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost dbname=unused sslmode=disable")
+	require.NoError(t, err)
+	defer db.Close()
+
+	provider, err := New(db)
+	require.NoError(t, err)
+	sources := provider.ListSources()
+
+	latest, err := Latest()
+	require.NoError(t, err)
+	assert.Equal(t, sources[len(sources)-1].Version, latest)
+}
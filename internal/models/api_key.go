@@ -0,0 +1,48 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Scope is a permission granted to an API key
+type Scope string
+
+const (
+	ScopeIdentify Scope = "identify" // Identify clips and read the catalog
+	ScopeIngest   Scope = "ingest"   // Upload songs and follow their jobs
+	ScopeAdmin    Scope = "admin"    // Everything, including debugging endpoints
+)
+
+var Scopes = []Scope{ScopeIdentify, ScopeIngest, ScopeAdmin}
+
+func ParseScope(s string) (Scope, error) {
+	scope := Scope(s)
+	if !slices.Contains(Scopes, scope) {
+		return "", Errorf(ErrValidation, "unknown scope %q, use identify, ingest or admin", s)
+	}
+	return scope, nil
+}
+
+// APIKey is a client credential. Only the SHA-256 of the key is stored; the
+// prefix is kept in the clear so keys can be told apart when listed.
+type APIKey struct {
+	ID           string     `json:"id" db:"id"`
+	Name         string     `json:"name" db:"name"`
+	Prefix       string     `json:"prefix" db:"prefix"`
+	Hash         string     `json:"-" db:"key_hash"`
+	Scopes       []Scope    `json:"scopes" db:"scopes"`
+	TenantID     string     `json:"tenant_id" db:"tenant_id"`         // Catalog the key reads and writes
+	SearchGlobal bool       `json:"search_global" db:"search_global"` // Also search the shared global catalog
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// Allows reports whether the key grants scope. Admin keys are allowed everything.
+func (k APIKey) Allows(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
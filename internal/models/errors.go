@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of domain errors, shared by the repos and services so the API can map
+// them to status codes with errors.Is
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrValidation        = errors.New("invalid input")
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	ErrTooLarge          = errors.New("too large")
+	ErrDuplicate         = errors.New("already exists")
+)
+
+// kindError keeps its own message but matches its kind with errors.Is, along
+// with anything wrapped with %w
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// Errorf formats an error of the given kind, such as ErrValidation
+func Errorf(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
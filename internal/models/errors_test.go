@@ -0,0 +1,19 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorf(t *testing.T) {
+	cause := errors.New("unexpected EOF")
+	err := fmt.Errorf("error saving song: %w", Errorf(ErrValidation, "bad header: %w", cause))
+
+	assert.Equal(t, "error saving song: bad header: unexpected EOF", err.Error(), "the kind doesn't change the message")
+	assert.ErrorIs(t, err, ErrValidation)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
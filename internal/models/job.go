@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job tracks an asynchronous ingest of an uploaded audio file
+type Job struct {
+	ID          string    `json:"id" db:"id"`
+	Status      JobStatus `json:"status" db:"status"`
+	Title       string    `json:"title" db:"title"`
+	Artist      string    `json:"artist" db:"artist"`
+	Album       string    `json:"album" db:"album"`
+	Year        int       `json:"year" db:"year"`
+	S3Key       string    `json:"s3_key" db:"s3_key"`
+	SongID      string    `json:"song_id,omitempty" db:"song_id"`           // Set once the job succeeds
+	Error       string    `json:"error,omitempty" db:"error"`               // Set once the job fails
+	DuplicateOf string    `json:"duplicate_of,omitempty" db:"duplicate_of"` // Catalog song the upload duplicates, whether rejected or flagged
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`                 // Catalog the song is ingested into
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Song builds the song metadata the job will persist
+func (j Job) Song() Song {
+	return Song{
+		Title:  j.Title,
+		Artist: j.Artist,
+		Album:  j.Album,
+		Year:   j.Year,
+		S3Key:  j.S3Key,
+	}
+}
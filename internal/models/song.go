@@ -10,5 +10,9 @@ type Song struct {
 	Year        int       `json:"year" db:"year"`
 	S3Key       string    `json:"s3_key" db:"s3_key"`
 	Fingerprint []byte    `json:"fingerprint" db:"fingerprint"`
+	ContentHash string    `json:"content_hash,omitempty" db:"content_hash"` // SHA-256 of the ingested file
+	PCMHash     string    `json:"pcm_hash,omitempty" db:"pcm_hash"`         // SHA-256 of the decoded audio
+	DuplicateOf string    `json:"duplicate_of,omitempty" db:"duplicate_of"` // Song this one was flagged as a near-duplicate of
+	TenantID    string    `json:"tenant_id,omitempty" db:"tenant_id"`       // Catalog the song belongs to, taken from the context on save
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
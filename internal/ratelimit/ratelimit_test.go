@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(rate, burst)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	l, now := newTestLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("client")
+		assert.True(t, ok, "burst request %d", i)
+	}
+
+	ok, wait := l.Allow("client")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = l.Allow("other")
+	assert.True(t, ok, "keys have their own buckets")
+
+	*now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("client")
+	assert.True(t, ok, "one token refilled")
+	ok, _ = l.Allow("client")
+	assert.False(t, ok)
+
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("client")
+		assert.True(t, ok, "refills up to the burst only")
+	}
+	ok, _ = l.Allow("client")
+	assert.False(t, ok)
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l, _ := newTestLimiter(0, 1)
+	for i := 0; i < 100; i++ {
+		ok, _ := l.Allow("client")
+		assert.True(t, ok)
+	}
+
+	var nilLimiter *Limiter
+	ok, _ := nilLimiter.Allow("client")
+	assert.True(t, ok)
+}
+
+func TestLimiter_SweepsIdleBuckets(t *testing.T) {
+	l, now := newTestLimiter(1, 1)
+	l.Allow("a")
+	l.Allow("b")
+	assert.Len(t, l.buckets, 2)
+
+	*now = now.Add(2 * sweepInterval)
+	l.Allow("c")
+	assert.Len(t, l.buckets, 1)
+}
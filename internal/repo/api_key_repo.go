@@ -0,0 +1,208 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+)
+
+type apiKeyRepoSQL struct {
+	DB DBTX
+	options
+}
+
+func NewAPIKeyRepo(db *sql.DB, opts ...Option) APIKeyRepo {
+	return &apiKeyRepoSQL{DB: db, options: newOptions(opts)}
+}
+
+func (a *apiKeyRepoSQL) SaveKey(ctx context.Context, key models.APIKey) (err error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.SaveKey")
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateAPIKey(key); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO api_keys (id, name, prefix, key_hash, scopes, tenant_id, search_global, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	_, err = a.DB.ExecContext(ctx, query,
+		key.ID,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		pq.Array(scopeStrings(key.Scopes)),
+		key.TenantID,
+		key.SearchGlobal,
+		key.CreatedAt,
+	)
+
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	return nil
+}
+
+// FindByHash returns the key with the given hash, revoked or not
+func (a *apiKeyRepoSQL) FindByHash(ctx context.Context, hash string) (key *models.APIKey, err error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.FindByHash")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT id, name, prefix, key_hash, scopes, tenant_id, search_global, created_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = $1
+		`
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	key, err = scanAPIKey(a.DB.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ListKeys returns every key, oldest first
+func (a *apiKeyRepoSQL) ListKeys(ctx context.Context) (keys []models.APIKey, err error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.ListKeys")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT id, name, prefix, key_hash, scopes, tenant_id, search_global, created_at, revoked_at
+		FROM api_keys
+		ORDER BY created_at
+		`
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := a.DB.QueryContext(ctx, query)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			logger.FromContext(ctx).Error().Err(err).Msg("database error")
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeKey marks a key revoked. Revoking an unknown or already revoked key is an error.
+func (a *apiKeyRepoSQL) RevokeKey(ctx context.Context, id string, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.RevokeKey")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		UPDATE api_keys
+		SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+		`
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	result, err := a.DB.ExecContext(ctx, query, id, at)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.Errorf(models.ErrNotFound, "active API key %s not found", id)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes []string
+	var revokedAt sql.NullTime
+
+	if err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		pq.Array(&scopes),
+		&key.TenantID,
+		&key.SearchGlobal,
+		&key.CreatedAt,
+		&revokedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, models.Scope(scope))
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return &key, nil
+}
+
+func validateAPIKey(key models.APIKey) error {
+	if strings.TrimSpace(key.ID) == "" {
+		return models.Errorf(models.ErrValidation, "API key ID is required")
+	}
+	if strings.TrimSpace(key.Name) == "" {
+		return models.Errorf(models.ErrValidation, "API key name is required")
+	}
+	if key.Hash == "" {
+		return models.Errorf(models.ErrValidation, "API key hash is required")
+	}
+	if len(key.Scopes) == 0 {
+		return models.Errorf(models.ErrValidation, "API key needs at least one scope")
+	}
+	if err := tenant.Validate(key.TenantID); err != nil {
+		return err
+	}
+	if key.CreatedAt.IsZero() {
+		return models.Errorf(models.ErrValidation, "created_at timestamp is required")
+	}
+	return nil
+}
+
+func scopeStrings(scopes []models.Scope) []string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return values
+}
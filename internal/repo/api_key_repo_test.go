@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAPIKey(id, hash string, scopes ...models.Scope) models.APIKey {
+	return models.APIKey{
+		ID:        id,
+		Name:      "test client",
+		Prefix:    "hmn_" + id,
+		Hash:      hash,
+		Scopes:    scopes,
+		TenantID:  "acme",
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func TestAPIKeyRepo_SaveKey(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewAPIKeyRepo(db)
+
+	tests := []struct {
+		name    string
+		key     models.APIKey
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:    "valid key",
+			key:     newTestAPIKey("key-1", "hash-1", models.ScopeIdentify),
+			wantErr: false,
+		},
+		{
+			name:    "missing scopes",
+			key:     newTestAPIKey("key-2", "hash-2"),
+			wantErr: true,
+			errMsg:  "at least one scope",
+		},
+		{
+			name:    "missing hash",
+			key:     newTestAPIKey("key-3", "", models.ScopeAdmin),
+			wantErr: true,
+			errMsg:  "hash is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ClearTestData(t, db)
+
+			err := repo.SaveKey(ctx, tt.key)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAPIKeyRepo_FindByHash(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	ClearTestData(t, db)
+
+	repo := NewAPIKeyRepo(db)
+	require.NoError(t, repo.SaveKey(ctx, newTestAPIKey("key-1", "hash-1", models.ScopeIdentify, models.ScopeIngest)))
+
+	key, err := repo.FindByHash(ctx, "hash-1")
+	require.NoError(t, err)
+	require.NotNil(t, key)
+	assert.Equal(t, "key-1", key.ID)
+	assert.Equal(t, []models.Scope{models.ScopeIdentify, models.ScopeIngest}, key.Scopes)
+	assert.False(t, key.Revoked())
+
+	missing, err := repo.FindByHash(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestAPIKeyRepo_RevokeKey(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	ClearTestData(t, db)
+
+	repo := NewAPIKeyRepo(db)
+	require.NoError(t, repo.SaveKey(ctx, newTestAPIKey("key-1", "hash-1", models.ScopeAdmin)))
+	require.NoError(t, repo.SaveKey(ctx, newTestAPIKey("key-2", "hash-2", models.ScopeIdentify)))
+
+	require.NoError(t, repo.RevokeKey(ctx, "key-1", time.Now().UTC()))
+	assert.Error(t, repo.RevokeKey(ctx, "key-1", time.Now().UTC()), "already revoked")
+	assert.Error(t, repo.RevokeKey(ctx, "missing", time.Now().UTC()))
+
+	keys, err := repo.ListKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.True(t, keys[0].Revoked())
+	assert.False(t, keys[1].Revoked())
+}
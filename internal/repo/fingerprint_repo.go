@@ -3,55 +3,122 @@ package repo
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"time"
 
+	"github.com/lib/pq"
+	"github.com/owenhochwald/harmonia/internal/metrics"
 	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const fingerprintBatchSize = 5000
+
 type fingerprintRepoSQL struct {
-	DB *sql.DB
+	DB DBTX
+	options
 }
 
-func NewFingerprintRepo(db *sql.DB) FingerprintRepo {
-	return &fingerprintRepoSQL{DB: db}
+func NewFingerprintRepo(db *sql.DB, opts ...Option) FingerprintRepo {
+	return &fingerprintRepoSQL{DB: db, options: newOptions(opts)}
 }
 
-func (f *fingerprintRepoSQL) SaveFingerprint(fingerprint models.Fingerprint) error {
+func (f *fingerprintRepoSQL) SaveFingerprint(ctx context.Context, fingerprint models.Fingerprint) (err error) {
+	ctx, span := startSpan(ctx, "FingerprintRepo.SaveFingerprint")
+	defer func() { tracing.End(span, err) }()
+
 	query := `
-		INSERT INTO fingerprints (song_id, hash, time_offset)
-		VALUES ($1, $2, $3)
+		INSERT INTO fingerprints (song_id, hash, time_offset, tenant_id)
+		VALUES ($1, $2, $3, $4)
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := f.withTimeout(ctx)
 	defer cancel()
 
-	_, err := f.DB.ExecContext(ctx, query,
+	_, err = f.DB.ExecContext(ctx, query,
 		fingerprint.SongID,
 		fingerprint.Hash,
 		fingerprint.TimeOffset,
+		tenant.From(ctx),
 	)
 
 	if err != nil {
-		fmt.Println("Database error:", err)
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
 		return err
 	}
 
 	return nil
 }
 
-func (f *fingerprintRepoSQL) FindByHash(hash string) (*models.Fingerprint, error) {
+// SaveFingerprints inserts fingerprints in batches. Outside a unit of work the
+// batches get a transaction of their own so a song is never half saved.
+func (f *fingerprintRepoSQL) SaveFingerprints(ctx context.Context, fingerprints []models.Fingerprint) (err error) {
+	ctx, span := startSpan(ctx, "FingerprintRepo.SaveFingerprints", attribute.Int("fingerprints", len(fingerprints)))
+	defer func() { tracing.End(span, err) }()
+
+	if len(fingerprints) == 0 {
+		return nil
+	}
+
+	ctx, cancel := f.withBulkTimeout(ctx)
+	defer cancel()
+
+	if db, ok := f.DB.(*sql.DB); ok {
+		return runInTx(ctx, db, func(tx *sql.Tx) error {
+			return insertFingerprints(ctx, tx, fingerprints)
+		})
+	}
+	return insertFingerprints(ctx, f.DB, fingerprints)
+}
+
+// insertFingerprints saves fingerprints to the catalog of the tenant in ctx
+func insertFingerprints(ctx context.Context, db DBTX, fingerprints []models.Fingerprint) error {
+	query := `
+		INSERT INTO fingerprints (song_id, hash, time_offset, tenant_id)
+		SELECT song_id, hash, time_offset, $4
+		FROM unnest($1::bigint[], $2::bigint[], $3::bigint[]) AS f(song_id, hash, time_offset)
+		`
+	tenantID := tenant.From(ctx)
+
+	for start := 0; start < len(fingerprints); start += fingerprintBatchSize {
+		end := min(start+fingerprintBatchSize, len(fingerprints))
+		batch := fingerprints[start:end]
+
+		songIDs := make([]int64, len(batch))
+		hashes := make([]int64, len(batch))
+		offsets := make([]int64, len(batch))
+		for i, fp := range batch {
+			songIDs[i] = fp.SongID
+			hashes[i] = int64(fp.Hash)
+			offsets[i] = int64(fp.TimeOffset)
+		}
+
+		if _, err := db.ExecContext(ctx, query, pq.Array(songIDs), pq.Array(hashes), pq.Array(offsets), tenantID); err != nil {
+			logger.FromContext(ctx).Error().Err(err).Msg("database error")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *fingerprintRepoSQL) FindByHash(ctx context.Context, hash string) (_ *models.Fingerprint, err error) {
+	ctx, span := startSpan(ctx, "FingerprintRepo.FindByHash")
+	defer func() { tracing.End(span, err) }()
+
 	query := `
 		SELECT id, song_id, hash, time_offset
 		FROM fingerprints
-		WHERE hash = $1
+		WHERE hash = $1 AND tenant_id = ANY($2)
 		LIMIT 1
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := f.withTimeout(ctx)
 	defer cancel()
 
 	var fingerprint models.Fingerprint
 
-	if err := f.DB.QueryRowContext(ctx, query, hash).Scan(
+	if err := f.DB.QueryRowContext(ctx, query, hash, pq.Array(tenant.Search(ctx))).Scan(
 		&fingerprint.ID,
 		&fingerprint.SongID,
 		&fingerprint.Hash,
@@ -60,25 +127,87 @@ func (f *fingerprintRepoSQL) FindByHash(hash string) (*models.Fingerprint, error
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		fmt.Println("Database error:", err)
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
 		return nil, err
 	}
 
 	return &fingerprint, nil
 }
 
-func (f *fingerprintRepoSQL) FindById(id int64) (*models.Fingerprint, error) {
+// FindByHashes returns every fingerprint matching one of the hashes in the
+// catalogs the tenant in ctx may search
+func (f *fingerprintRepoSQL) FindByHashes(ctx context.Context, hashes []uint32) (fingerprints []models.Fingerprint, err error) {
+	ctx, span := startSpan(ctx, "FingerprintRepo.FindByHashes", attribute.Int("hashes", len(hashes)))
+	defer func() {
+		span.SetAttributes(attribute.Int("rows", len(fingerprints)))
+		tracing.End(span, err)
+	}()
+
+	if len(hashes) == 0 {
+		return []models.Fingerprint{}, nil
+	}
+
+	query := `
+		SELECT id, song_id, hash, time_offset
+		FROM fingerprints
+		WHERE hash = ANY($1::bigint[]) AND tenant_id = ANY($2)
+		`
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+
+	values := make([]int64, len(hashes))
+	for i, hash := range hashes {
+		values[i] = int64(hash)
+	}
+
+	started := time.Now()
+	defer metrics.ObserveHashLookup(len(hashes), started)
+
+	rows, err := f.DB.QueryContext(ctx, query, pq.Array(values), pq.Array(tenant.Search(ctx)))
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints = []models.Fingerprint{}
+	for rows.Next() {
+		var fingerprint models.Fingerprint
+		if err := rows.Scan(
+			&fingerprint.ID,
+			&fingerprint.SongID,
+			&fingerprint.Hash,
+			&fingerprint.TimeOffset,
+		); err != nil {
+			logger.FromContext(ctx).Error().Err(err).Msg("database error")
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return fingerprints, nil
+}
+
+func (f *fingerprintRepoSQL) FindById(ctx context.Context, id int64) (_ *models.Fingerprint, err error) {
+	ctx, span := startSpan(ctx, "FingerprintRepo.FindById")
+	defer func() { tracing.End(span, err) }()
+
 	query := `
 		SELECT id, song_id, hash, time_offset
 		FROM fingerprints
-		WHERE id = $1
+		WHERE id = $1 AND tenant_id = ANY($2)
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := f.withTimeout(ctx)
 	defer cancel()
 
 	var fingerprint models.Fingerprint
 
-	if err := f.DB.QueryRowContext(ctx, query, id).Scan(
+	if err := f.DB.QueryRowContext(ctx, query, id, pq.Array(tenant.Search(ctx))).Scan(
 		&fingerprint.ID,
 		&fingerprint.SongID,
 		&fingerprint.Hash,
@@ -87,26 +216,29 @@ func (f *fingerprintRepoSQL) FindById(id int64) (*models.Fingerprint, error) {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		fmt.Println("Database error:", err)
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
 		return nil, err
 	}
 
 	return &fingerprint, nil
 }
 
-func (f *fingerprintRepoSQL) FindBySongId(songId string) (*models.Fingerprint, error) {
+func (f *fingerprintRepoSQL) FindBySongId(ctx context.Context, songId string) (_ *models.Fingerprint, err error) {
+	ctx, span := startSpan(ctx, "FingerprintRepo.FindBySongId", attribute.String("song.id", songId))
+	defer func() { tracing.End(span, err) }()
+
 	query := `
 		SELECT id, song_id, hash, time_offset
 		FROM fingerprints
-		WHERE song_id = $1
+		WHERE song_id = $1 AND tenant_id = ANY($2)
 		LIMIT 1
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := f.withTimeout(ctx)
 	defer cancel()
 
 	var fingerprint models.Fingerprint
 
-	if err := f.DB.QueryRowContext(ctx, query, songId).Scan(
+	if err := f.DB.QueryRowContext(ctx, query, songId, pq.Array(tenant.Search(ctx))).Scan(
 		&fingerprint.ID,
 		&fingerprint.SongID,
 		&fingerprint.Hash,
@@ -115,9 +247,53 @@ func (f *fingerprintRepoSQL) FindBySongId(songId string) (*models.Fingerprint, e
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		fmt.Println("Database error:", err)
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
 		return nil, err
 	}
 
 	return &fingerprint, nil
 }
+
+// FindAllBySongId returns every fingerprint of a song ordered by time offset
+func (f *fingerprintRepoSQL) FindAllBySongId(ctx context.Context, songId string) (fingerprints []models.Fingerprint, err error) {
+	ctx, span := startSpan(ctx, "FingerprintRepo.FindAllBySongId", attribute.String("song.id", songId))
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT id, song_id, hash, time_offset
+		FROM fingerprints
+		WHERE song_id = $1 AND tenant_id = ANY($2)
+		ORDER BY time_offset, hash
+		`
+	ctx, cancel := f.withBulkTimeout(ctx)
+	defer cancel()
+
+	rows, err := f.DB.QueryContext(ctx, query, songId, pq.Array(tenant.Search(ctx)))
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints = []models.Fingerprint{}
+	for rows.Next() {
+		var fingerprint models.Fingerprint
+		if err := rows.Scan(
+			&fingerprint.ID,
+			&fingerprint.SongID,
+			&fingerprint.Hash,
+			&fingerprint.TimeOffset,
+		); err != nil {
+			logger.FromContext(ctx).Error().Err(err).Msg("database error")
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return fingerprints, nil
+}
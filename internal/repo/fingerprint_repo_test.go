@@ -26,7 +26,7 @@ func TestFingerprintRepo_SaveFingerprint(t *testing.T) {
 		S3Key:     "songs/test-song.mp3",
 		CreatedAt: time.Now(),
 	}
-	err := songRepo.SaveSong(testSong)
+	err := songRepo.SaveSong(ctx, testSong)
 	require.NoError(t, err)
 
 	tests := []struct {
@@ -56,7 +56,7 @@ func TestFingerprintRepo_SaveFingerprint(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := fingerprintRepo.SaveFingerprint(tt.fingerprint)
+			err := fingerprintRepo.SaveFingerprint(ctx, tt.fingerprint)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -83,7 +83,7 @@ func TestFingerprintRepo_FindById(t *testing.T) {
 		S3Key:     "songs/test-song.mp3",
 		CreatedAt: time.Now(),
 	}
-	err := songRepo.SaveSong(testSong)
+	err := songRepo.SaveSong(ctx, testSong)
 	require.NoError(t, err)
 
 	// Setup test fingerprint
@@ -93,11 +93,11 @@ func TestFingerprintRepo_FindById(t *testing.T) {
 		TimeOffset: 1000,
 	}
 
-	err = fingerprintRepo.SaveFingerprint(testFingerprint)
+	err = fingerprintRepo.SaveFingerprint(ctx, testFingerprint)
 	require.NoError(t, err)
 
 	// Get the saved fingerprint to get its ID
-	savedFingerprint, err := fingerprintRepo.FindByHash("12345")
+	savedFingerprint, err := fingerprintRepo.FindByHash(ctx, "12345")
 	require.NoError(t, err)
 	require.NotNil(t, savedFingerprint)
 
@@ -123,7 +123,7 @@ func TestFingerprintRepo_FindById(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := fingerprintRepo.FindById(tt.id)
+			result, err := fingerprintRepo.FindById(ctx, tt.id)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -160,7 +160,7 @@ func TestFingerprintRepo_FindByHash(t *testing.T) {
 		S3Key:     "songs/test-song.mp3",
 		CreatedAt: time.Now(),
 	}
-	err := songRepo.SaveSong(testSong)
+	err := songRepo.SaveSong(ctx, testSong)
 	require.NoError(t, err)
 
 	// Setup test fingerprints
@@ -176,10 +176,10 @@ func TestFingerprintRepo_FindByHash(t *testing.T) {
 		TimeOffset: 2000,
 	}
 
-	err = fingerprintRepo.SaveFingerprint(fingerprint1)
+	err = fingerprintRepo.SaveFingerprint(ctx, fingerprint1)
 	require.NoError(t, err)
 
-	err = fingerprintRepo.SaveFingerprint(fingerprint2)
+	err = fingerprintRepo.SaveFingerprint(ctx, fingerprint2)
 	require.NoError(t, err)
 
 	tests := []struct {
@@ -213,7 +213,7 @@ func TestFingerprintRepo_FindByHash(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := fingerprintRepo.FindByHash(tt.hash)
+			result, err := fingerprintRepo.FindByHash(ctx, tt.hash)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -258,10 +258,10 @@ func TestFingerprintRepo_FindBySongId(t *testing.T) {
 		CreatedAt: time.Now(),
 	}
 
-	err := songRepo.SaveSong(testSong1)
+	err := songRepo.SaveSong(ctx, testSong1)
 	require.NoError(t, err)
 
-	err = songRepo.SaveSong(testSong2)
+	err = songRepo.SaveSong(ctx, testSong2)
 	require.NoError(t, err)
 
 	// Setup test fingerprints for each song
@@ -277,10 +277,10 @@ func TestFingerprintRepo_FindBySongId(t *testing.T) {
 		TimeOffset: 2000,
 	}
 
-	err = fingerprintRepo.SaveFingerprint(fingerprint1)
+	err = fingerprintRepo.SaveFingerprint(ctx, fingerprint1)
 	require.NoError(t, err)
 
-	err = fingerprintRepo.SaveFingerprint(fingerprint2)
+	err = fingerprintRepo.SaveFingerprint(ctx, fingerprint2)
 	require.NoError(t, err)
 
 	tests := []struct {
@@ -314,7 +314,7 @@ func TestFingerprintRepo_FindBySongId(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := fingerprintRepo.FindBySongId(tt.songId)
+			result, err := fingerprintRepo.FindBySongId(ctx, tt.songId)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -332,6 +332,44 @@ func TestFingerprintRepo_FindBySongId(t *testing.T) {
 	}
 }
 
+func TestFingerprintRepo_FindByHashes(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	songRepo := NewSongRepo(db)
+	fingerprintRepo := NewFingerprintRepo(db)
+
+	testSong := models.Song{
+		ID:        "321",
+		Title:     "Test Song",
+		Artist:    "Test Artist",
+		Year:      2023,
+		S3Key:     "songs/test-song.mp3",
+		CreatedAt: time.Now(),
+	}
+	require.NoError(t, songRepo.SaveSong(ctx, testSong))
+
+	err := fingerprintRepo.SaveFingerprints(ctx, []models.Fingerprint{
+		{SongID: 321, Hash: 111, TimeOffset: 1},
+		{SongID: 321, Hash: 222, TimeOffset: 2},
+		{SongID: 321, Hash: 222, TimeOffset: 9},
+		{SongID: 321, Hash: 333, TimeOffset: 3},
+	})
+	require.NoError(t, err)
+
+	results, err := fingerprintRepo.FindByHashes(ctx, []uint32{222, 333, 444})
+	require.NoError(t, err)
+	assert.Len(t, results, 3)
+	for _, fp := range results {
+		assert.Contains(t, []uint32{222, 333}, fp.Hash)
+		assert.Equal(t, int64(321), fp.SongID)
+	}
+
+	results, err = fingerprintRepo.FindByHashes(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
 func TestFingerprintRepo_Integration(t *testing.T) {
 	db := SetupTestDB(t)
 	defer CleanupTestDB(t, db)
@@ -351,7 +389,7 @@ func TestFingerprintRepo_Integration(t *testing.T) {
 	}
 
 	// 1. Save song
-	err := songRepo.SaveSong(testSong)
+	err := songRepo.SaveSong(ctx, testSong)
 	require.NoError(t, err)
 
 	// 2. Create multiple fingerprints for the song (using numeric song ID)
@@ -363,20 +401,20 @@ func TestFingerprintRepo_Integration(t *testing.T) {
 	}
 
 	for _, fp := range fingerprints {
-		err := fingerprintRepo.SaveFingerprint(fp)
+		err := fingerprintRepo.SaveFingerprint(ctx, fp)
 		require.NoError(t, err)
 	}
 
 	// 3. Test finding song by any fingerprint hash
 	for _, fp := range fingerprints {
 		// Find fingerprint by hash
-		foundFp, err := fingerprintRepo.FindByHash(strconv.Itoa(int(fp.Hash)))
+		foundFp, err := fingerprintRepo.FindByHash(ctx, strconv.Itoa(int(fp.Hash)))
 		require.NoError(t, err)
 		require.NotNil(t, foundFp)
 		assert.Equal(t, fp.Hash, foundFp.Hash)
 
 		// Find song by fingerprint hash
-		foundSong, err := songRepo.FindByFingerprint(strconv.Itoa(int(fp.Hash)))
+		foundSong, err := songRepo.FindByFingerprint(ctx, strconv.Itoa(int(fp.Hash)))
 		require.NoError(t, err)
 		require.NotNil(t, foundSong)
 		assert.Equal(t, testSong.ID, foundSong.ID)
@@ -384,7 +422,7 @@ func TestFingerprintRepo_Integration(t *testing.T) {
 	}
 
 	// 4. Test finding fingerprint by song ID
-	foundFp, err := fingerprintRepo.FindBySongId(testSong.ID)
+	foundFp, err := fingerprintRepo.FindBySongId(ctx, testSong.ID)
 	require.NoError(t, err)
 	require.NotNil(t, foundFp)
 	assert.Equal(t, songIDInt, foundFp.SongID)
@@ -0,0 +1,284 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type jobRepoSQL struct {
+	DB DBTX
+	options
+}
+
+func NewJobRepo(db *sql.DB, opts ...Option) JobRepo {
+	return &jobRepoSQL{DB: db, options: newOptions(opts)}
+}
+
+func (j *jobRepoSQL) SaveJob(ctx context.Context, job models.Job) (err error) {
+	ctx, span := startSpan(ctx, "JobRepo.SaveJob", attribute.String("job.id", job.ID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateJob(job); err != nil {
+		return err
+	}
+
+	if job.CreatedAt.IsZero() {
+		return models.Errorf(models.ErrValidation, "created_at timestamp is required")
+	}
+	if job.TenantID == "" {
+		job.TenantID = tenant.From(ctx)
+	}
+
+	query := `
+		INSERT INTO jobs (id, status, title, artist, album, year, s3_key, song_id, error, duplicate_of, created_at, updated_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		`
+	ctx, cancel := j.withTimeout(ctx)
+	defer cancel()
+
+	_, err = j.DB.ExecContext(ctx, query,
+		job.ID,
+		job.Status,
+		job.Title,
+		job.Artist,
+		job.Album,
+		job.Year,
+		job.S3Key,
+		nullString(job.SongID),
+		nullString(job.Error),
+		nullString(job.DuplicateOf),
+		job.CreatedAt,
+		job.UpdatedAt,
+		job.TenantID,
+	)
+
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	return nil
+}
+
+func (j *jobRepoSQL) UpdateJob(ctx context.Context, job models.Job) (err error) {
+	ctx, span := startSpan(ctx, "JobRepo.UpdateJob", attribute.String("job.id", job.ID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateJob(job); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE jobs
+		SET status = $2, song_id = $3, error = $4, duplicate_of = $5, updated_at = $6
+		WHERE id = $1
+		`
+	ctx, cancel := j.withTimeout(ctx)
+	defer cancel()
+
+	result, err := j.DB.ExecContext(ctx, query,
+		job.ID,
+		job.Status,
+		nullString(job.SongID),
+		nullString(job.Error),
+		nullString(job.DuplicateOf),
+		job.UpdatedAt,
+	)
+
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.Errorf(models.ErrNotFound, "job %s not found", job.ID)
+	}
+
+	return nil
+}
+
+func (j *jobRepoSQL) FindById(ctx context.Context, id string) (job *models.Job, err error) {
+	ctx, span := startSpan(ctx, "JobRepo.FindById", attribute.String("job.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT id, status, title, artist, album, year, s3_key, song_id, error, duplicate_of, created_at, updated_at, tenant_id
+		FROM jobs
+		WHERE id = $1
+		`
+	ctx, cancel := j.withTimeout(ctx)
+	defer cancel()
+
+	job, err = scanJob(j.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// FindByStatus returns jobs in any of the given statuses, oldest first
+func (j *jobRepoSQL) FindByStatus(ctx context.Context, statuses ...models.JobStatus) (jobs []models.Job, err error) {
+	ctx, span := startSpan(ctx, "JobRepo.FindByStatus")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT id, status, title, artist, album, year, s3_key, song_id, error, duplicate_of, created_at, updated_at, tenant_id
+		FROM jobs
+		WHERE status = ANY($1)
+		ORDER BY created_at
+		`
+	ctx, cancel := j.withTimeout(ctx)
+	defer cancel()
+
+	values := make([]string, len(statuses))
+	for i, status := range statuses {
+		values[i] = string(status)
+	}
+
+	rows, err := j.DB.QueryContext(ctx, query, pq.Array(values))
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			logger.FromContext(ctx).Error().Err(err).Msg("database error")
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ClaimJob takes a queued job, or a running one whose worker stopped renewing it,
+// in a single UPDATE so two workers can never both claim it. Times are compared in
+// the database, so replicas' clocks don't have to agree.
+func (j *jobRepoSQL) ClaimJob(ctx context.Context, id string, lease time.Duration) (job *models.Job, err error) {
+	ctx, span := startSpan(ctx, "JobRepo.ClaimJob", attribute.String("job.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		UPDATE jobs
+		SET status = $2, updated_at = now() AT TIME ZONE 'UTC'
+		WHERE id = $1 AND (
+			status = $3 OR
+			(status = $2 AND updated_at < now() AT TIME ZONE 'UTC' - make_interval(secs => $4))
+		)
+		RETURNING id, status, title, artist, album, year, s3_key, song_id, error, duplicate_of, created_at, updated_at, tenant_id
+		`
+	ctx, cancel := j.withTimeout(ctx)
+	defer cancel()
+
+	job, err = scanJob(j.DB.QueryRowContext(ctx, query, id, models.JobRunning, models.JobQueued, lease.Seconds()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (j *jobRepoSQL) RenewJob(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "JobRepo.RenewJob", attribute.String("job.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		UPDATE jobs
+		SET updated_at = now() AT TIME ZONE 'UTC'
+		WHERE id = $1 AND status = $2
+		`
+	ctx, cancel := j.withTimeout(ctx)
+	defer cancel()
+
+	if _, err = j.DB.ExecContext(ctx, query, id, models.JobRunning); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	var job models.Job
+	var songID, jobErr, duplicateOf sql.NullString
+
+	if err := row.Scan(
+		&job.ID,
+		&job.Status,
+		&job.Title,
+		&job.Artist,
+		&job.Album,
+		&job.Year,
+		&job.S3Key,
+		&songID,
+		&jobErr,
+		&duplicateOf,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.TenantID,
+	); err != nil {
+		return nil, err
+	}
+
+	job.SongID = songID.String
+	job.Error = jobErr.String
+	job.DuplicateOf = duplicateOf.String
+
+	return &job, nil
+}
+
+func validateJob(job models.Job) error {
+	if strings.TrimSpace(job.ID) == "" {
+		return models.Errorf(models.ErrValidation, "job ID is required")
+	}
+
+	switch job.Status {
+	case models.JobQueued, models.JobRunning, models.JobSucceeded, models.JobFailed:
+	default:
+		return models.Errorf(models.ErrValidation, "invalid job status: %q", job.Status)
+	}
+
+	if job.UpdatedAt.IsZero() {
+		return models.Errorf(models.ErrValidation, "updated_at timestamp is required")
+	}
+
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
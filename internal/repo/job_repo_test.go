@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestJob(id string, status models.JobStatus) models.Job {
+	now := time.Now().UTC()
+	return models.Job{
+		ID:        id,
+		Status:    status,
+		Title:     "Test Song",
+		Artist:    "Test Artist",
+		Album:     "Test Album",
+		Year:      2023,
+		S3Key:     "uploads/" + id + ".wav",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func TestJobRepo_SaveJob(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewJobRepo(db)
+
+	tests := []struct {
+		name    string
+		job     models.Job
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:    "valid job",
+			job:     newTestJob("job-1", models.JobQueued),
+			wantErr: false,
+		},
+		{
+			name:    "missing ID",
+			job:     newTestJob("", models.JobQueued),
+			wantErr: true,
+			errMsg:  "job ID is required",
+		},
+		{
+			name:    "invalid status",
+			job:     newTestJob("job-2", "paused"),
+			wantErr: true,
+			errMsg:  "invalid job status",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ClearTestData(t, db)
+
+			err := repo.SaveJob(ctx, tt.job)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+
+			require.NoError(t, err)
+
+			saved, err := repo.FindById(ctx, tt.job.ID)
+			require.NoError(t, err)
+			require.NotNil(t, saved)
+
+			assert.Equal(t, tt.job.ID, saved.ID)
+			assert.Equal(t, tt.job.Status, saved.Status)
+			assert.Equal(t, tt.job.Title, saved.Title)
+			assert.Equal(t, tt.job.S3Key, saved.S3Key)
+			assert.Empty(t, saved.SongID)
+			assert.Empty(t, saved.Error)
+		})
+	}
+}
+
+func TestJobRepo_UpdateJob(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewJobRepo(db)
+
+	job := newTestJob("job-1", models.JobQueued)
+	require.NoError(t, repo.SaveJob(ctx, job))
+
+	job.Status = models.JobSucceeded
+	job.SongID = "42"
+	job.DuplicateOf = "7"
+	job.UpdatedAt = time.Now().UTC()
+	require.NoError(t, repo.UpdateJob(ctx, job))
+
+	saved, err := repo.FindById(ctx, job.ID)
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+	assert.Equal(t, models.JobSucceeded, saved.Status)
+	assert.Equal(t, "42", saved.SongID)
+	assert.Equal(t, "7", saved.DuplicateOf)
+
+	missing := newTestJob("missing", models.JobFailed)
+	err = repo.UpdateJob(ctx, missing)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestJobRepo_FindByStatus(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewJobRepo(db)
+
+	require.NoError(t, repo.SaveJob(ctx, newTestJob("queued", models.JobQueued)))
+	require.NoError(t, repo.SaveJob(ctx, newTestJob("running", models.JobRunning)))
+	require.NoError(t, repo.SaveJob(ctx, newTestJob("done", models.JobSucceeded)))
+
+	jobs, err := repo.FindByStatus(ctx, models.JobQueued, models.JobRunning)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 2)
+
+	result, err := repo.FindById(ctx, "non-existing")
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestJobRepo_ClaimJob(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewJobRepo(db)
+
+	stale := newTestJob("stale", models.JobRunning)
+	stale.UpdatedAt = time.Now().UTC().Add(-time.Hour)
+	require.NoError(t, repo.SaveJob(ctx, newTestJob("queued", models.JobQueued)))
+	require.NoError(t, repo.SaveJob(ctx, newTestJob("running", models.JobRunning)))
+	require.NoError(t, repo.SaveJob(ctx, stale))
+	require.NoError(t, repo.SaveJob(ctx, newTestJob("done", models.JobSucceeded)))
+
+	job, err := repo.ClaimJob(ctx, "queued", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, models.JobRunning, job.Status)
+
+	job, err = repo.ClaimJob(ctx, "queued", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, job, "a job is claimed once")
+
+	job, err = repo.ClaimJob(ctx, "running", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, job, "a running job is held until its lease runs out")
+
+	job, err = repo.ClaimJob(ctx, "stale", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, job, "an expired lease is taken over")
+	assert.WithinDuration(t, time.Now().UTC(), job.UpdatedAt, time.Minute)
+
+	job, err = repo.ClaimJob(ctx, "done", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, job)
+
+	require.NoError(t, repo.RenewJob(ctx, "done"), "finished jobs are left alone")
+}
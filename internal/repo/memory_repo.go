@@ -0,0 +1,272 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+)
+
+// MemorySongRepo keeps songs in memory. It backs offline identification from a
+// snapshot and evaluation runs that shouldn't touch the database.
+type MemorySongRepo struct {
+	mu     sync.RWMutex
+	songs  map[string]models.Song
+	nextID int64
+}
+
+func NewMemorySongRepo() *MemorySongRepo {
+	return &MemorySongRepo{songs: make(map[string]models.Song)}
+}
+
+func (m *MemorySongRepo) SaveSong(ctx context.Context, song models.Song) error {
+	if err := validateSong(song); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.songs[song.ID]; exists {
+		return models.Errorf(models.ErrDuplicate, "song %s already exists", song.ID)
+	}
+	if song.ContentHash != "" {
+		for _, existing := range m.songs {
+			if existing.ContentHash == song.ContentHash && existing.TenantID == tenant.From(ctx) {
+				return models.Errorf(models.ErrDuplicate, "content hash already belongs to song %s", existing.ID)
+			}
+		}
+	}
+	if song.PCMHash != "" {
+		for _, existing := range m.songs {
+			if existing.PCMHash == song.PCMHash && existing.TenantID == tenant.From(ctx) {
+				return models.Errorf(models.ErrDuplicate, "PCM hash already belongs to song %s", existing.ID)
+			}
+		}
+	}
+
+	song.TenantID = tenant.From(ctx)
+	m.songs[song.ID] = song
+	if id, err := strconv.ParseInt(song.ID, 10, 64); err == nil && id > m.nextID {
+		m.nextID = id
+	}
+
+	return nil
+}
+
+func (m *MemorySongRepo) NextID(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	return strconv.FormatInt(m.nextID, 10), nil
+}
+
+// SyncNextID is a no-op, SaveSong already keeps NextID past every saved ID
+func (m *MemorySongRepo) SyncNextID(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemorySongRepo) FindById(ctx context.Context, id string) (*models.Song, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	song, ok := m.songs[id]
+	if !ok || !slices.Contains(tenant.Search(ctx), song.TenantID) {
+		return nil, nil
+	}
+	return &song, nil
+}
+
+func (m *MemorySongRepo) FindByFingerprint(ctx context.Context, hash string) (*models.Song, error) {
+	return nil, errors.New("FindByFingerprint is not supported by the memory repo, use MemoryFingerprintRepo.FindByHashes")
+}
+
+func (m *MemorySongRepo) FindByContentHash(ctx context.Context, hash string) (*models.Song, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, song := range m.songs {
+		if song.ContentHash == hash && song.TenantID == tenant.From(ctx) {
+			return &song, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemorySongRepo) FindByPCMHash(ctx context.Context, hash string) (*models.Song, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, song := range m.songs {
+		if song.PCMHash == hash && song.TenantID == tenant.From(ctx) {
+			return &song, nil
+		}
+	}
+	return nil, nil
+}
+
+// EachSong calls fn for every song of the tenant's own catalog in ID order
+func (m *MemorySongRepo) EachSong(ctx context.Context, fn func(models.Song) error) error {
+	m.mu.RLock()
+	songs := make([]models.Song, 0, len(m.songs))
+	for _, song := range m.songs {
+		if song.TenantID == tenant.From(ctx) {
+			songs = append(songs, song)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(songs, func(i, j int) bool { return songs[i].ID < songs[j].ID })
+	for _, song := range songs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(song); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryFingerprintRepo keeps fingerprints in memory, indexed by hash
+type MemoryFingerprintRepo struct {
+	mu      sync.RWMutex
+	byHash  map[uint32][]models.Fingerprint
+	bySong  map[int64][]models.Fingerprint
+	tenants map[int64]string // Tenant of each song's fingerprints
+	nextID  int64
+}
+
+func NewMemoryFingerprintRepo() *MemoryFingerprintRepo {
+	return &MemoryFingerprintRepo{
+		byHash:  make(map[uint32][]models.Fingerprint),
+		bySong:  make(map[int64][]models.Fingerprint),
+		tenants: make(map[int64]string),
+	}
+}
+
+// visible reports whether the fingerprints of songID are in a catalog ctx may search
+func (m *MemoryFingerprintRepo) visible(ctx context.Context, songID int64) bool {
+	return slices.Contains(tenant.Search(ctx), m.tenants[songID])
+}
+
+func (m *MemoryFingerprintRepo) SaveFingerprint(ctx context.Context, fingerprint models.Fingerprint) error {
+	return m.SaveFingerprints(ctx, []models.Fingerprint{fingerprint})
+}
+
+func (m *MemoryFingerprintRepo) SaveFingerprints(ctx context.Context, fingerprints []models.Fingerprint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, fingerprint := range fingerprints {
+		m.nextID++
+		fingerprint.ID = m.nextID
+		m.byHash[fingerprint.Hash] = append(m.byHash[fingerprint.Hash], fingerprint)
+		m.bySong[fingerprint.SongID] = append(m.bySong[fingerprint.SongID], fingerprint)
+		m.tenants[fingerprint.SongID] = tenant.From(ctx)
+	}
+
+	return nil
+}
+
+func (m *MemoryFingerprintRepo) FindByHash(ctx context.Context, hash string) (*models.Fingerprint, error) {
+	value, err := strconv.ParseUint(hash, 10, 32)
+	if err != nil {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, fingerprint := range m.byHash[uint32(value)] {
+		if m.visible(ctx, fingerprint.SongID) {
+			return &fingerprint, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryFingerprintRepo) FindByHashes(ctx context.Context, hashes []uint32) ([]models.Fingerprint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	fingerprints := []models.Fingerprint{}
+	for _, hash := range hashes {
+		for _, fingerprint := range m.byHash[hash] {
+			if m.visible(ctx, fingerprint.SongID) {
+				fingerprints = append(fingerprints, fingerprint)
+			}
+		}
+	}
+	return fingerprints, nil
+}
+
+func (m *MemoryFingerprintRepo) FindById(ctx context.Context, id int64) (*models.Fingerprint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, fingerprints := range m.bySong {
+		for _, fingerprint := range fingerprints {
+			if fingerprint.ID == id && m.visible(ctx, fingerprint.SongID) {
+				return &fingerprint, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryFingerprintRepo) FindBySongId(ctx context.Context, songId string) (*models.Fingerprint, error) {
+	fingerprints, err := m.FindAllBySongId(ctx, songId)
+	if err != nil || len(fingerprints) == 0 {
+		return nil, err
+	}
+	return &fingerprints[0], nil
+}
+
+// FindAllBySongId returns every fingerprint of a song ordered by time offset
+func (m *MemoryFingerprintRepo) FindAllBySongId(ctx context.Context, songId string) ([]models.Fingerprint, error) {
+	id, err := strconv.ParseInt(songId, 10, 64)
+	if err != nil {
+		return []models.Fingerprint{}, nil
+	}
+
+	m.mu.RLock()
+	if !m.visible(ctx, id) {
+		m.mu.RUnlock()
+		return []models.Fingerprint{}, nil
+	}
+	fingerprints := append([]models.Fingerprint{}, m.bySong[id]...)
+	m.mu.RUnlock()
+
+	sort.Slice(fingerprints, func(i, j int) bool {
+		if fingerprints[i].TimeOffset != fingerprints[j].TimeOffset {
+			return fingerprints[i].TimeOffset < fingerprints[j].TimeOffset
+		}
+		return fingerprints[i].Hash < fingerprints[j].Hash
+	})
+	return fingerprints, nil
+}
+
+// MemoryUnitOfWork hands the memory repos straight to the work. There is no
+// rollback: a failed ingest keeps whatever it saved, which the offline tools
+// using it tolerate since they rebuild the catalog on every run.
+type MemoryUnitOfWork struct {
+	Repos Repos
+}
+
+func NewMemoryUnitOfWork(songs *MemorySongRepo, fingerprints *MemoryFingerprintRepo) *MemoryUnitOfWork {
+	return &MemoryUnitOfWork{Repos: Repos{Songs: songs, Fingerprints: fingerprints}}
+}
+
+func (m *MemoryUnitOfWork) WithTx(ctx context.Context, fn func(tx Repos) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(m.Repos)
+}
@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func memorySong(id string) models.Song {
+	return models.Song{
+		ID:          id,
+		Title:       "Song " + id,
+		Artist:      "Test Artist",
+		Year:        2023,
+		S3Key:       "songs/" + id + ".wav",
+		ContentHash: "hash-" + id,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+func TestMemorySongRepo(t *testing.T) {
+	songs := NewMemorySongRepo()
+
+	require.NoError(t, songs.SaveSong(ctx, memorySong("4")))
+	assert.ErrorIs(t, songs.SaveSong(ctx, memorySong("4")), models.ErrDuplicate, "duplicate ID")
+	assert.ErrorIs(t, songs.SaveSong(ctx, models.Song{ID: "5"}), models.ErrValidation, "invalid song")
+
+	next, err := songs.NextID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "5", next, "IDs continue after saved songs")
+
+	found, err := songs.FindById(ctx, "4")
+	require.NoError(t, err)
+	assert.Equal(t, "Song 4", found.Title)
+
+	missing, err := songs.FindById(ctx, "404")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	byHash, err := songs.FindByContentHash(ctx, "hash-4")
+	require.NoError(t, err)
+	assert.Equal(t, "4", byHash.ID)
+
+	withPCM := memorySong("6")
+	withPCM.PCMHash = "pcm-6"
+	require.NoError(t, songs.SaveSong(ctx, withPCM))
+	byPCM, err := songs.FindByPCMHash(ctx, "pcm-6")
+	require.NoError(t, err)
+	assert.Equal(t, "6", byPCM.ID)
+
+	reencoded := memorySong("7")
+	reencoded.PCMHash = "pcm-6"
+	assert.ErrorIs(t, songs.SaveSong(ctx, reencoded), models.ErrDuplicate, "duplicate PCM hash")
+}
+
+func TestMemoryFingerprintRepo(t *testing.T) {
+	fingerprints := NewMemoryFingerprintRepo()
+	require.NoError(t, fingerprints.SaveFingerprints(ctx, []models.Fingerprint{
+		{SongID: 1, Hash: 111, TimeOffset: 9},
+		{SongID: 1, Hash: 222, TimeOffset: 2},
+		{SongID: 2, Hash: 222, TimeOffset: 5},
+	}))
+
+	results, err := fingerprints.FindByHashes(ctx, []uint32{222, 333})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	bySong, err := fingerprints.FindAllBySongId(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, bySong, 2)
+	assert.Equal(t, uint32(2), bySong[0].TimeOffset, "ordered by offset")
+	assert.NotZero(t, bySong[0].ID)
+}
+
+func TestMemoryRepos_TenantIsolation(t *testing.T) {
+	songs := NewMemorySongRepo()
+	fingerprints := NewMemoryFingerprintRepo()
+	acme := tenant.With(ctx, "acme", false)
+	shared := tenant.With(ctx, "acme", true)
+
+	require.NoError(t, songs.SaveSong(ctx, memorySong("1")))
+	require.NoError(t, fingerprints.SaveFingerprints(ctx, []models.Fingerprint{{SongID: 1, Hash: 111}}))
+	require.NoError(t, songs.SaveSong(acme, memorySong("2")))
+	require.NoError(t, fingerprints.SaveFingerprints(acme, []models.Fingerprint{{SongID: 2, Hash: 111}}))
+
+	own, err := songs.FindById(acme, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", own.TenantID)
+
+	other, err := songs.FindById(acme, "1")
+	require.NoError(t, err)
+	assert.Nil(t, other, "the global catalog is hidden unless the tenant may search it")
+
+	global, err := songs.FindById(shared, "1")
+	require.NoError(t, err)
+	assert.NotNil(t, global)
+
+	results, err := fingerprints.FindByHashes(acme, []uint32{111})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, int64(2), results[0].SongID)
+
+	results, err = fingerprints.FindByHashes(shared, []uint32{111})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	results, err = fingerprints.FindByHashes(ctx, []uint32{111})
+	require.NoError(t, err)
+	assert.Len(t, results, 1, "global requests never see tenant catalogs")
+
+	// Content hashes are unique per catalog, so a tenant can ingest a global song
+	duplicate := memorySong("1")
+	duplicate.ID = "3"
+	assert.NoError(t, songs.SaveSong(shared, duplicate))
+}
@@ -1,6 +1,9 @@
 package repo
 
 import (
+	"context"
+	"time"
+
 	"github.com/owenhochwald/harmonia/internal/models"
 	"github.com/stretchr/testify/mock"
 )
@@ -9,59 +12,216 @@ type MockSongRepo struct {
 	mock.Mock
 }
 
-func (m *MockSongRepo) SaveSong(song models.Song) error {
-	args := m.Called(song)
+func (m *MockSongRepo) SaveSong(ctx context.Context, song models.Song) error {
+	args := m.Called(ctx, song)
 	return args.Error(0)
 }
 
-func (m *MockSongRepo) FindById(id string) (*models.Song, error) {
-	args := m.Called(id)
+func (m *MockSongRepo) NextID(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSongRepo) SyncNextID(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockSongRepo) FindById(ctx context.Context, id string) (*models.Song, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Song), args.Error(1)
 }
 
-func (m *MockSongRepo) FindByFingerprint(hash string) (*models.Song, error) {
-	args := m.Called(hash)
+func (m *MockSongRepo) FindByFingerprint(ctx context.Context, hash string) (*models.Song, error) {
+	args := m.Called(ctx, hash)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Song), args.Error(1)
 }
 
+func (m *MockSongRepo) FindByContentHash(ctx context.Context, hash string) (*models.Song, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Song), args.Error(1)
+}
+
+func (m *MockSongRepo) FindByPCMHash(ctx context.Context, hash string) (*models.Song, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Song), args.Error(1)
+}
+
+func (m *MockSongRepo) EachSong(ctx context.Context, fn func(models.Song) error) error {
+	args := m.Called(ctx, fn)
+	return args.Error(0)
+}
+
 type MockFingerprintRepo struct {
 	mock.Mock
 }
 
-func (m *MockFingerprintRepo) SaveFingerprint(fingerprint models.Fingerprint) error {
-	args := m.Called(fingerprint)
+func (m *MockFingerprintRepo) SaveFingerprint(ctx context.Context, fingerprint models.Fingerprint) error {
+	args := m.Called(ctx, fingerprint)
+	return args.Error(0)
+}
+
+func (m *MockFingerprintRepo) SaveFingerprints(ctx context.Context, fingerprints []models.Fingerprint) error {
+	args := m.Called(ctx, fingerprints)
 	return args.Error(0)
 }
 
-func (m *MockFingerprintRepo) FindByHash(hash string) (*models.Fingerprint, error) {
-	args := m.Called(hash)
+func (m *MockFingerprintRepo) FindByHash(ctx context.Context, hash string) (*models.Fingerprint, error) {
+	args := m.Called(ctx, hash)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Fingerprint), args.Error(1)
 }
 
-func (m *MockFingerprintRepo) FindById(id int64) (*models.Fingerprint, error) {
-	args := m.Called(id)
+func (m *MockFingerprintRepo) FindByHashes(ctx context.Context, hashes []uint32) ([]models.Fingerprint, error) {
+	args := m.Called(ctx, hashes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Fingerprint), args.Error(1)
+}
+
+func (m *MockFingerprintRepo) FindById(ctx context.Context, id int64) (*models.Fingerprint, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Fingerprint), args.Error(1)
 }
 
-func (m *MockFingerprintRepo) FindBySongId(songId string) (*models.Fingerprint, error) {
-	args := m.Called(songId)
+func (m *MockFingerprintRepo) FindBySongId(ctx context.Context, songId string) (*models.Fingerprint, error) {
+	args := m.Called(ctx, songId)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Fingerprint), args.Error(1)
 }
+func (m *MockFingerprintRepo) FindAllBySongId(ctx context.Context, songId string) ([]models.Fingerprint, error) {
+	args := m.Called(ctx, songId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Fingerprint), args.Error(1)
+}
+
+type MockJobRepo struct {
+	mock.Mock
+}
+
+func (m *MockJobRepo) SaveJob(ctx context.Context, job models.Job) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+func (m *MockJobRepo) UpdateJob(ctx context.Context, job models.Job) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+func (m *MockJobRepo) FindById(ctx context.Context, id string) (*models.Job, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Job), args.Error(1)
+}
+
+func (m *MockJobRepo) FindByStatus(ctx context.Context, statuses ...models.JobStatus) ([]models.Job, error) {
+	args := m.Called(ctx, statuses)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Job), args.Error(1)
+}
+
+func (m *MockJobRepo) ClaimJob(ctx context.Context, id string, lease time.Duration) (*models.Job, error) {
+	args := m.Called(ctx, id, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Job), args.Error(1)
+}
+
+func (m *MockJobRepo) RenewJob(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockAPIKeyRepo struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepo) SaveKey(ctx context.Context, key models.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepo) FindByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+type MockUsageRepo struct {
+	mock.Mock
+}
+
+func (m *MockUsageRepo) IncrementUsage(ctx context.Context, keyID string, scope models.Scope, day time.Time) (int, error) {
+	args := m.Called(ctx, keyID, scope, day)
+	return args.Int(0), args.Error(1)
+}
+
+// MockUnitOfWork runs the work against Repos, usually the other mocks, and counts
+// how often it would have committed or rolled back. An error returned from the
+// "WithTx" expectation fails the transaction before the work runs.
+type MockUnitOfWork struct {
+	mock.Mock
+	Repos     Repos
+	Commits   int
+	Rollbacks int
+}
+
+func (m *MockUnitOfWork) WithTx(ctx context.Context, fn func(tx Repos) error) error {
+	args := m.Called(ctx)
+	if err := args.Error(0); err != nil {
+		return err
+	}
+
+	if err := fn(m.Repos); err != nil {
+		m.Rollbacks++
+		return err
+	}
+	m.Commits++
+	return nil
+}
 
 func NewMockSongRepo() *MockSongRepo {
 	return &MockSongRepo{}
@@ -71,3 +231,23 @@ func NewMockSongRepo() *MockSongRepo {
 func NewMockFingerprintRepo() *MockFingerprintRepo {
 	return &MockFingerprintRepo{}
 }
+
+// NewMockJobRepo creates a new mock job repository
+func NewMockJobRepo() *MockJobRepo {
+	return &MockJobRepo{}
+}
+
+// NewMockAPIKeyRepo creates a new mock API key repository
+func NewMockAPIKeyRepo() *MockAPIKeyRepo {
+	return &MockAPIKeyRepo{}
+}
+
+// NewMockUsageRepo creates a new mock usage repository
+func NewMockUsageRepo() *MockUsageRepo {
+	return &MockUsageRepo{}
+}
+
+// NewMockUnitOfWork creates a mock unit of work running against repos
+func NewMockUnitOfWork(repos Repos) *MockUnitOfWork {
+	return &MockUnitOfWork{Repos: repos}
+}
@@ -24,10 +24,10 @@ func TestMockSongRepo_Usage(t *testing.T) {
 
 	t.Run("SaveSong success", func(t *testing.T) {
 		// Setup expectation
-		mockRepo.On("SaveSong", testSong).Return(nil).Once()
+		mockRepo.On("SaveSong", mock.Anything, testSong).Return(nil).Once()
 
 		// Call the method
-		err := mockRepo.SaveSong(testSong)
+		err := mockRepo.SaveSong(ctx, testSong)
 
 		// Assertions
 		assert.NoError(t, err)
@@ -39,10 +39,10 @@ func TestMockSongRepo_Usage(t *testing.T) {
 		mockRepo.ExpectedCalls = nil
 
 		expectedErr := errors.New("database error")
-		mockRepo.On("SaveSong", testSong).Return(expectedErr).Once()
+		mockRepo.On("SaveSong", mock.Anything, testSong).Return(expectedErr).Once()
 
 		// Call the method
-		err := mockRepo.SaveSong(testSong)
+		err := mockRepo.SaveSong(ctx, testSong)
 
 		// Assertions
 		assert.Error(t, err)
@@ -54,10 +54,10 @@ func TestMockSongRepo_Usage(t *testing.T) {
 		// Reset mock for new test
 		mockRepo.ExpectedCalls = nil
 
-		mockRepo.On("FindById", "song-123").Return(&testSong, nil).Once()
+		mockRepo.On("FindById", mock.Anything, "song-123").Return(&testSong, nil).Once()
 
 		// Call the method
-		result, err := mockRepo.FindById("song-123")
+		result, err := mockRepo.FindById(ctx, "song-123")
 
 		// Assertions
 		assert.NoError(t, err)
@@ -70,10 +70,10 @@ func TestMockSongRepo_Usage(t *testing.T) {
 		// Reset mock for new test
 		mockRepo.ExpectedCalls = nil
 
-		mockRepo.On("FindById", "non-existing").Return(nil, nil).Once()
+		mockRepo.On("FindById", mock.Anything, "non-existing").Return(nil, nil).Once()
 
 		// Call the method
-		result, err := mockRepo.FindById("non-existing")
+		result, err := mockRepo.FindById(ctx, "non-existing")
 
 		// Assertions
 		assert.NoError(t, err)
@@ -85,10 +85,10 @@ func TestMockSongRepo_Usage(t *testing.T) {
 		// Reset mock for new test
 		mockRepo.ExpectedCalls = nil
 
-		mockRepo.On("FindByFingerprint", "12345").Return(&testSong, nil).Once()
+		mockRepo.On("FindByFingerprint", mock.Anything, "12345").Return(&testSong, nil).Once()
 
 		// Call the method
-		result, err := mockRepo.FindByFingerprint("12345")
+		result, err := mockRepo.FindByFingerprint(ctx, "12345")
 
 		// Assertions
 		assert.NoError(t, err)
@@ -109,9 +109,9 @@ func TestMockFingerprintRepo_Usage(t *testing.T) {
 	}
 
 	t.Run("SaveFingerprint success", func(t *testing.T) {
-		mockRepo.On("SaveFingerprint", testFingerprint).Return(nil).Once()
+		mockRepo.On("SaveFingerprint", mock.Anything, testFingerprint).Return(nil).Once()
 
-		err := mockRepo.SaveFingerprint(testFingerprint)
+		err := mockRepo.SaveFingerprint(ctx, testFingerprint)
 
 		assert.NoError(t, err)
 		mockRepo.AssertExpectations(t)
@@ -121,9 +121,9 @@ func TestMockFingerprintRepo_Usage(t *testing.T) {
 		// Reset mock for new test
 		mockRepo.ExpectedCalls = nil
 
-		mockRepo.On("FindByHash", "12345").Return(&testFingerprint, nil).Once()
+		mockRepo.On("FindByHash", mock.Anything, "12345").Return(&testFingerprint, nil).Once()
 
-		result, err := mockRepo.FindByHash("12345")
+		result, err := mockRepo.FindByHash(ctx, "12345")
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -135,9 +135,9 @@ func TestMockFingerprintRepo_Usage(t *testing.T) {
 		// Reset mock for new test
 		mockRepo.ExpectedCalls = nil
 
-		mockRepo.On("FindById", int64(1)).Return(&testFingerprint, nil).Once()
+		mockRepo.On("FindById", mock.Anything, int64(1)).Return(&testFingerprint, nil).Once()
 
-		result, err := mockRepo.FindById(1)
+		result, err := mockRepo.FindById(ctx, 1)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -149,9 +149,9 @@ func TestMockFingerprintRepo_Usage(t *testing.T) {
 		// Reset mock for new test
 		mockRepo.ExpectedCalls = nil
 
-		mockRepo.On("FindBySongId", "123").Return(&testFingerprint, nil).Once()
+		mockRepo.On("FindBySongId", mock.Anything, "123").Return(&testFingerprint, nil).Once()
 
-		result, err := mockRepo.FindBySongId("123")
+		result, err := mockRepo.FindBySongId(ctx, "123")
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -180,23 +180,23 @@ func TestMockRepo_MultipleExpectations(t *testing.T) {
 	}
 
 	// Setup multiple expectations
-	mockSongRepo.On("SaveSong", song).Return(nil).Once()
-	mockFingerprintRepo.On("SaveFingerprint", fingerprint).Return(nil).Once()
-	mockSongRepo.On("FindById", "song-456").Return(&song, nil).Once()
-	mockFingerprintRepo.On("FindBySongId", "456").Return(&fingerprint, nil).Once()
+	mockSongRepo.On("SaveSong", mock.Anything, song).Return(nil).Once()
+	mockFingerprintRepo.On("SaveFingerprint", mock.Anything, fingerprint).Return(nil).Once()
+	mockSongRepo.On("FindById", mock.Anything, "song-456").Return(&song, nil).Once()
+	mockFingerprintRepo.On("FindBySongId", mock.Anything, "456").Return(&fingerprint, nil).Once()
 
 	// Simulate a workflow
-	err := mockSongRepo.SaveSong(song)
+	err := mockSongRepo.SaveSong(ctx, song)
 	assert.NoError(t, err)
 
-	err = mockFingerprintRepo.SaveFingerprint(fingerprint)
+	err = mockFingerprintRepo.SaveFingerprint(ctx, fingerprint)
 	assert.NoError(t, err)
 
-	foundSong, err := mockSongRepo.FindById("song-456")
+	foundSong, err := mockSongRepo.FindById(ctx, "song-456")
 	assert.NoError(t, err)
 	assert.Equal(t, song.ID, foundSong.ID)
 
-	foundFingerprint, err := mockFingerprintRepo.FindBySongId("456")
+	foundFingerprint, err := mockFingerprintRepo.FindBySongId(ctx, "456")
 	assert.NoError(t, err)
 	assert.Equal(t, fingerprint.SongID, foundFingerprint.SongID)
 
@@ -210,14 +210,14 @@ func TestMockRepo_ArgumentMatchers(t *testing.T) {
 	mockRepo := NewMockSongRepo()
 
 	// Use argument matchers for more flexible expectations
-	mockRepo.On("FindById", mock.AnythingOfType("string")).Return(nil, nil)
+	mockRepo.On("FindById", mock.Anything, mock.AnythingOfType("string")).Return(nil, nil)
 
 	// This will match any string argument
-	result, err := mockRepo.FindById("any-id")
+	result, err := mockRepo.FindById(ctx, "any-id")
 	assert.NoError(t, err)
 	assert.Nil(t, result)
 
-	result, err = mockRepo.FindById("another-id")
+	result, err = mockRepo.FindById(ctx, "another-id")
 	assert.NoError(t, err)
 	assert.Nil(t, result)
 
@@ -1,16 +1,109 @@
 package repo
 
-import "github.com/owenhochwald/harmonia/internal/models"
+import (
+	"context"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
 
 type SongRepo interface {
-	SaveSong(song models.Song) error
-	FindById(id string) (*models.Song, error)
-	FindByFingerprint(hash string) (*models.Song, error)
+	SaveSong(ctx context.Context, song models.Song) error
+	NextID(ctx context.Context) (string, error)
+	SyncNextID(ctx context.Context) error
+	FindById(ctx context.Context, id string) (*models.Song, error)
+	FindByFingerprint(ctx context.Context, hash string) (*models.Song, error)
+	FindByContentHash(ctx context.Context, hash string) (*models.Song, error)
+	FindByPCMHash(ctx context.Context, hash string) (*models.Song, error)
+	EachSong(ctx context.Context, fn func(models.Song) error) error
 }
 
 type FingerprintRepo interface {
-	SaveFingerprint(models.Fingerprint) error
-	FindByHash(hash string) (*models.Fingerprint, error)
-	FindById(id int64) (*models.Fingerprint, error)
-	FindBySongId(songId string) (*models.Fingerprint, error)
+	SaveFingerprint(ctx context.Context, fingerprint models.Fingerprint) error
+	SaveFingerprints(ctx context.Context, fingerprints []models.Fingerprint) error
+	FindByHash(ctx context.Context, hash string) (*models.Fingerprint, error)
+	FindByHashes(ctx context.Context, hashes []uint32) ([]models.Fingerprint, error)
+	FindById(ctx context.Context, id int64) (*models.Fingerprint, error)
+	FindBySongId(ctx context.Context, songId string) (*models.Fingerprint, error)
+	FindAllBySongId(ctx context.Context, songId string) ([]models.Fingerprint, error)
+}
+
+type JobRepo interface {
+	SaveJob(ctx context.Context, job models.Job) error
+	UpdateJob(ctx context.Context, job models.Job) error
+	FindById(ctx context.Context, id string) (*models.Job, error)
+	FindByStatus(ctx context.Context, statuses ...models.JobStatus) ([]models.Job, error)
+	// ClaimJob marks a job running and returns it, or nil when it is finished or
+	// another worker holds it. A running job is taken over only once it hasn't been
+	// renewed for lease.
+	ClaimJob(ctx context.Context, id string, lease time.Duration) (*models.Job, error)
+	// RenewJob extends the lease of a running job, jobs no longer running are left alone
+	RenewJob(ctx context.Context, id string) error
+}
+
+type APIKeyRepo interface {
+	SaveKey(ctx context.Context, key models.APIKey) error
+	FindByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	ListKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeKey(ctx context.Context, id string, at time.Time) error
+}
+
+type UsageRepo interface {
+	IncrementUsage(ctx context.Context, keyID string, scope models.Scope, day time.Time) (int, error)
+}
+
+// DefaultQueryTimeout bounds a query whose context carries no deadline of its own
+const DefaultQueryTimeout = 5 * time.Second
+
+// bulkTimeoutFactor stretches the timeout for batch inserts and whole-song reads
+const bulkTimeoutFactor = 6
+
+// Option configures the SQL repos
+type Option func(*options)
+
+type options struct {
+	queryTimeout time.Duration
+}
+
+// WithQueryTimeout replaces DefaultQueryTimeout. Zero disables it, leaving queries
+// bounded only by the caller's context.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.queryTimeout = timeout
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{queryTimeout: DefaultQueryTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// withTimeout applies the default timeout unless the caller already set a deadline
+func (o options) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return o.bounded(ctx, o.queryTimeout)
+}
+
+// withBulkTimeout is withTimeout for queries that move a whole song's fingerprints
+func (o options) withBulkTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return o.bounded(ctx, bulkTimeoutFactor*o.queryTimeout)
+}
+
+func (o options) bounded(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// startSpan starts the span of a repo method, named for it like "SongRepo.SaveSong".
+// End it with tracing.End so failed queries are marked on the trace.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, append(attrs, semconv.DBSystemNamePostgreSQL)...)
 }
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+func TestOptions_Timeout(t *testing.T) {
+	t.Run("applied without a deadline", func(t *testing.T) {
+		ctx, cancel := newOptions(nil).withTimeout(context.Background())
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(DefaultQueryTimeout), deadline, time.Second)
+	})
+
+	t.Run("caller deadline is kept", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		want, _ := parent.Deadline()
+
+		ctx, cancel := newOptions(nil).withBulkTimeout(parent)
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.Equal(t, want, deadline)
+	})
+
+	t.Run("zero disables it", func(t *testing.T) {
+		ctx, cancel := newOptions([]Option{WithQueryTimeout(0)}).withTimeout(context.Background())
+		defer cancel()
+
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+	})
+
+	t.Run("cancellation reaches the query", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.Background())
+		ctx, release := newOptions(nil).withTimeout(parent)
+		defer release()
+
+		cancel()
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
+
+var errUnreachable = errors.New("database unreachable")
+
+// unreachableDB fails every statement, so repo methods run without Postgres
+type unreachableDB struct{}
+
+func (unreachableDB) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableDB) QueryContext(context.Context, string, ...any) (*sql.Rows, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableDB) QueryRowContext(context.Context, string, ...any) *sql.Row {
+	panic("QueryRowContext is not supported by unreachableDB")
+}
+
+func TestRepoSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, caller := tracing.Start(context.Background(), "caller")
+	options := newOptions(nil)
+	_, err := (&fingerprintRepoSQL{DB: unreachableDB{}, options: options}).FindByHashes(ctx, []uint32{1, 2})
+	assert.ErrorIs(t, err, errUnreachable)
+	err = SongRepoSQL{DB: unreachableDB{}, options: options}.SyncNextID(ctx)
+	assert.ErrorIs(t, err, errUnreachable)
+	caller.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	for i, name := range []string{"FingerprintRepo.FindByHashes", "SongRepo.SyncNextID"} {
+		span := spans[i]
+		assert.Equal(t, name, span.Name())
+		assert.Equal(t, caller.SpanContext().SpanID(), span.Parent().SpanID(), "%s is a child of its caller", name)
+		assert.Equal(t, codes.Error, span.Status().Code, "%s records the failed query", name)
+		assert.Contains(t, span.Attributes(), semconv.DBSystemNamePostgreSQL)
+	}
+}
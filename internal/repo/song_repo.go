@@ -4,65 +4,67 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type SongRepoSQL struct {
-	DB *sql.DB
+	DB DBTX
+	options
 }
 
-func NewSongRepo(db *sql.DB) SongRepo {
-	return &SongRepoSQL{DB: db}
+func NewSongRepo(db *sql.DB, opts ...Option) SongRepo {
+	return &SongRepoSQL{DB: db, options: newOptions(opts)}
 }
 
-func (s SongRepoSQL) FindById(id string) (*models.Song, error) {
+func (s SongRepoSQL) FindById(ctx context.Context, id string) (song *models.Song, err error) {
+	ctx, span := startSpan(ctx, "SongRepo.FindById", attribute.String("song.id", id))
+	defer func() { tracing.End(span, err) }()
+
 	query := `
-		SELECT s.id, s.title, s.artist, s.album, s.year, s.s3_key, s.fingerprint, s.created_at
+		SELECT ` + songColumns + `
 		FROM songs s
-		WHERE s.id = $1
+		WHERE s.id = $1 AND s.tenant_id = ANY($2)
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	var song models.Song
-
-	if err := s.DB.QueryRowContext(ctx, query, id).Scan(
-		&song.ID,
-		&song.Title,
-		&song.Artist,
-		&song.Album,
-		&song.Year,
-		&song.S3Key,
-		&song.Fingerprint,
-		&song.CreatedAt,
-	); err != nil {
+	song, err = scanSong(s.DB.QueryRowContext(ctx, query, id, pq.Array(tenant.Search(ctx))))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		fmt.Println("Database error:", err)
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
 		return nil, err
 	}
-	return &song, nil
+	return song, nil
 }
 
-func (s SongRepoSQL) SaveSong(song models.Song) error {
+func (s SongRepoSQL) SaveSong(ctx context.Context, song models.Song) (err error) {
+	ctx, span := startSpan(ctx, "SongRepo.SaveSong", attribute.String("song.id", song.ID))
+	defer func() { tracing.End(span, err) }()
+
 	// Validate required fields
 	if err := validateSong(song); err != nil {
 		return err
 	}
 
 	query := `
-		INSERT INTO songs (id, title, artist, album, year, s3_key, fingerprint, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO songs (id, title, artist, album, year, s3_key, fingerprint, content_hash, pcm_hash, duplicate_of, created_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	_, err := s.DB.ExecContext(ctx, query,
+	_, err = s.DB.ExecContext(ctx, query,
 		song.ID,
 		song.Title,
 		song.Artist,
@@ -70,11 +72,144 @@ func (s SongRepoSQL) SaveSong(song models.Song) error {
 		song.Year,
 		song.S3Key,
 		song.Fingerprint,
+		nullString(song.ContentHash),
+		nullString(song.PCMHash),
+		nullString(song.DuplicateOf),
 		song.CreatedAt,
+		tenant.From(ctx),
 	)
 
+	if isUniqueViolation(err) {
+		return models.Errorf(models.ErrDuplicate, "song %s or its content or PCM hash already exists: %w", song.ID, err)
+	}
 	if err != nil {
-		fmt.Println("Database error:", err)
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	return nil
+}
+
+// FindByContentHash finds the song ingested from a file with the given SHA-256 hash.
+// Only the tenant's own catalog is searched, duplicates of global songs are allowed.
+func (s SongRepoSQL) FindByContentHash(ctx context.Context, hash string) (song *models.Song, err error) {
+	ctx, span := startSpan(ctx, "SongRepo.FindByContentHash")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT ` + songColumns + `
+		FROM songs s
+		WHERE s.content_hash = $1 AND s.tenant_id = $2
+		`
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	song, err = scanSong(s.DB.QueryRowContext(ctx, query, hash, tenant.From(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+	return song, nil
+}
+
+// FindByPCMHash finds the song whose decoded audio has the given SHA-256 hash,
+// in the tenant's own catalog like FindByContentHash
+func (s SongRepoSQL) FindByPCMHash(ctx context.Context, hash string) (song *models.Song, err error) {
+	ctx, span := startSpan(ctx, "SongRepo.FindByPCMHash")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT ` + songColumns + `
+		FROM songs s
+		WHERE s.pcm_hash = $1 AND s.tenant_id = $2
+		`
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	song, err = scanSong(s.DB.QueryRowContext(ctx, query, hash, tenant.From(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+	return song, nil
+}
+
+// EachSong calls fn for every song of the tenant's own catalog in ID order, stopping
+// at the first error. Rows are streamed so the catalog never has to fit in memory.
+func (s SongRepoSQL) EachSong(ctx context.Context, fn func(models.Song) error) (err error) {
+	ctx, span := startSpan(ctx, "SongRepo.EachSong")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT ` + songColumns + `
+		FROM songs s
+		WHERE s.tenant_id = $1
+		ORDER BY s.id
+		`
+	// No default timeout, walking a large catalog takes as long as fn needs
+	rows, err := s.DB.QueryContext(ctx, query, tenant.From(ctx))
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			logger.FromContext(ctx).Error().Err(err).Msg("database error")
+			return err
+		}
+		if err := fn(*song); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	return nil
+}
+
+// NextID reserves a new song ID from the songs sequence
+func (s SongRepoSQL) NextID(ctx context.Context) (_ string, err error) {
+	ctx, span := startSpan(ctx, "SongRepo.NextID")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT nextval('songs_id_seq')`
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+
+	if err := s.DB.QueryRowContext(ctx, query).Scan(&id); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return "", err
+	}
+
+	return strconv.FormatInt(id, 10), nil
+}
+
+// SyncNextID moves the songs sequence past the highest song ID, for after songs
+// were saved under IDs NextID didn't hand out
+func (s SongRepoSQL) SyncNextID(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "SongRepo.SyncNextID")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT setval('songs_id_seq', GREATEST((SELECT max(id) FROM songs), 1))`
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.DB.ExecContext(ctx, query); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
 		return err
 	}
 
@@ -83,46 +218,64 @@ func (s SongRepoSQL) SaveSong(song models.Song) error {
 
 func validateSong(song models.Song) error {
 	if strings.TrimSpace(song.ID) == "" {
-		return errors.New("song ID is required")
+		return models.Errorf(models.ErrValidation, "song ID is required")
 	}
 
 	if strings.TrimSpace(song.Title) == "" {
-		return errors.New("song title is required")
+		return models.Errorf(models.ErrValidation, "song title is required")
 	}
 
 	if strings.TrimSpace(song.Artist) == "" {
-		return errors.New("song artist is required")
+		return models.Errorf(models.ErrValidation, "song artist is required")
 	}
 
 	if strings.TrimSpace(song.S3Key) == "" {
-		return errors.New("S3 key is required")
+		return models.Errorf(models.ErrValidation, "S3 key is required")
 	}
 
 	if song.Year < 1800 || song.Year > time.Now().Year()+1 {
-		return errors.New("invalid year: must be between 1800 and current year")
+		return models.Errorf(models.ErrValidation, "invalid year: must be between 1800 and current year")
 	}
 
 	if song.CreatedAt.IsZero() {
-		return errors.New("created_at timestamp is required")
+		return models.Errorf(models.ErrValidation, "created_at timestamp is required")
 	}
 
 	return nil
 }
 
-func (s SongRepoSQL) FindByFingerprint(hash string) (*models.Song, error) {
+func (s SongRepoSQL) FindByFingerprint(ctx context.Context, hash string) (song *models.Song, err error) {
+	ctx, span := startSpan(ctx, "SongRepo.FindByFingerprint")
+	defer func() { tracing.End(span, err) }()
+
 	query := `
-		SELECT s.id, s.title, s.artist, s.album, s.year, s.s3_key, s.fingerprint, s.created_at
+		SELECT ` + songColumns + `
 		FROM songs s
 		JOIN fingerprints f ON s.id = f.song_id::text
-		WHERE f.hash = $1
+		WHERE f.hash = $1 AND f.tenant_id = ANY($2)
 		LIMIT 1
 		`
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
+	song, err = scanSong(s.DB.QueryRowContext(ctx, query, hash, pq.Array(tenant.Search(ctx))))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return nil, err
+	}
+
+	return song, nil
+}
+
+const songColumns = `s.id, s.title, s.artist, s.album, s.year, s.s3_key, s.fingerprint, COALESCE(s.content_hash, ''), COALESCE(s.pcm_hash, ''), COALESCE(s.duplicate_of, ''), s.created_at, s.tenant_id`
+
+func scanSong(row rowScanner) (*models.Song, error) {
 	var song models.Song
 
-	if err := s.DB.QueryRowContext(ctx, query, hash).Scan(
+	if err := row.Scan(
 		&song.ID,
 		&song.Title,
 		&song.Artist,
@@ -130,14 +283,20 @@ func (s SongRepoSQL) FindByFingerprint(hash string) (*models.Song, error) {
 		&song.Year,
 		&song.S3Key,
 		&song.Fingerprint,
+		&song.ContentHash,
+		&song.PCMHash,
+		&song.DuplicateOf,
 		&song.CreatedAt,
+		&song.TenantID,
 	); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		fmt.Println("Database error:", err)
 		return nil, err
 	}
 
 	return &song, nil
 }
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate key
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
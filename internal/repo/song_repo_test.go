@@ -1,14 +1,18 @@
 package repo
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+var ctx = context.Background()
+
 func TestSongRepo_SaveSong(t *testing.T) {
 	db := SetupTestDB(t)
 	defer CleanupTestDB(t, db)
@@ -110,7 +114,7 @@ func TestSongRepo_SaveSong(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ClearTestData(t, db)
 
-			err := repo.SaveSong(tt.song)
+			err := repo.SaveSong(ctx, tt.song)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -119,7 +123,7 @@ func TestSongRepo_SaveSong(t *testing.T) {
 				assert.NoError(t, err)
 
 				// Verify song was saved
-				saved, err := repo.FindById(tt.song.ID)
+				saved, err := repo.FindById(ctx, tt.song.ID)
 				require.NoError(t, err)
 				require.NotNil(t, saved)
 
@@ -154,7 +158,7 @@ func TestSongRepo_FindById(t *testing.T) {
 		CreatedAt:   time.Now(),
 	}
 
-	err := repo.SaveSong(testSong)
+	err := repo.SaveSong(ctx, testSong)
 	require.NoError(t, err)
 
 	tests := []struct {
@@ -179,7 +183,7 @@ func TestSongRepo_FindById(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := repo.FindById(tt.id)
+			result, err := repo.FindById(ctx, tt.id)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -222,7 +226,7 @@ func TestSongRepo_FindByFingerprint(t *testing.T) {
 		CreatedAt:   time.Now(),
 	}
 
-	err := songRepo.SaveSong(testSong)
+	err := songRepo.SaveSong(ctx, testSong)
 	require.NoError(t, err)
 
 	testFingerprint := models.Fingerprint{
@@ -231,7 +235,7 @@ func TestSongRepo_FindByFingerprint(t *testing.T) {
 		TimeOffset: 1000,
 	}
 
-	err = fingerprintRepo.SaveFingerprint(testFingerprint)
+	err = fingerprintRepo.SaveFingerprint(ctx, testFingerprint)
 	require.NoError(t, err)
 
 	tests := []struct {
@@ -256,7 +260,7 @@ func TestSongRepo_FindByFingerprint(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := songRepo.FindByFingerprint(tt.hash)
+			result, err := songRepo.FindByFingerprint(ctx, tt.hash)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -283,7 +287,7 @@ func TestSongRepo_DuplicateID(t *testing.T) {
 	repo := NewSongRepo(db)
 
 	song1 := models.Song{
-		ID:        "song-123",
+		ID:        "124",
 		Title:     "Test Song 1",
 		Artist:    "Test Artist",
 		Year:      2023,
@@ -292,7 +296,7 @@ func TestSongRepo_DuplicateID(t *testing.T) {
 	}
 
 	song2 := models.Song{
-		ID:        "song-123", // Same ID
+		ID:        "124", // Same ID
 		Title:     "Test Song 2",
 		Artist:    "Test Artist",
 		Year:      2023,
@@ -301,10 +305,160 @@ func TestSongRepo_DuplicateID(t *testing.T) {
 	}
 
 	// First save should succeed
-	err := repo.SaveSong(song1)
+	err := repo.SaveSong(ctx, song1)
 	assert.NoError(t, err)
 
 	// Second save with same ID should fail
-	err = repo.SaveSong(song2)
+	err = repo.SaveSong(ctx, song2)
 	assert.Error(t, err)
 }
+
+func TestSongRepo_FindByContentHash(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewSongRepo(db)
+
+	testSong := models.Song{
+		ID:          "123",
+		Title:       "Test Song",
+		Artist:      "Test Artist",
+		Year:        2023,
+		S3Key:       "songs/test-song.wav",
+		ContentHash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, repo.SaveSong(ctx, testSong))
+
+	found, err := repo.FindByContentHash(ctx, testSong.ContentHash)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, testSong.ID, found.ID)
+	assert.Equal(t, testSong.ContentHash, found.ContentHash)
+
+	missing, err := repo.FindByContentHash(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// The same file can't be ingested twice
+	duplicate := testSong
+	duplicate.ID = "124"
+	assert.Error(t, repo.SaveSong(ctx, duplicate))
+}
+
+func TestSongRepo_FindByPCMHash(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewSongRepo(db)
+
+	testSong := models.Song{
+		ID:          "123",
+		Title:       "Test Song",
+		Artist:      "Test Artist",
+		Year:        2023,
+		S3Key:       "songs/test-song.wav",
+		PCMHash:     "pcm-hash",
+		DuplicateOf: "7",
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, repo.SaveSong(ctx, testSong))
+
+	found, err := repo.FindByPCMHash(ctx, "pcm-hash")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, testSong.ID, found.ID)
+	assert.Equal(t, "7", found.DuplicateOf)
+
+	missing, err := repo.FindByPCMHash(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// The same audio can't be ingested twice, even from a different file
+	duplicate := testSong
+	duplicate.ID = "124"
+	assert.ErrorIs(t, repo.SaveSong(ctx, duplicate), models.ErrDuplicate)
+
+	other, err := repo.FindByPCMHash(tenant.With(ctx, "acme", false), "pcm-hash")
+	assert.NoError(t, err)
+	assert.Nil(t, other, "other tenants don't see the song")
+}
+
+func TestSongRepo_SyncNextID(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	repo := NewSongRepo(db)
+
+	// Saved under an ID the sequence never handed out, as an archive import does
+	require.NoError(t, repo.SaveSong(ctx, models.Song{
+		ID:        "500",
+		Title:     "Imported Song",
+		Artist:    "Test Artist",
+		Year:      2023,
+		S3Key:     "songs/imported.wav",
+		CreatedAt: time.Now(),
+	}))
+
+	require.NoError(t, repo.SyncNextID(ctx))
+
+	next, err := repo.NextID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "501", next)
+}
+
+func TestSongRepo_TenantIsolation(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	songRepo := NewSongRepo(db)
+	fingerprintRepo := NewFingerprintRepo(db)
+	acme := tenant.With(ctx, "acme", false)
+	shared := tenant.With(ctx, "acme", true)
+
+	song := models.Song{
+		ID:          "500",
+		Title:       "Global Song",
+		Artist:      "Test Artist",
+		Year:        2023,
+		S3Key:       "songs/global.wav",
+		ContentHash: "global-hash",
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, songRepo.SaveSong(ctx, song))
+	require.NoError(t, fingerprintRepo.SaveFingerprints(ctx, []models.Fingerprint{{SongID: 500, Hash: 777, TimeOffset: 1}}))
+
+	labelSong := song
+	labelSong.ID = "501"
+	labelSong.Title = "Label Song"
+	require.NoError(t, songRepo.SaveSong(acme, labelSong), "content hashes are unique per tenant")
+	require.NoError(t, fingerprintRepo.SaveFingerprints(acme, []models.Fingerprint{{SongID: 501, Hash: 777, TimeOffset: 1}}))
+
+	found, err := songRepo.FindById(acme, "500")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	found, err = songRepo.FindById(shared, "500")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, tenant.Global, found.TenantID)
+
+	byHash, err := songRepo.FindByContentHash(acme, "global-hash")
+	require.NoError(t, err)
+	require.NotNil(t, byHash)
+	assert.Equal(t, "501", byHash.ID)
+
+	results, err := fingerprintRepo.FindByHashes(acme, []uint32{777})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, int64(501), results[0].SongID)
+
+	results, err = fingerprintRepo.FindByHashes(shared, []uint32{777})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	results, err = fingerprintRepo.FindByHashes(ctx, []uint32{777})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, int64(500), results[0].SongID)
+}
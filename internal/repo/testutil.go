@@ -1,11 +1,13 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"testing"
 
 	_ "github.com/lib/pq"
+	"github.com/owenhochwald/harmonia/internal/migrate"
 )
 
 const (
@@ -46,9 +48,10 @@ func SetupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
 
-	if err := createTestTables(testDB); err != nil {
+	// Same migrations the server applies, so tests run against the real schema
+	if _, err := migrate.Up(context.Background(), testDB); err != nil {
 		testDB.Close()
-		t.Fatalf("Failed to create test tables: %v", err)
+		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	return testDB
@@ -64,53 +67,28 @@ func CleanupTestDB(t *testing.T, db *sql.DB) {
 func ClearTestData(t *testing.T, db *sql.DB) {
 	t.Helper()
 
-	_, err := db.Exec("DELETE FROM fingerprints")
+	_, err := db.Exec("DELETE FROM api_key_usage")
 	if err != nil {
-		t.Fatalf("Failed to clear fingerprints table: %v", err)
+		t.Fatalf("Failed to clear api_key_usage table: %v", err)
 	}
 
-	_, err = db.Exec("DELETE FROM songs")
+	_, err = db.Exec("DELETE FROM api_keys")
 	if err != nil {
-		t.Fatalf("Failed to clear songs table: %v", err)
+		t.Fatalf("Failed to clear api_keys table: %v", err)
 	}
-}
 
-func createTestTables(db *sql.DB) error {
-	songsSQL := `
-		CREATE TABLE IF NOT EXISTS songs (
-			id VARCHAR(255) PRIMARY KEY,
-			title VARCHAR(255) NOT NULL,
-			artist VARCHAR(255) NOT NULL,
-			album VARCHAR(255),
-			year INTEGER,
-			s3_key VARCHAR(500) NOT NULL,
-			fingerprint BYTEA,
-			created_at TIMESTAMP NOT NULL DEFAULT NOW()
-		)
-	`
-
-	if _, err := db.Exec(songsSQL); err != nil {
-		return fmt.Errorf("failed to create songs table: %w", err)
+	_, err = db.Exec("DELETE FROM jobs")
+	if err != nil {
+		t.Fatalf("Failed to clear jobs table: %v", err)
 	}
 
-	fingerprintsSQL := `
-		CREATE TABLE IF NOT EXISTS fingerprints (
-			id BIGSERIAL PRIMARY KEY,
-			song_id VARCHAR(255) NOT NULL,
-			hash INTEGER NOT NULL,
-			time_offset INTEGER NOT NULL,
-			FOREIGN KEY (song_id) REFERENCES songs(id) ON DELETE CASCADE
-		)
-	`
-
-	if _, err := db.Exec(fingerprintsSQL); err != nil {
-		return fmt.Errorf("failed to create fingerprints table: %w", err)
+	_, err = db.Exec("DELETE FROM fingerprints")
+	if err != nil {
+		t.Fatalf("Failed to clear fingerprints table: %v", err)
 	}
 
-	indexSQL := `CREATE INDEX IF NOT EXISTS idx_fingerprints_hash ON fingerprints(hash)`
-	if _, err := db.Exec(indexSQL); err != nil {
-		return fmt.Errorf("failed to create fingerprints hash index: %w", err)
+	_, err = db.Exec("DELETE FROM songs")
+	if err != nil {
+		t.Fatalf("Failed to clear songs table: %v", err)
 	}
-
-	return nil
 }
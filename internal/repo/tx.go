@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/owenhochwald/harmonia/pkg/logger"
+)
+
+// DBTX is what the SQL repos query through, satisfied by both *sql.DB and *sql.Tx
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Repos are the repos a unit of work hands to its callback, all sharing one transaction
+type Repos struct {
+	Songs        SongRepo
+	Fingerprints FingerprintRepo
+}
+
+// UnitOfWork runs fn inside a transaction. It commits when fn returns nil and rolls
+// back when fn returns an error or panics; the error from fn is returned unchanged.
+type UnitOfWork interface {
+	WithTx(ctx context.Context, fn func(tx Repos) error) error
+}
+
+type unitOfWorkSQL struct {
+	DB *sql.DB
+	options
+}
+
+func NewUnitOfWork(db *sql.DB, opts ...Option) UnitOfWork {
+	return &unitOfWorkSQL{DB: db, options: newOptions(opts)}
+}
+
+func (u *unitOfWorkSQL) WithTx(ctx context.Context, fn func(tx Repos) error) error {
+	return runInTx(ctx, u.DB, func(tx *sql.Tx) error {
+		return fn(Repos{
+			Songs:        &SongRepoSQL{DB: tx, options: u.options},
+			Fingerprints: &fingerprintRepoSQL{DB: tx, options: u.options},
+		})
+	})
+}
+
+func runInTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logger.FromContext(ctx).Error().Err(rollbackErr).Msg("database error")
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitOfWork_WithTx(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	unitOfWork := NewUnitOfWork(db)
+	songRepo := NewSongRepo(db)
+	fingerprintRepo := NewFingerprintRepo(db)
+
+	save := func(id string, songID int64) func(tx Repos) error {
+		return func(tx Repos) error {
+			if err := tx.Songs.SaveSong(ctx, models.Song{
+				ID:        id,
+				Title:     "Song " + id,
+				Artist:    "Test Artist",
+				Year:      2023,
+				S3Key:     "songs/" + id + ".wav",
+				CreatedAt: time.Now(),
+			}); err != nil {
+				return err
+			}
+			return tx.Fingerprints.SaveFingerprints(ctx, []models.Fingerprint{
+				{SongID: songID, Hash: 111, TimeOffset: 1},
+				{SongID: songID, Hash: 222, TimeOffset: 2},
+			})
+		}
+	}
+
+	t.Run("commits", func(t *testing.T) {
+		require.NoError(t, unitOfWork.WithTx(ctx, save("601", 601)))
+
+		song, err := songRepo.FindById(ctx, "601")
+		require.NoError(t, err)
+		assert.NotNil(t, song)
+
+		fingerprints, err := fingerprintRepo.FindAllBySongId(ctx, "601")
+		require.NoError(t, err)
+		assert.Len(t, fingerprints, 2)
+	})
+
+	t.Run("rolls back on error", func(t *testing.T) {
+		failure := errors.New("fingerprinting failed")
+		err := unitOfWork.WithTx(ctx, func(tx Repos) error {
+			if err := save("602", 602)(tx); err != nil {
+				return err
+			}
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+
+		song, err := songRepo.FindById(ctx, "602")
+		require.NoError(t, err)
+		assert.Nil(t, song, "song is rolled back")
+
+		fingerprints, err := fingerprintRepo.FindAllBySongId(ctx, "602")
+		require.NoError(t, err)
+		assert.Empty(t, fingerprints, "fingerprints are rolled back")
+	})
+
+	t.Run("rolls back when the fingerprints fail", func(t *testing.T) {
+		// Song 603 doesn't exist, so the fingerprint foreign key fails after song 604 is saved
+		err := unitOfWork.WithTx(ctx, save("604", 603))
+		assert.Error(t, err)
+
+		song, err := songRepo.FindById(ctx, "604")
+		require.NoError(t, err)
+		assert.Nil(t, song)
+	})
+
+	t.Run("rolls back on panic", func(t *testing.T) {
+		assert.Panics(t, func() {
+			unitOfWork.WithTx(ctx, func(tx Repos) error {
+				require.NoError(t, save("605", 605)(tx))
+				panic("boom")
+			})
+		})
+
+		song, err := songRepo.FindById(ctx, "605")
+		require.NoError(t, err)
+		assert.Nil(t, song)
+	})
+}
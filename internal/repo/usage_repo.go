@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+)
+
+type usageRepoSQL struct {
+	DB DBTX
+	options
+}
+
+func NewUsageRepo(db *sql.DB, opts ...Option) UsageRepo {
+	return &usageRepoSQL{DB: db, options: newOptions(opts)}
+}
+
+// IncrementUsage counts one request and returns the key's total for the scope on
+// that day. Concurrent requests are counted atomically by the upsert.
+func (u *usageRepoSQL) IncrementUsage(ctx context.Context, keyID string, scope models.Scope, day time.Time) (requests int, err error) {
+	ctx, span := startSpan(ctx, "UsageRepo.IncrementUsage")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		INSERT INTO api_key_usage (api_key_id, scope, day, requests)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (api_key_id, scope, day)
+		DO UPDATE SET requests = api_key_usage.requests + 1
+		RETURNING requests
+		`
+	ctx, cancel := u.withTimeout(ctx)
+	defer cancel()
+
+	err = u.DB.QueryRowContext(ctx, query, keyID, scope, day.UTC().Format(time.DateOnly)).Scan(&requests)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("database error")
+		return 0, err
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageRepo_IncrementUsage(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	ClearTestData(t, db)
+
+	require.NoError(t, NewAPIKeyRepo(db).SaveKey(ctx, newTestAPIKey("key-1", "hash-1", models.ScopeIdentify)))
+	repo := NewUsageRepo(db)
+	today := time.Date(2025, 6, 1, 23, 0, 0, 0, time.UTC)
+
+	for want := 1; want <= 3; want++ {
+		got, err := repo.IncrementUsage(ctx, "key-1", models.ScopeIdentify, today)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	got, err := repo.IncrementUsage(ctx, "key-1", models.ScopeIngest, today)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got, "scopes are counted apart")
+
+	got, err = repo.IncrementUsage(ctx, "key-1", models.ScopeIdentify, today.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, got, "a new day starts a new count")
+
+	_, err = repo.IncrementUsage(ctx, "missing", models.ScopeIdentify, today)
+	assert.Error(t, err, "usage belongs to an existing key")
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 
 	"github.com/owenhochwald/harmonia/internal/config"
+	"github.com/owenhochwald/harmonia/internal/metrics"
+	"github.com/owenhochwald/harmonia/internal/models"
 	"github.com/owenhochwald/harmonia/internal/repo"
 	"github.com/owenhochwald/harmonia/internal/services"
 	"github.com/owenhochwald/harmonia/internal/storage"
@@ -19,13 +21,24 @@ type Application struct {
 
 	SongRepo        repo.SongRepo
 	FingerprintRepo repo.FingerprintRepo
+	JobRepo         repo.JobRepo
+	APIKeyRepo      repo.APIKeyRepo
+	UsageRepo       repo.UsageRepo
+	UnitOfWork      repo.UnitOfWork
 
 	AudioService       services.AudioServiceInterface
 	MusicService       services.MusicServiceInterface
 	FingerprintService services.FingerprintServiceInterface
+	JobService         services.JobServiceInterface
+	APIKeyService      services.APIKeyServiceInterface
 
-	MusicHandler  *MusicHandler
-	HealthHandler *HealthHandler
+	Auth        *Authenticator
+	RateLimiter *RateLimiter
+
+	MusicHandler    *MusicHandler
+	JobHandler      *JobHandler
+	IdentifyHandler *IdentifyHandler
+	HealthHandler   *HealthHandler
 }
 
 func NewApplication(cfg config.Config, log zerolog.Logger, db *sql.DB) (*Application, error) {
@@ -36,7 +49,15 @@ func NewApplication(cfg config.Config, log zerolog.Logger, db *sql.DB) (*Applica
 	}
 
 	// TODO: add concrete implementation for S3 storage
-	//app.Storage =
+	localStorage, err := storage.NewLocalStorage(cfg.StorageDir)
+	if err != nil {
+		return nil, err
+	}
+	app.Storage = localStorage
+
+	if err := metrics.RegisterDB(db); err != nil {
+		return nil, err
+	}
 
 	if err := app.initRepos(); err != nil {
 		return nil, err
@@ -52,23 +73,43 @@ func NewApplication(cfg config.Config, log zerolog.Logger, db *sql.DB) (*Applica
 }
 
 func (app *Application) initRepos() error {
-	app.SongRepo = repo.NewSongRepo(app.DB)
-	app.FingerprintRepo = repo.NewFingerprintRepo(app.DB)
+	timeout := repo.WithQueryTimeout(app.Config.DBQueryTimeout)
+	app.SongRepo = repo.NewSongRepo(app.DB, timeout)
+	app.FingerprintRepo = repo.NewFingerprintRepo(app.DB, timeout)
+	app.JobRepo = repo.NewJobRepo(app.DB, timeout)
+	app.APIKeyRepo = repo.NewAPIKeyRepo(app.DB, timeout)
+	app.UsageRepo = repo.NewUsageRepo(app.DB, timeout)
+	app.UnitOfWork = repo.NewUnitOfWork(app.DB, timeout)
 
 	return nil
 }
 
 func (app *Application) initServices() error {
-	app.MusicService = services.NewMusicService(app.Storage, app.SongRepo, app.AudioService, app.FingerprintService)
 	app.AudioService = services.NewAudioService()
 	app.FingerprintService = services.NewFingerprintService(app.FingerprintRepo)
+	app.MusicService = services.NewMusicService(app.Storage, app.SongRepo, app.UnitOfWork, app.AudioService, app.FingerprintService, services.DuplicatePolicy{
+		Threshold: app.Config.DuplicateThreshold,
+		Action:    services.DuplicateAction(app.Config.DuplicateAction),
+	})
+	app.JobService = services.NewJobService(app.Storage, app.JobRepo, app.MusicService, app.Logger, app.Config.IngestWorkers, app.Config.IngestQueueSize)
+	app.APIKeyService = services.NewAPIKeyService(app.APIKeyRepo)
 
 	return nil
 }
 
 func (app *Application) initHandlers() error {
-	app.MusicHandler = NewMusicHandler(app.AudioService, app.MusicService, app.SongRepo)
-	app.HealthHandler = NewHealthHandler()
+	app.Auth = NewAuthenticator(app.APIKeyService, app.Config.AuthRequired)
+	app.RateLimiter = NewRateLimiter(app.UsageRepo, app.Logger, map[models.Scope]config.Limits{
+		models.ScopeIdentify: app.Config.IdentifyLimits,
+		models.ScopeIngest:   app.Config.IngestLimits,
+	})
+	app.MusicHandler = NewMusicHandler(app.AudioService, app.MusicService, app.JobService, app.SongRepo)
+	app.JobHandler = NewJobHandler(app.JobService)
+
+	streamOptions := services.DefaultStreamOptions()
+	streamOptions.Threshold = app.Config.IdentifyThreshold
+	app.IdentifyHandler = NewIdentifyHandler(app.AudioService, app.MusicService, streamOptions, app.Config.IdentifyStreamTimeout, app.Config.IdentifyAllowedOrigins)
+	app.HealthHandler = NewHealthHandler(DatabaseCheck(app.DB), StorageCheck(app.Storage), MigrationsCheck(app.DB))
 
 	return nil
 }
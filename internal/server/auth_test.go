@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator_Require(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keyRepo := repo.NewMockAPIKeyRepo()
+	keys := services.NewAPIKeyService(keyRepo)
+
+	var saved models.APIKey
+	keyRepo.On("SaveKey", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(models.APIKey)
+	}).Return(nil)
+	identifyToken, _, err := keys.Create(t.Context(), services.APIKeySpec{Name: "public", Scopes: []models.Scope{models.ScopeIdentify}, TenantID: "acme", SearchGlobal: true})
+	require.NoError(t, err)
+	identifyKey := saved
+	adminToken, _, err := keys.Create(t.Context(), services.APIKeySpec{Name: "ops", Scopes: []models.Scope{models.ScopeAdmin}})
+	require.NoError(t, err)
+	adminKey := saved
+
+	keyRepo.On("FindByHash", mock.Anything, identifyKey.Hash).Return(&identifyKey, nil)
+	keyRepo.On("FindByHash", mock.Anything, adminKey.Hash).Return(&adminKey, nil)
+	keyRepo.On("FindByHash", mock.Anything, mock.Anything).Return(nil, nil)
+
+	newRouter := func(required bool) *gin.Engine {
+		r := gin.New()
+		auth := NewAuthenticator(keys, required)
+		r.GET("/identify", auth.Require(models.ScopeIdentify), func(c *gin.Context) {
+			c.String(http.StatusOK, strings.Join(tenant.Search(c.Request.Context()), ","))
+		})
+		r.GET("/ingest", auth.Require(models.ScopeIngest), func(c *gin.Context) { c.Status(http.StatusOK) })
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		value    string
+		required bool
+		want     int
+	}{
+		{"bearer key with scope", "/identify", "Authorization", "Bearer " + identifyToken, true, http.StatusOK},
+		{"X-API-Key header", "/identify", "X-API-Key", identifyToken, true, http.StatusOK},
+		{"admin allowed everything", "/ingest", "Authorization", "Bearer " + adminToken, true, http.StatusOK},
+		{"missing key", "/identify", "", "", true, http.StatusUnauthorized},
+		{"unknown key", "/identify", "X-API-Key", "hmn_unknown", true, http.StatusUnauthorized},
+		{"key lacking scope", "/ingest", "X-API-Key", identifyToken, true, http.StatusForbidden},
+		{"auth turned off", "/ingest", "", "", false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			newRouter(tt.required).ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	t.Run("scopes the request to the key's tenant", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/identify", nil)
+		req.Header.Set("X-API-Key", identifyToken)
+		w := httptest.NewRecorder()
+		newRouter(true).ServeHTTP(w, req)
+		assert.Equal(t, "acme,global", w.Body.String())
+	})
+}
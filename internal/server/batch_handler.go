@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+)
+
+type batchResult struct {
+	Filename string `json:"filename"`
+	Status   string `json:"status"` // accepted or rejected
+	JobID    string `json:"job_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Code     string `json:"code,omitempty"` // Error code, as in problem responses
+}
+
+// handleBatchUpload accepts several `file` parts or a single `archive` ZIP,
+// with metadata from a `manifest` part (CSV or JSON) or a manifest bundled in the ZIP.
+// Every file is validated and queued on its own, so one bad file doesn't sink the batch.
+// Files are read one at a time, so only one is held in memory.
+func (m *MusicHandler) handleBatchUpload(c *gin.Context) {
+	// The audio plus a manifest part, which may be as large as a file
+	limitBody(c, services.MaxBatchSize+services.MaxFileSize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		renderError(c, formError(err, "expected a multipart form"))
+		return
+	}
+
+	batch, release, err := batchFromForm(form)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+	defer release()
+
+	if len(batch.Files) == 0 {
+		renderError(c, models.Errorf(models.ErrValidation, "please provide at least one file or a zip archive"))
+		return
+	}
+
+	if batch.Manifest == nil {
+		renderError(c, models.Errorf(models.ErrValidation, "a manifest is required to describe the files"))
+		return
+	}
+	manifestData, err := batch.Manifest.ReadAll(services.MaxFileSize)
+	if err != nil {
+		renderError(c, fmt.Errorf("failed to read manifest: %w", err))
+		return
+	}
+	manifest, err := services.ParseManifest(batch.Manifest.Name, manifestData)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	results := make([]batchResult, 0, len(batch.Files))
+	accepted := 0
+	for _, file := range batch.Files {
+		result := m.submitBatchFile(c.Request.Context(), batch, file, manifest)
+		if result.Status == "accepted" {
+			accepted++
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusAccepted
+	switch {
+	case accepted == 0:
+		status = http.StatusUnprocessableEntity
+	case accepted < len(results):
+		status = http.StatusMultiStatus
+	}
+
+	c.JSON(status, gin.H{
+		"accepted": accepted,
+		"rejected": len(results) - accepted,
+		"results":  results,
+	})
+}
+
+func (m *MusicHandler) submitBatchFile(ctx context.Context, batch *services.Batch, file services.BatchFile, manifest services.Manifest) batchResult {
+	result := batchResult{Filename: file.Name, Status: "rejected"}
+
+	reject := func(err error) batchResult {
+		result.Error = err.Error()
+		_, result.Code = errorCode(err)
+		return result
+	}
+
+	song, err := manifest.Lookup(file.Name)
+	if err != nil {
+		return reject(err)
+	}
+
+	data, err := batch.Read(file)
+	if err != nil {
+		return reject(err)
+	}
+
+	if err := m.AudioService.ValidateFile(bytes.NewReader(data)); err != nil {
+		return reject(err)
+	}
+
+	job, err := m.JobService.Submit(ctx, song, data)
+	if err != nil {
+		if job != nil {
+			result.JobID = job.ID
+		}
+		return reject(err)
+	}
+
+	result.Status = "accepted"
+	result.JobID = job.ID
+	return result
+}
+
+// batchFromForm lists the files of the form without reading them. Call release
+// once the batch has been read, it closes the archive.
+func batchFromForm(form *multipart.Form) (batch *services.Batch, release func(), err error) {
+	release = func() {}
+
+	var manifest *services.BatchFile
+	if headers := form.File["manifest"]; len(headers) > 0 {
+		// An uploaded manifest lists paths relative to the batch, wherever it came from
+		file := formFile(headers[0])
+		file.Name = path.Base(file.Name)
+		manifest = &file
+	} else if values := form.Value["manifest"]; len(values) > 0 {
+		value := values[0]
+		manifest = &services.BatchFile{Name: "manifest", Size: int64(len(value)), Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(value)), nil
+		}}
+	}
+
+	archives := form.File["archive"]
+	uploads := form.File["file"]
+
+	if len(archives) > 0 && len(uploads) > 0 {
+		return nil, release, models.Errorf(models.ErrValidation, "send either file parts or an archive, not both")
+	}
+	if len(archives) > 1 {
+		return nil, release, models.Errorf(models.ErrValidation, "only one archive can be uploaded per batch")
+	}
+
+	if len(archives) == 1 {
+		header := archives[0]
+		if header.Size > services.MaxBatchSize {
+			return nil, release, models.Errorf(models.ErrTooLarge, "archive is too large")
+		}
+		// Members are decompressed from the spooled upload as they are read
+		archive, err := header.Open()
+		if err != nil {
+			return nil, release, fmt.Errorf("failed to read archive: %w", err)
+		}
+		release = func() { archive.Close() }
+
+		files, bundled, err := services.ExtractZip(archive, header.Size)
+		if err != nil {
+			return nil, release, err
+		}
+		if manifest == nil {
+			manifest = bundled
+		}
+		batch, err := services.NewBatch(files, manifest)
+		return batch, release, err
+	}
+
+	files := make([]services.BatchFile, 0, len(uploads))
+	for _, header := range uploads {
+		files = append(files, formFile(header))
+	}
+
+	batch, err = services.NewBatch(files, manifest)
+	return batch, release, err
+}
+
+func formFile(header *multipart.FileHeader) services.BatchFile {
+	return services.BatchFile{
+		Name: services.CleanBatchPath(header.Filename),
+		Size: header.Size,
+		Open: func() (io.ReadCloser, error) { return header.Open() },
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchForm builds a parsed multipart form from parts of the named field
+func batchForm(t *testing.T, field string, parts map[string][]byte) *multipart.Form {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, data := range parts {
+		part, err := writer.CreateFormFile(field, name)
+		require.NoError(t, err)
+		_, err = part.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	form, err := multipart.NewReader(&buf, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	t.Cleanup(func() { form.RemoveAll() })
+	return form
+}
+
+func zipArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := writer.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestBatchFromForm_Names(t *testing.T) {
+	t.Run("same file name in two directories", func(t *testing.T) {
+		form := batchForm(t, "archive", map[string][]byte{
+			"batch.zip": zipArchive(t, map[string][]byte{"a/track.wav": []byte("a"), "b/track.wav": []byte("b")}),
+		})
+
+		batch, release, err := batchFromForm(form)
+		require.NoError(t, err)
+		defer release()
+		names := []string{batch.Files[0].Name, batch.Files[1].Name}
+		assert.ElementsMatch(t, []string{"a/track.wav", "b/track.wav"}, names)
+	})
+
+	t.Run("archive naming a file twice", func(t *testing.T) {
+		form := batchForm(t, "archive", map[string][]byte{
+			"batch.zip": zipArchive(t, map[string][]byte{"a/track.wav": []byte("a"), "a//track.wav": []byte("b")}),
+		})
+
+		_, release, err := batchFromForm(form)
+		defer release()
+		assert.ErrorIs(t, err, models.ErrValidation)
+		assert.ErrorContains(t, err, `"a/track.wav" more than once`)
+	})
+}
+
+func TestBatchFromForm_Size(t *testing.T) {
+	t.Run("declared sizes over the batch limit", func(t *testing.T) {
+		parts := make(map[string][]byte)
+		for i := 0; i*services.MaxFileSize <= services.MaxBatchSize; i++ {
+			parts[fmt.Sprintf("%d.wav", i)] = make([]byte, services.MaxFileSize)
+		}
+		form := batchForm(t, "file", parts)
+
+		_, release, err := batchFromForm(form)
+		defer release()
+		assert.ErrorIs(t, err, models.ErrTooLarge)
+	})
+
+	t.Run("members are read one at a time", func(t *testing.T) {
+		form := batchForm(t, "archive", map[string][]byte{
+			"batch.zip": zipArchive(t, map[string][]byte{"one.wav": []byte("one"), "two.wav": []byte("two")}),
+		})
+
+		batch, release, err := batchFromForm(form)
+		require.NoError(t, err)
+		defer release()
+
+		for _, file := range batch.Files {
+			data, err := batch.Read(file)
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimSuffix(file.Name, ".wav"), string(data))
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/owenhochwald/harmonia/internal/config"
+)
+
+func ConnectDB(cfg config.Config) (*sql.DB, error) {
+	var err error
+	db, err := sql.Open("postgres", cfg.DBURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+
+	db.SetConnMaxLifetime(time.Hour)
+	db.SetMaxOpenConns(25)
+	db.SetConnMaxIdleTime(10 * time.Minute)
+
+	return db, nil
+}
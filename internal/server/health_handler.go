@@ -1,15 +1,119 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
-type HealthHandler struct{}
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/migrate"
+	"github.com/owenhochwald/harmonia/internal/storage"
+)
 
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+// healthCheckTimeout bounds each readiness check, so one hung dependency can't
+// stall the probe past the orchestrator's own timeout
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck is one dependency checked by /readyz
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type componentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthHandler struct {
+	Checks []HealthCheck
+}
+
+func NewHealthHandler(checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{
+		Checks: checks,
+	}
+}
+
+// DatabaseCheck pings Postgres
+func DatabaseCheck(db *sql.DB) HealthCheck {
+	return HealthCheck{Name: "database", Check: db.PingContext}
+}
+
+// StorageCheck probes the audio storage backend
+func StorageCheck(s storage.Storage) HealthCheck {
+	return HealthCheck{Name: "storage", Check: s.Ping}
 }
 
-func (h *HealthHandler) Check(c *gin.Context) {
-	c.JSON(200, gin.H{
-		"status": "healthy - all systems operational",
-	})
+// MigrationsCheck fails while the database is behind the migrations embedded in
+// this build. A database ahead of it is fine: during a rolling deploy the new
+// version migrates first and the old replicas keep serving.
+func MigrationsCheck(db *sql.DB) HealthCheck {
+	return HealthCheck{Name: "migrations", Check: func(ctx context.Context) error {
+		latest, err := migrate.Latest()
+		if err != nil {
+			return err
+		}
+		version, err := migrate.Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		if version < latest {
+			return fmt.Errorf("database is at migration %d, expected %d", version, latest)
+		}
+		return nil
+	}}
+}
+
+// Live reports that the process is up. It checks no dependencies, so a database
+// outage takes replicas out of rotation through /readyz instead of restarting them.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready runs every check at once and answers 503 if any fails, with the status
+// and latency of each component
+func (h *HealthHandler) Ready(c *gin.Context) {
+	components := make(map[string]componentStatus, len(h.Checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range h.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+			defer cancel()
+
+			started := time.Now()
+			err := check.Check(ctx)
+			component := componentStatus{
+				Status:    "ok",
+				LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+			}
+			if err != nil {
+				component.Status = "failing"
+				component.Error = err.Error()
+			}
+
+			mu.Lock()
+			components[check.Name] = component
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	for _, component := range components {
+		if component.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{"status": status, "components": components})
 }
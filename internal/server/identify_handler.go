@@ -0,0 +1,312 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/owenhochwald/harmonia/internal/metrics"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/pion/opus"
+)
+
+const (
+	streamReadLimit    = 1 << 20
+	streamWriteTimeout = 5 * time.Second
+)
+
+type IdentifyHandler struct {
+	AudioService  services.AudioServiceInterface
+	MusicService  services.MusicServiceInterface
+	StreamOptions services.StreamOptions
+	StreamTimeout time.Duration
+
+	upgrader websocket.Upgrader
+}
+
+// NewIdentifyHandler serves identification. Streams may be opened from web pages of
+// allowedOrigins, besides same-origin pages and clients that send no Origin.
+func NewIdentifyHandler(audioService services.AudioServiceInterface, musicService services.MusicServiceInterface, streamOptions services.StreamOptions, streamTimeout time.Duration, allowedOrigins []string) *IdentifyHandler {
+	return &IdentifyHandler{
+		AudioService:  audioService,
+		MusicService:  musicService,
+		StreamOptions: streamOptions,
+		StreamTimeout: streamTimeout,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  16 * 1024,
+			WriteBufferSize: 4 * 1024,
+			CheckOrigin:     checkOrigin(allowedOrigins),
+		},
+	}
+}
+
+// checkOrigin admits WebSocket handshakes from the allowed origins. Without it any
+// web page could open a stream from its visitors' browsers, passing along an API
+// key given in ?api_key=.
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	origins := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		origins[strings.ToLower(strings.TrimRight(origin, "/"))] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			// Not a browser, nothing a page could have forged
+			return true
+		}
+		if origins["*"] || origins[strings.ToLower(origin)] {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+func (h *IdentifyHandler) handleIdentify(c *gin.Context) {
+	audioBytes, err := readUpload(c)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	if err := h.AudioService.ValidateFile(bytes.NewReader(audioBytes)); err != nil {
+		renderError(c, err)
+		return
+	}
+
+	matches, err := h.MusicService.Identify(c.Request.Context(), audioBytes)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	hit := len(matches) > 0 && matches[0].Confidence >= h.StreamOptions.Threshold && matches[0].Score >= h.StreamOptions.MinScore
+	metrics.ObserveIdentify("upload", hit)
+
+	c.JSON(http.StatusOK, gin.H{"matches": matches})
+}
+
+type streamMessage struct {
+	Type       string           `json:"type"` // candidates, result or error
+	Candidates []services.Match `json:"candidates,omitempty"`
+	Match      *services.Match  `json:"match,omitempty"`
+	Reason     string           `json:"reason,omitempty"` // Why a result was sent: confident, ended or timeout
+	AudioSecs  float64          `json:"audio_seconds"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// handleIdentifyStream identifies audio streamed over a WebSocket.
+//
+// Query parameters pick the frame format: codec=pcm (default) takes signed 16-bit
+// little-endian frames at sample_rate (default 16000) with channels (1 or 2);
+// codec=opus takes one SILK-mode Opus packet per message, CELT and hybrid packets
+// end the stream with an error. Binary messages carry audio, a
+// text message "end" asks for the final answer. The server sends "candidates"
+// messages while it listens and one "result" message before closing, either once
+// a match is confirmed, the client ends the stream, or the timeout expires.
+func (h *IdentifyHandler) handleIdentifyStream(c *gin.Context) {
+	decoder, sampleRate, err := newFrameDecoder(c.DefaultQuery("codec", "pcm"), c.Query("sample_rate"), c.Query("channels"))
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	identifier, err := services.NewStreamIdentifier(h.MusicService, sampleRate, h.StreamOptions)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade already wrote the error response
+		return
+	}
+	defer conn.Close()
+
+	ctx := c.Request.Context()
+	conn.SetReadLimit(streamReadLimit)
+	conn.SetReadDeadline(time.Now().Add(h.StreamTimeout))
+
+	reason := "ended"
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				reason = "timeout"
+				break
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				break
+			}
+			return
+		}
+
+		if messageType == websocket.TextMessage {
+			if strings.EqualFold(strings.TrimSpace(string(message)), "end") {
+				break
+			}
+			continue
+		}
+
+		samples, err := decoder.decode(message)
+		if err != nil {
+			writeStreamMessage(conn, streamMessage{Type: "error", Error: err.Error()})
+			closeStream(conn, websocket.CloseUnsupportedData, "invalid audio frame")
+			return
+		}
+
+		pass, err := identifier.Write(ctx, samples)
+		if err != nil {
+			writeStreamMessage(conn, streamMessage{Type: "error", Error: "failed to identify audio"})
+			closeStream(conn, websocket.CloseInternalServerErr, "identification failed")
+			return
+		}
+		if pass == nil {
+			continue
+		}
+
+		if pass.Final != nil {
+			metrics.ObserveIdentify("stream", true)
+			writeStreamMessage(conn, streamMessage{Type: "result", Match: pass.Final, Reason: "confident", AudioSecs: pass.AudioSecs})
+			closeStream(conn, websocket.CloseNormalClosure, "identified")
+			return
+		}
+		if len(pass.Candidates) > 0 {
+			writeStreamMessage(conn, streamMessage{Type: "candidates", Candidates: pass.Candidates, AudioSecs: pass.AudioSecs})
+		}
+	}
+
+	pass, err := identifier.Flush(ctx)
+	if err != nil {
+		writeStreamMessage(conn, streamMessage{Type: "error", Error: "failed to identify audio"})
+		closeStream(conn, websocket.CloseInternalServerErr, "identification failed")
+		return
+	}
+
+	result := identifier.Best()
+	if len(pass.Candidates) > 0 && (result == nil || pass.Candidates[0].Score >= result.Score) {
+		result = &pass.Candidates[0]
+	}
+
+	metrics.ObserveIdentify("stream", result != nil)
+	writeStreamMessage(conn, streamMessage{Type: "result", Match: result, Reason: reason, AudioSecs: pass.AudioSecs})
+	closeStream(conn, websocket.CloseNormalClosure, reason)
+}
+
+func writeStreamMessage(conn *websocket.Conn, message streamMessage) {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	conn.WriteJSON(message)
+}
+
+func closeStream(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(streamWriteTimeout))
+}
+
+// frameDecoder turns one binary WebSocket message into mono 16-bit samples
+type frameDecoder interface {
+	decode(frame []byte) ([]int16, error)
+}
+
+func newFrameDecoder(codec, sampleRate, channels string) (frameDecoder, int, error) {
+	switch strings.ToLower(codec) {
+	case "pcm":
+		rate := services.TargetSampleRate
+		if sampleRate != "" {
+			parsed, err := strconv.Atoi(sampleRate)
+			if err != nil || parsed < 8000 || parsed > 48000 {
+				return nil, 0, models.Errorf(models.ErrValidation, "invalid sample_rate: %q", sampleRate)
+			}
+			rate = parsed
+		}
+
+		numChannels := 1
+		if channels != "" {
+			parsed, err := strconv.Atoi(channels)
+			if err != nil || parsed < 1 || parsed > 2 {
+				return nil, 0, models.Errorf(models.ErrValidation, "invalid channels: %q", channels)
+			}
+			numChannels = parsed
+		}
+
+		return &pcmDecoder{channels: numChannels}, rate, nil
+	case "opus":
+		decoder, err := opus.NewDecoderWithOutput(services.TargetSampleRate, 1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to create opus decoder: %w", err)
+		}
+		return &opusDecoder{decoder: decoder, buffer: make([]int16, opusMaxFrameSamples)}, services.TargetSampleRate, nil
+	default:
+		return nil, 0, models.Errorf(models.ErrUnsupportedFormat, "unsupported codec: %q", codec)
+	}
+}
+
+type pcmDecoder struct {
+	channels int
+}
+
+func (p *pcmDecoder) decode(frame []byte) ([]int16, error) {
+	frameSize := 2 * p.channels
+	if len(frame) == 0 || len(frame)%frameSize != 0 {
+		return nil, fmt.Errorf("pcm frame must be a multiple of %d bytes", frameSize)
+	}
+
+	samples := make([]int16, len(frame)/frameSize)
+	for i := range samples {
+		sum := 0
+		for ch := 0; ch < p.channels; ch++ {
+			sum += int(int16(binary.LittleEndian.Uint16(frame[i*frameSize+ch*2:])))
+		}
+		samples[i] = int16(sum / p.channels)
+	}
+
+	return samples, nil
+}
+
+// 120ms, the longest Opus packet, at the decoder output rate
+const opusMaxFrameSamples = services.TargetSampleRate * 120 / 1000
+
+type opusDecoder struct {
+	decoder opus.Decoder
+	buffer  []int16
+}
+
+// opusCELTConfig is the first TOC config of the hybrid and CELT modes. pion/opus
+// only decodes SILK, the speech mode, so packets at or above it are refused rather
+// than failing somewhere inside the decoder.
+const opusCELTConfig = 12
+
+func (o *opusDecoder) decode(frame []byte) ([]int16, error) {
+	if len(frame) == 0 {
+		return nil, errors.New("empty opus packet")
+	}
+	if config := frame[0] >> 3; config >= opusCELTConfig {
+		mode := "CELT"
+		if config < 16 {
+			mode = "hybrid"
+		}
+		return nil, fmt.Errorf("opus packet uses %s mode (config %d), only SILK packets can be decoded; "+
+			"encode for voice at wideband or below, or send codec=pcm", mode, config)
+	}
+
+	n, err := o.decoder.DecodeToInt16(frame, o.buffer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opus packet: %w", err)
+	}
+
+	samples := make([]int16, n)
+	copy(samples, o.buffer[:n])
+	return samples, nil
+}
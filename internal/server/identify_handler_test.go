@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpusDecoder_RejectsNonSILKPackets(t *testing.T) {
+	decoder, rate, err := newFrameDecoder("opus", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, 16000, rate)
+
+	// TOC byte: config in the top 5 bits, then the stereo flag and frame count code
+	_, err = decoder.decode([]byte{31 << 3, 0xff, 0xfe})
+	assert.ErrorContains(t, err, "CELT mode (config 31)")
+
+	_, err = decoder.decode([]byte{13 << 3, 0xff, 0xfe})
+	assert.ErrorContains(t, err, "hybrid mode (config 13)")
+
+	_, err = decoder.decode(nil)
+	assert.ErrorContains(t, err, "empty opus packet")
+
+	// SILK packets reach the decoder
+	_, err = decoder.decode([]byte{9 << 3, 0xff, 0xfe})
+	if err != nil {
+		assert.NotContains(t, err.Error(), "only SILK")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	check := checkOrigin([]string{"https://app.example.com/"})
+	handshake := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/api/identify/stream", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	assert.True(t, check(handshake("")), "non-browser clients send no Origin")
+	assert.True(t, check(handshake("https://app.example.com")))
+	assert.True(t, check(handshake("HTTPS://APP.EXAMPLE.COM")))
+	assert.True(t, check(handshake("https://api.example.com")), "same origin")
+	assert.False(t, check(handshake("https://evil.example.com")))
+	assert.False(t, check(handshake("null")))
+
+	assert.True(t, checkOrigin([]string{"*"})(handshake("https://evil.example.com")))
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+)
+
+const jobEventsHeartbeat = 15 * time.Second
+
+type JobHandler struct {
+	JobService services.JobServiceInterface
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewJobHandler(jobService services.JobServiceInterface) *JobHandler {
+	return &JobHandler{
+		JobService: jobService,
+		closing:    make(chan struct{}),
+	}
+}
+
+// Close ends every open event stream, so shutting down doesn't wait for jobs
+// that may run for minutes. Clients reconnect to another instance.
+func (j *JobHandler) Close() {
+	j.closeOnce.Do(func() { close(j.closing) })
+}
+
+func (j *JobHandler) handleGetJob(c *gin.Context) {
+	id := c.Param("id")
+	job, err := j.JobService.GetJob(c.Request.Context(), id)
+
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	if job == nil {
+		renderError(c, models.Errorf(models.ErrNotFound, "job %s not found", id))
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// handleJobEvents streams a job's pipeline progress as Server-Sent Events.
+// "progress" events are sent as stages finish, then one "status" event with the
+// final job before the stream ends.
+func (j *JobHandler) handleJobEvents(c *gin.Context) {
+	id := c.Param("id")
+
+	// Subscribe before loading the job so a job finishing in between still closes the stream
+	events, unsubscribe := j.JobService.Subscribe(id)
+	defer unsubscribe()
+
+	job, err := j.JobService.GetJob(c.Request.Context(), id)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+	if job == nil {
+		renderError(c, models.Errorf(models.ErrNotFound, "job %s not found", id))
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	if job.Status == models.JobSucceeded || job.Status == models.JobFailed {
+		c.SSEvent("status", job)
+		return
+	}
+
+	// The stream lasts as long as the job, well past the server's write timeout
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	heartbeat := time.NewTicker(jobEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-j.closing:
+			return false
+		case <-heartbeat.C:
+			// A comment line keeps proxies from closing an idle stream
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case event, ok := <-events:
+			if ok {
+				c.SSEvent("progress", event)
+				return true
+			}
+		}
+
+		job, err := j.JobService.GetJob(c.Request.Context(), id)
+		if err == nil && job == nil {
+			err = models.Errorf(models.ErrNotFound, "job %s not found", id)
+		}
+		if err != nil {
+			c.SSEvent("error", errorProblem(c, err))
+			return false
+		}
+		c.SSEvent("status", job)
+		return false
+	})
+}
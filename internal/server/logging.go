@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID, taken from the client or proxy when it
+// sends a usable one and echoed in every response
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// probeRoutes are polled constantly, so they are only logged at debug level while healthy
+var probeRoutes = map[string]bool{"/health": true, "/livez": true, "/readyz": true, "/metrics": true}
+
+// RequestLogger assigns each request an ID and puts a logger carrying it in the
+// request context for the services and repos. Once the request is done it logs the
+// route, status, latency, response size and API key, at warn level for 4xx and
+// error level for 5xx.
+func RequestLogger(log zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		requestLog := log.With().Str("request_id", id).Logger()
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context(), requestLog))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		route := c.FullPath()
+
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = requestLog.Error()
+		case status >= http.StatusBadRequest:
+			event = requestLog.Warn()
+		case probeRoutes[route]:
+			event = requestLog.Debug()
+		default:
+			event = requestLog.Info()
+		}
+
+		event = event.
+			Str("method", c.Request.Method).
+			Str("route", route).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Float64("latency_ms", float64(time.Since(started).Microseconds())/1000).
+			Int("bytes", max(c.Writer.Size(), 0)).
+			Str("client_ip", c.ClientIP())
+		if key := APIKeyFromContext(c); key != nil {
+			event = event.Str("api_key_id", key.ID)
+		}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.HasTraceID() {
+			event = event.Str("trace_id", span.TraceID().String())
+		}
+		if len(c.Errors) > 0 {
+			event = event.Strs("errors", c.Errors.Errors())
+		}
+		event.Msg("request")
+	}
+}
+
+// Recovery answers 500 to requests whose handler panicked, logging the panic and
+// stack with the request's logger
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(p) // net/http's way of dropping the connection
+			}
+			logger.FromContext(c.Request.Context()).Error().
+				Interface("panic", p).
+				Str("stack", string(debug.Stack())).
+				Msg("handler panicked")
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b) // Never fails, see crypto/rand
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/metrics"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoggedRouter(out *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestLogger(zerolog.New(out)), Recovery())
+	r.GET("/songs/:id", func(c *gin.Context) {
+		c.Set(apiKeyContextKey, &models.APIKey{ID: "key-1"})
+		logger.FromContext(c.Request.Context()).Info().Msg("from the handler")
+		c.String(http.StatusOK, "found")
+	})
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	return r
+}
+
+// logLines decodes the JSON log lines written to out
+func logLines(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &fields), line)
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestRequestLogger(t *testing.T) {
+	t.Run("logs the request with its ID", func(t *testing.T) {
+		var out bytes.Buffer
+		w := httptest.NewRecorder()
+		newLoggedRouter(&out).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/songs/7", nil))
+
+		id := w.Header().Get(RequestIDHeader)
+		assert.Len(t, id, 32, "generated when the client sends none")
+
+		lines := logLines(t, &out)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "from the handler", lines[0]["message"])
+		assert.Equal(t, id, lines[0]["request_id"], "handlers log with the request's logger")
+
+		request := lines[1]
+		assert.Equal(t, "info", request["level"])
+		assert.Equal(t, id, request["request_id"])
+		assert.Equal(t, "GET", request["method"])
+		assert.Equal(t, "/songs/:id", request["route"])
+		assert.Equal(t, "/songs/7", request["path"])
+		assert.Equal(t, float64(http.StatusOK), request["status"])
+		assert.Equal(t, float64(len("found")), request["bytes"])
+		assert.Equal(t, "key-1", request["api_key_id"])
+		assert.Contains(t, request, "latency_ms")
+	})
+
+	t.Run("keeps the client's request ID", func(t *testing.T) {
+		var out bytes.Buffer
+		req := httptest.NewRequest(http.MethodGet, "/songs/7", nil)
+		req.Header.Set(RequestIDHeader, "edge-42")
+		w := httptest.NewRecorder()
+		newLoggedRouter(&out).ServeHTTP(w, req)
+
+		assert.Equal(t, "edge-42", w.Header().Get(RequestIDHeader))
+		assert.Equal(t, "edge-42", logLines(t, &out)[1]["request_id"])
+	})
+
+	t.Run("replaces unusable request IDs", func(t *testing.T) {
+		var out bytes.Buffer
+		req := httptest.NewRequest(http.MethodGet, "/songs/7", nil)
+		req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+		w := httptest.NewRecorder()
+		newLoggedRouter(&out).ServeHTTP(w, req)
+
+		assert.Len(t, w.Header().Get(RequestIDHeader), 32)
+	})
+
+	t.Run("logs client errors as warnings", func(t *testing.T) {
+		var out bytes.Buffer
+		newLoggedRouter(&out).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+		request := logLines(t, &out)[0]
+		assert.Equal(t, "warn", request["level"])
+		assert.Equal(t, float64(http.StatusNotFound), request["status"])
+		assert.Equal(t, "", request["route"])
+	})
+
+	t.Run("recovers panics", func(t *testing.T) {
+		var out bytes.Buffer
+		w := httptest.NewRecorder()
+		newLoggedRouter(&out).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		lines := logLines(t, &out)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "handler panicked", lines[0]["message"])
+		assert.Equal(t, "boom", lines[0]["panic"])
+		assert.Equal(t, "error", lines[1]["level"])
+		assert.Equal(t, lines[0]["request_id"], lines[1]["request_id"])
+	})
+}
+
+func TestSetupRoutes_CountsPanics(t *testing.T) {
+	r := newRoutedEngine()
+	r.GET("/test-panic", func(c *gin.Context) { panic("boom") })
+
+	counted := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/test-panic", "500")
+	before := testutil.ToFloat64(counted)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test-panic", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(counted), "the recovered panic is counted as a 500")
+}
@@ -2,12 +2,16 @@ package server
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/models"
 	"github.com/owenhochwald/harmonia/internal/repo"
 	"github.com/owenhochwald/harmonia/internal/services"
 )
@@ -15,32 +19,67 @@ import (
 type MusicHandler struct {
 	AudioService services.AudioServiceInterface
 	MusicService services.MusicServiceInterface
+	JobService   services.JobServiceInterface
 	MusicRepo    repo.SongRepo
 }
 
-func NewMusicHandler(audioService services.AudioServiceInterface, musicService services.MusicServiceInterface, songRepo repo.SongRepo) *MusicHandler {
+func NewMusicHandler(audioService services.AudioServiceInterface, musicService services.MusicServiceInterface, jobService services.JobServiceInterface, songRepo repo.SongRepo) *MusicHandler {
 	return &MusicHandler{
 		AudioService: audioService,
 		MusicService: musicService,
+		JobService:   jobService,
 		MusicRepo:    songRepo,
 	}
 }
 
+// Page sizes of the song list
+const (
+	defaultSongsLimit = 100
+	maxSongsLimit     = 1000
+)
+
+// errPageFull stops walking the catalog once a page is collected
+var errPageFull = errors.New("page full")
+
+// handleGetSongs lists up to limit songs of the caller's catalog in ID order
 func (m *MusicHandler) handleGetSongs(c *gin.Context) {
+	limit := defaultSongsLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxSongsLimit {
+			renderError(c, models.Errorf(models.ErrValidation, "limit must be between 1 and %d", maxSongsLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	songs := []models.Song{}
+	err := m.MusicRepo.EachSong(c.Request.Context(), func(song models.Song) error {
+		songs = append(songs, song)
+		if len(songs) == limit {
+			return errPageFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPageFull) {
+		renderError(c, err)
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{"songs": songs})
 }
 
 func (m *MusicHandler) handleGetASong(c *gin.Context) {
 	id := c.Param("id")
-	song, err := m.MusicRepo.FindById(id)
+	song, err := m.MusicRepo.FindById(c.Request.Context(), id)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get song"})
+		renderError(c, err)
 		return
 	}
 
 	if song == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		renderError(c, models.Errorf(models.ErrNotFound, "song %s not found", id))
 		return
 	}
 
@@ -48,37 +87,101 @@ func (m *MusicHandler) handleGetASong(c *gin.Context) {
 }
 
 func (m *MusicHandler) handleAudioUpload(c *gin.Context) {
-	file, _, err := c.Request.FormFile("file")
+	audioBytes, err := readUpload(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "failed to get file"})
+		renderError(c, err)
+		return
 	}
-	defer file.Close()
 
-	audioBytes, err := io.ReadAll(file)
+	song, err := songFromForm(c)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
 
-	if err != nil || len(audioBytes) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "please provide a valid file"})
+	if err := m.AudioService.ValidateFile(bytes.NewReader(audioBytes)); err != nil {
+		renderError(c, err)
+		return
 	}
 
-	if err = c.Request.Body.Close(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "error reading and closing the request body"})
+	job, err := m.JobService.Submit(c.Request.Context(), song, audioBytes)
+	if err != nil {
+		problem := errorProblem(c, err)
+		if job != nil {
+			problem.JobID = job.ID // Queue full: the job is recorded as failed
+		}
+		writeProblem(c, problem)
+		return
 	}
 
-	audioService := &services.AudioService{}
+	c.Header("Location", "/api/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"message": "accepted", "job_id": job.ID, "job": job})
+}
 
-	if err, code := audioService.ValidateFile(bytes.NewReader(audioBytes)); err != nil {
-		c.JSON(code, gin.H{"error": err.Error()})
-		return
+// multipartOverhead is the room left above a route's size limit for boundaries,
+// part headers and the form's text fields
+const multipartOverhead = 1 << 20
+
+// limitBody caps the request body at limit bytes plus multipartOverhead, so an
+// oversized upload fails while gin parses the form instead of being spooled to disk first
+func limitBody(c *gin.Context, limit int64) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+}
+
+// formError is the error for a multipart form that could not be parsed
+func formError(err error, msg string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return models.Errorf(models.ErrTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
 	}
+	return models.Errorf(models.ErrValidation, "%s", msg)
+}
 
-	song, err := m.MusicService.HandleUpload(audioBytes)
+// readUpload reads the audio sent as the "file" part of a multipart form
+func readUpload(c *gin.Context) ([]byte, error) {
+	limitBody(c, services.MaxFileSize)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return nil, formError(err, "a multipart \"file\" part is required")
+	}
+	defer file.Close()
+
+	if header.Size > services.MaxFileSize {
+		return nil, models.Errorf(models.ErrTooLarge, "file is too large")
+	}
 
+	data, err := io.ReadAll(file)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to read WAV properties"})
-		return
+		return nil, fmt.Errorf("error reading upload: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, models.Errorf(models.ErrValidation, "empty file")
+	}
+	return data, nil
+}
+
+// songFromForm reads the song metadata sent alongside an upload
+func songFromForm(c *gin.Context) (models.Song, error) {
+	song := models.Song{
+		Title:  strings.TrimSpace(c.PostForm("title")),
+		Artist: strings.TrimSpace(c.PostForm("artist")),
+		Album:  strings.TrimSpace(c.PostForm("album")),
+	}
+
+	if song.Title == "" {
+		return song, models.Errorf(models.ErrValidation, "title is required")
 	}
+	if song.Artist == "" {
+		return song, models.Errorf(models.ErrValidation, "artist is required")
+	}
+
+	year, err := strconv.Atoi(strings.TrimSpace(c.PostForm("year")))
+	if err != nil {
+		return song, models.Errorf(models.ErrValidation, "invalid year: %q", c.PostForm("year"))
+	}
+	song.Year = year
 
-	c.JSON(http.StatusOK, gin.H{"message": "success", "song": song})
+	return song, nil
 }
 
 func (m *MusicHandler) handleTestWaveUpload(c *gin.Context) {
@@ -97,24 +200,14 @@ func (m *MusicHandler) handleTestWaveUpload(c *gin.Context) {
 		}
 		return
 	default:
-		c.JSON(400, gin.H{"error": "Invalid test parameter, please use 'properties' or 'mono'"})
+		renderError(c, models.Errorf(models.ErrValidation, "invalid test parameter, please use 'properties' or 'mono'"))
 	}
-
-	m.testAudioProperties(c)
 }
 
 func (m *MusicHandler) testAudioProperties(c *gin.Context) {
-	file, err := os.Open("/Users/owenhochwald/Documents/code/personal/backend/go/harmonia/public/audios/sample-12s.wav")
+	data, err := m.readAudioFile("/Users/owenhochwald/Documents/code/personal/backend/go/harmonia/public/audios/sample-12s.wav")
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to open audio file"})
-		return
-	}
-
-	defer file.Close()
-
-	data, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to read audio file"})
+		renderError(c, err)
 		return
 	}
 
@@ -124,7 +217,7 @@ func (m *MusicHandler) testAudioProperties(c *gin.Context) {
 	metaData, err := audioService.ReadWAVProperties(reader)
 
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to read WAV properties"})
+		renderError(c, fmt.Errorf("failed to read WAV properties: %w", err))
 		return
 	}
 
@@ -136,7 +229,7 @@ func (m *MusicHandler) testMonoConversion(c *gin.Context) {
 
 	data, err := m.readAudioFile(audioFile)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err})
+		renderError(c, err)
 		return
 	}
 
@@ -144,19 +237,19 @@ func (m *MusicHandler) testMonoConversion(c *gin.Context) {
 
 	originalMetadata, err := audioService.ReadWAVProperties(bytes.NewReader(data))
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to read original properties"})
+		renderError(c, fmt.Errorf("failed to read original properties: %w", err))
 		return
 	}
 
 	monoData, err := audioService.ConvertToMono(data)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to convert to mono", "details": err})
+		renderError(c, fmt.Errorf("failed to convert to mono: %w", err))
 		return
 	}
 
 	convertedMetadata, err := audioService.ReadWAVProperties(bytes.NewReader(monoData))
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to read converted properties"})
+		renderError(c, fmt.Errorf("failed to read converted properties: %w", err))
 		return
 	}
 
@@ -180,7 +273,7 @@ func (m *MusicHandler) downloadMonoConversion(c *gin.Context) {
 
 	data, err := m.readAudioFile(audioFile)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err})
+		renderError(c, err)
 		return
 	}
 
@@ -188,7 +281,7 @@ func (m *MusicHandler) downloadMonoConversion(c *gin.Context) {
 
 	monoData, err := audioService.ConvertToMono(data)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to convert to mono", "details": err})
+		renderError(c, fmt.Errorf("failed to convert to mono: %w", err))
 		return
 	}
 
@@ -197,13 +290,14 @@ func (m *MusicHandler) downloadMonoConversion(c *gin.Context) {
 
 func (m *MusicHandler) readAudioFile(filePath string) ([]byte, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("audio file not found: %s", filePath)
+		return nil, models.Errorf(models.ErrNotFound, "audio file not found: %s", filePath)
 	}
 
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer file.Close()
 
 	data, err := io.ReadAll(file)
 	if err != nil {
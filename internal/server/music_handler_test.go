@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zeros reads as an endless run of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// uploadContext builds a context whose request carries size bytes as its "file" part
+func uploadContext(t *testing.T, size int64) *gin.Context {
+	t.Helper()
+
+	var head bytes.Buffer
+	writer := multipart.NewWriter(&head)
+	_, err := writer.CreateFormFile("file", "track.wav")
+	require.NoError(t, err)
+	tail := "\r\n--" + writer.Boundary() + "--\r\n"
+
+	body := io.MultiReader(&head, io.LimitReader(zeros{}, size), bytes.NewBufferString(tail))
+	req := httptest.NewRequest(http.MethodPost, "/api/songs/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+	return c
+}
+
+func TestReadUpload_Size(t *testing.T) {
+	t.Run("within the limit", func(t *testing.T) {
+		data, err := readUpload(uploadContext(t, 1024))
+		require.NoError(t, err)
+		assert.Len(t, data, 1024)
+	})
+
+	t.Run("over the limit", func(t *testing.T) {
+		_, err := readUpload(uploadContext(t, services.MaxFileSize+1))
+		assert.ErrorIs(t, err, models.ErrTooLarge)
+	})
+
+	t.Run("body stops being read at the limit", func(t *testing.T) {
+		_, err := readUpload(uploadContext(t, 4*(services.MaxFileSize+multipartOverhead)))
+		assert.ErrorIs(t, err, models.ErrTooLarge)
+		assert.ErrorContains(t, err, "request body exceeds")
+	})
+}
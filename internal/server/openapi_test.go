@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/api"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	spec, err := openapi3.NewLoader().LoadFromData(api.Spec)
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate(t.Context()))
+	return spec
+}
+
+// newRoutedEngine sets up the real routes; the handlers are never called
+func newRoutedEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		panic(err)
+	}
+	SetupRoutes(r, &Application{
+		Logger:        zerolog.Nop(),
+		Auth:          NewAuthenticator(nil, false),
+		RateLimiter:   NewRateLimiter(nil, zerolog.Nop(), nil),
+		HealthHandler: NewHealthHandler(),
+	})
+	return r
+}
+
+func TestOpenAPI_CoversEveryRoute(t *testing.T) {
+	spec := loadSpec(t)
+
+	var routes []string
+	for _, route := range newRoutedEngine().Routes() {
+		path := route.Path
+		for _, segment := range strings.Split(path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				path = strings.Replace(path, segment, "{"+segment[1:]+"}", 1)
+			}
+		}
+		routes = append(routes, route.Method+" "+path)
+	}
+
+	var documented []string
+	for path, item := range spec.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	sort.Strings(routes)
+	sort.Strings(documented)
+	assert.Equal(t, routes, documented, "api/openapi.json is out of sync with SetupRoutes")
+}
+
+func TestOpenAPI_SchemasMatchTypes(t *testing.T) {
+	spec := loadSpec(t)
+
+	types := map[string]any{
+		"Song":            models.Song{},
+		"Job":             models.Job{},
+		"Match":           services.Match{},
+		"JobProgress":     services.JobProgress{},
+		"StreamMessage":   streamMessage{},
+		"BatchResult":     batchResult{},
+		"ComponentStatus": componentStatus{},
+		"Problem":         Problem{},
+	}
+	for name, value := range types {
+		t.Run(name, func(t *testing.T) {
+			schema := spec.Components.Schemas[name]
+			require.NotNil(t, schema, "schema %s is missing", name)
+
+			var fields, required []string
+			typ := reflect.TypeOf(value)
+			for i := range typ.NumField() {
+				field, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+				if field == "-" {
+					continue
+				}
+				fields = append(fields, field)
+				if opts != "omitempty" {
+					required = append(required, field)
+				}
+			}
+
+			var properties []string
+			for property := range schema.Value.Properties {
+				properties = append(properties, property)
+			}
+
+			assert.ElementsMatch(t, fields, properties, "properties")
+			assert.ElementsMatch(t, required, schema.Value.Required, "required properties")
+		})
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	r := newRoutedEngine()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, api.Spec, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/openapi.json"`)
+}
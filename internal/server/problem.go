@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+)
+
+// problemContentType is the media type of RFC 7807 error bodies
+const problemContentType = "application/problem+json"
+
+// Stable error codes, for clients to branch on instead of parsing messages
+const (
+	CodeNotFound          = "not_found"
+	CodeInvalidRequest    = "invalid_request"
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeTooLarge          = "too_large"
+	CodeDuplicate         = "duplicate"
+	CodeUnauthorized      = "unauthorized"
+	CodeInvalidAPIKey     = "invalid_api_key"
+	CodeForbidden         = "forbidden"
+	CodeRateLimited       = "rate_limited"
+	CodeQuotaExceeded     = "quota_exceeded"
+	CodeQueueFull         = "queue_full"
+	CodeShuttingDown      = "shutting_down"
+	CodeInternal          = "internal_error"
+)
+
+// Problem is an RFC 7807 error body. Code and the fields after it are extension
+// members; Type is derived from Code.
+type Problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Instance   string `json:"instance,omitempty"`
+	Code       string `json:"code"`
+	RequestID  string `json:"request_id,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // Seconds, on 429s
+	JobID      string `json:"job_id,omitempty"`      // The job a failed upload was recorded as
+}
+
+// problemKinds maps the domain errors to their status and code. The first match wins.
+var problemKinds = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{models.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{models.ErrValidation, http.StatusBadRequest, CodeInvalidRequest},
+	{models.ErrUnsupportedFormat, http.StatusUnsupportedMediaType, CodeUnsupportedFormat},
+	{models.ErrTooLarge, http.StatusRequestEntityTooLarge, CodeTooLarge},
+	{models.ErrDuplicate, http.StatusConflict, CodeDuplicate},
+	{services.ErrInvalidAPIKey, http.StatusUnauthorized, CodeInvalidAPIKey},
+	{services.ErrQueueFull, http.StatusServiceUnavailable, CodeQueueFull},
+	{services.ErrShuttingDown, http.StatusServiceUnavailable, CodeShuttingDown},
+}
+
+// errorCode returns the status and code err maps to, 500 for unknown errors
+func errorCode(err error) (int, string) {
+	for _, kind := range problemKinds {
+		if errors.Is(err, kind.err) {
+			return kind.status, kind.code
+		}
+	}
+	return http.StatusInternalServerError, CodeInternal
+}
+
+func newProblem(c *gin.Context, status int, code, detail string) Problem {
+	return Problem{
+		Type:      "urn:harmonia:error:" + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: c.Writer.Header().Get(RequestIDHeader),
+	}
+}
+
+// writeProblem ends the request with problem
+func writeProblem(c *gin.Context, problem Problem) {
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// abortWithProblem ends the request with an error that isn't a domain error,
+// such as a missing API key
+func abortWithProblem(c *gin.Context, status int, code, detail string) {
+	writeProblem(c, newProblem(c, status, code, detail))
+}
+
+// renderError ends the request with err as a problem. Domain errors are shown
+// to the client; anything else is a 500 whose cause is only logged.
+func renderError(c *gin.Context, err error) {
+	writeProblem(c, errorProblem(c, err))
+}
+
+func errorProblem(c *gin.Context, err error) Problem {
+	status, code := errorCode(err)
+	if status == http.StatusInternalServerError {
+		c.Error(err)
+		return newProblem(c, status, code, "")
+	}
+	return newProblem(c, status, code, err.Error())
+}
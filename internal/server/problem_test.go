@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/services"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"not found", models.Errorf(models.ErrNotFound, "song 7 not found"), http.StatusNotFound, CodeNotFound, "song 7 not found"},
+		{"validation", models.Errorf(models.ErrValidation, "title is required"), http.StatusBadRequest, CodeInvalidRequest, "title is required"},
+		{"unsupported format", models.Errorf(models.ErrUnsupportedFormat, "not a WAV file"), http.StatusUnsupportedMediaType, CodeUnsupportedFormat, "not a WAV file"},
+		{"too large", models.Errorf(models.ErrTooLarge, "file is too large"), http.StatusRequestEntityTooLarge, CodeTooLarge, "file is too large"},
+		{"duplicate", fmt.Errorf("error saving song: %w", models.Errorf(models.ErrDuplicate, "song 7 already exists")), http.StatusConflict, CodeDuplicate, "error saving song: song 7 already exists"},
+		{"queue full", services.ErrQueueFull, http.StatusServiceUnavailable, CodeQueueFull, "ingest queue is full"},
+		{"internal errors hide their cause", errors.New("pq: connection reset"), http.StatusInternalServerError, CodeInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(RequestLogger(zerolog.Nop()))
+			r.GET("/songs/:id", func(c *gin.Context) { renderError(c, tt.err) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/songs/7", nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, Problem{
+				Type:      "urn:harmonia:error:" + tt.code,
+				Title:     http.StatusText(tt.status),
+				Status:    tt.status,
+				Detail:    tt.detail,
+				Instance:  "/songs/7",
+				Code:      tt.code,
+				RequestID: w.Header().Get(RequestIDHeader),
+			}, problem)
+		})
+	}
+}
+
+func TestHandleAudioUpload_Problems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := NewMusicHandler(services.NewAudioService(), nil, nil, nil)
+	r.POST("/upload", handler.handleAudioUpload)
+
+	t.Run("missing file", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var problem Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, CodeInvalidRequest, problem.Code)
+		assert.Contains(t, problem.Detail, `"file" part is required`)
+	})
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/config"
+	"github.com/owenhochwald/harmonia/internal/metrics"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/ratelimit"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/rs/zerolog"
+)
+
+type scopeLimiter struct {
+	perKey     *ratelimit.Limiter
+	perIP      *ratelimit.Limiter
+	dailyQuota int
+}
+
+// RateLimiter throttles each scope's routes per client IP and per API key, and
+// enforces daily quotas per API key. Buckets live in memory, so each replica
+// limits on its own; quota counts are shared through the UsageRepo.
+type RateLimiter struct {
+	Usage  repo.UsageRepo
+	Logger zerolog.Logger
+
+	scopes map[models.Scope]scopeLimiter
+	now    func() time.Time
+}
+
+func NewRateLimiter(usage repo.UsageRepo, log zerolog.Logger, limits map[models.Scope]config.Limits) *RateLimiter {
+	scopes := make(map[models.Scope]scopeLimiter, len(limits))
+	for scope, l := range limits {
+		scopes[scope] = scopeLimiter{
+			perKey:     ratelimit.New(l.Rate, l.Burst),
+			perIP:      ratelimit.New(l.IPRate, l.IPBurst),
+			dailyQuota: l.DailyQuota,
+		}
+	}
+
+	return &RateLimiter{
+		Usage:  usage,
+		Logger: log,
+		scopes: scopes,
+		now:    time.Now,
+	}
+}
+
+// Limit answers 429 with Retry-After once a client exceeds the limits of scope.
+// It runs after Authenticator.Require, so the API key is known; without one
+// (authentication off) only the per-IP limit applies.
+func (l *RateLimiter) Limit(scope models.Scope) gin.HandlerFunc {
+	limits, ok := l.scopes[scope]
+	if !ok {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		if ok, wait := limits.perIP.Allow(c.ClientIP()); !ok {
+			tooManyRequests(c, scope, "ip", wait, "rate limit exceeded")
+			return
+		}
+
+		key := APIKeyFromContext(c)
+		if key == nil {
+			c.Next()
+			return
+		}
+
+		if ok, wait := limits.perKey.Allow(key.ID); !ok {
+			tooManyRequests(c, scope, "key", wait, "rate limit exceeded")
+			return
+		}
+
+		if limits.dailyQuota > 0 {
+			now := l.now().UTC()
+			used, err := l.Usage.IncrementUsage(c.Request.Context(), key.ID, scope, now)
+			if err != nil {
+				// Serve the request rather than fail every client while the database is away
+				l.Logger.Error().Err(err).Str("key_id", key.ID).Msg("failed to count API key usage")
+				c.Next()
+				return
+			}
+
+			remaining := max(limits.dailyQuota-used, 0)
+			c.Header("X-Quota-Limit", strconv.Itoa(limits.dailyQuota))
+			c.Header("X-Quota-Remaining", strconv.Itoa(remaining))
+			if used > limits.dailyQuota {
+				midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+				tooManyRequests(c, scope, "quota", midnight.Sub(now), "daily quota exceeded")
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func tooManyRequests(c *gin.Context, scope models.Scope, limit string, wait time.Duration, message string) {
+	metrics.RateLimited.WithLabelValues(string(scope), limit).Inc()
+
+	code := CodeRateLimited
+	if limit == "quota" {
+		code = CodeQuotaExceeded
+	}
+
+	seconds := max(int(math.Ceil(wait.Seconds())), 1)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	problem := newProblem(c, http.StatusTooManyRequests, code, message)
+	problem.RetryAfter = seconds
+	writeProblem(c, problem)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/config"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitedRouter(limiter *RateLimiter, key *models.APIKey) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/identify", func(c *gin.Context) {
+		if key != nil {
+			c.Set(apiKeyContextKey, key)
+		}
+	}, limiter.Limit(models.ScopeIdentify), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func get(r *gin.Engine, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/identify", nil)
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimiter_PerIP(t *testing.T) {
+	limiter := NewRateLimiter(repo.NewMockUsageRepo(), zerolog.Nop(), map[models.Scope]config.Limits{
+		models.ScopeIdentify: {IPRate: 1, IPBurst: 2},
+	})
+	r := newLimitedRouter(limiter, nil)
+
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.1").Code)
+
+	w := get(r, "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.2").Code, "other clients are unaffected")
+}
+
+func TestRateLimiter_ForwardedFor(t *testing.T) {
+	limits := map[models.Scope]config.Limits{models.ScopeIdentify: {IPRate: 0.1, IPBurst: 1}}
+	forwarded := func(r *gin.Engine, peer, client string) int {
+		req := httptest.NewRequest(http.MethodGet, "/identify", nil)
+		req.RemoteAddr = peer + ":1234"
+		req.Header.Set("X-Forwarded-For", client)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("made-up header from an untrusted peer", func(t *testing.T) {
+		r := newLimitedRouter(NewRateLimiter(nil, zerolog.Nop(), limits), nil)
+		require.NoError(t, r.SetTrustedProxies(nil))
+
+		assert.Equal(t, http.StatusOK, forwarded(r, "10.0.0.1", "192.0.2.1"))
+		assert.Equal(t, http.StatusTooManyRequests, forwarded(r, "10.0.0.1", "192.0.2.2"), "a new X-Forwarded-For doesn't get a new bucket")
+	})
+
+	t.Run("header set by a trusted proxy", func(t *testing.T) {
+		r := newLimitedRouter(NewRateLimiter(nil, zerolog.Nop(), limits), nil)
+		require.NoError(t, r.SetTrustedProxies([]string{"10.0.0.0/8"}))
+
+		assert.Equal(t, http.StatusOK, forwarded(r, "10.0.0.1", "192.0.2.1"))
+		assert.Equal(t, http.StatusOK, forwarded(r, "10.0.0.1", "192.0.2.2"), "clients behind the proxy are limited apart")
+		assert.Equal(t, http.StatusTooManyRequests, forwarded(r, "10.0.0.2", "192.0.2.1"))
+	})
+}
+
+func TestRateLimiter_PerKey(t *testing.T) {
+	limiter := NewRateLimiter(repo.NewMockUsageRepo(), zerolog.Nop(), map[models.Scope]config.Limits{
+		models.ScopeIdentify: {Rate: 0.1, Burst: 1},
+	})
+	r := newLimitedRouter(limiter, &models.APIKey{ID: "key-1"})
+
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.1").Code)
+
+	w := get(r, "10.0.0.2")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the key is limited from any IP")
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimiter_DailyQuota(t *testing.T) {
+	now := time.Date(2025, 6, 1, 22, 0, 0, 0, time.UTC)
+	usage := repo.NewMockUsageRepo()
+	limiter := NewRateLimiter(usage, zerolog.Nop(), map[models.Scope]config.Limits{
+		models.ScopeIdentify: {DailyQuota: 2},
+	})
+	limiter.now = func() time.Time { return now }
+	r := newLimitedRouter(limiter, &models.APIKey{ID: "key-1"})
+
+	usage.On("IncrementUsage", mock.Anything, "key-1", models.ScopeIdentify, now).Return(2, nil).Once()
+	w := get(r, "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-Quota-Remaining"))
+
+	usage.On("IncrementUsage", mock.Anything, "key-1", models.ScopeIdentify, now).Return(3, nil).Once()
+	w = get(r, "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "7200", w.Header().Get("Retry-After"), "until midnight UTC")
+	assert.JSONEq(t, `{"type": "urn:harmonia:error:quota_exceeded", "title": "Too Many Requests", "status": 429,
+		"detail": "daily quota exceeded", "instance": "/identify", "code": "quota_exceeded", "retry_after": 7200}`, w.Body.String())
+
+	usage.On("IncrementUsage", mock.Anything, "key-1", models.ScopeIdentify, now).Return(0, errors.New("connection refused")).Once()
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.1").Code, "usage errors don't block requests")
+	usage.AssertExpectations(t)
+}
@@ -1,12 +1,45 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/owenhochwald/harmonia/internal/metrics"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
 
 func SetupRoutes(r *gin.Engine, app *Application) {
-	r.GET("/health", app.HealthHandler.Check)
-	r.GET("/test-wave-upload", app.MusicHandler.handleTestWaveUpload)
+	r.MaxMultipartMemory = int64(app.Config.MaxMultipartMemory)
+	// Recovery sits inside the metrics middleware, so panics are counted as the 500s they become
+	r.Use(otelgin.Middleware(tracing.ServiceName), RequestLogger(app.Logger), metrics.Middleware(), Recovery())
 
-	r.POST("/api/upload", app.MusicHandler.handleAudioUpload)
-	r.GET("/api/songs", app.MusicHandler.handleGetSongs)
-	r.GET("/api/songs:id", app.MusicHandler.handleGetASong)
+	r.NoRoute(func(c *gin.Context) {
+		renderError(c, models.Errorf(models.ErrNotFound, "no route for %s %s", c.Request.Method, c.Request.URL.Path))
+	})
+
+	r.GET("/health", app.HealthHandler.Live)
+	r.GET("/livez", app.HealthHandler.Live)
+	r.GET("/readyz", app.HealthHandler.Ready)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	r.GET("/openapi.json", serveOpenAPI)
+	r.GET("/docs", serveDocs)
+
+	admin := r.Group("", app.Auth.Require(models.ScopeAdmin))
+	admin.GET("/test-wave-upload", app.MusicHandler.handleTestWaveUpload)
+
+	// Only the expensive routes are rate limited, not job polling or catalog reads
+	ingestLimit := app.RateLimiter.Limit(models.ScopeIngest)
+	identifyLimit := app.RateLimiter.Limit(models.ScopeIdentify)
+
+	ingest := r.Group("/api", app.Auth.Require(models.ScopeIngest))
+	ingest.POST("/upload", ingestLimit, app.MusicHandler.handleAudioUpload)
+	ingest.POST("/upload/batch", ingestLimit, app.MusicHandler.handleBatchUpload)
+	ingest.GET("/jobs/:id", app.JobHandler.handleGetJob)
+	ingest.GET("/jobs/:id/events", app.JobHandler.handleJobEvents)
+
+	identify := r.Group("/api", app.Auth.Require(models.ScopeIdentify))
+	identify.POST("/identify", identifyLimit, app.IdentifyHandler.handleIdentify)
+	identify.GET("/identify/stream", identifyLimit, app.IdentifyHandler.handleIdentifyStream)
+	identify.GET("/songs", app.MusicHandler.handleGetSongs)
+	identify.GET("/songs/:id", app.MusicHandler.handleGetASong)
 }
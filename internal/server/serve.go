@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Serve listens on the configured port until ctx is cancelled, then shuts down
+// within Config.ShutdownTimeout: it stops accepting connections, waits for
+// in-flight requests (so uploads finish being queued), closes job event streams
+// and drains the ingest workers. Closing the database is left to the caller.
+func (app *Application) Serve(ctx context.Context, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              ":" + app.Config.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: app.Config.HTTPReadHeaderTimeout,
+		ReadTimeout:       app.Config.HTTPReadTimeout,
+		WriteTimeout:      app.Config.HTTPWriteTimeout,
+		IdleTimeout:       app.Config.HTTPIdleTimeout,
+	}
+	srv.RegisterOnShutdown(app.JobHandler.Close)
+
+	listenErr := make(chan error, 1)
+	go func() {
+		app.Logger.Info().Str("addr", srv.Addr).Msg("listening")
+		listenErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	app.Logger.Info().Dur("timeout", app.Config.ShutdownTimeout).Msg("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.Config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		errs = append(errs, fmt.Errorf("http requests still running: %w", err))
+	}
+	if err := app.JobService.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
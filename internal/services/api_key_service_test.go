@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyService_Create(t *testing.T) {
+	t.Run("stores only the hash", func(t *testing.T) {
+		keyRepo := repo.NewMockAPIKeyRepo()
+		service := NewAPIKeyService(keyRepo)
+
+		var saved models.APIKey
+		keyRepo.On("SaveKey", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			saved = args.Get(1).(models.APIKey)
+		}).Return(nil).Once()
+
+		token, key, err := service.Create(ctx, APIKeySpec{
+			Name:   " mobile app ",
+			Scopes: []models.Scope{models.ScopeIngest, models.ScopeIdentify, models.ScopeIngest},
+		})
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(token, "hmn_"))
+		assert.Equal(t, "mobile app", key.Name)
+		assert.Equal(t, []models.Scope{models.ScopeIdentify, models.ScopeIngest}, key.Scopes)
+		assert.Equal(t, "global", key.TenantID)
+		assert.Equal(t, token[:len(key.Prefix)], key.Prefix)
+		assert.Equal(t, hashAPIKey(token), saved.Hash)
+		assert.NotContains(t, saved.Hash, token[len(key.Prefix):])
+		keyRepo.AssertExpectations(t)
+	})
+
+	t.Run("rejects unknown scopes", func(t *testing.T) {
+		service := NewAPIKeyService(repo.NewMockAPIKeyRepo())
+		_, _, err := service.Create(ctx, APIKeySpec{Name: "client", Scopes: []models.Scope{"delete"}})
+		assert.ErrorContains(t, err, "unknown scope")
+	})
+
+	t.Run("rejects invalid tenants", func(t *testing.T) {
+		service := NewAPIKeyService(repo.NewMockAPIKeyRepo())
+		_, _, err := service.Create(ctx, APIKeySpec{Name: "client", Scopes: []models.Scope{models.ScopeIngest}, TenantID: "Acme Records"})
+		assert.ErrorContains(t, err, "invalid tenant")
+	})
+
+	t.Run("requires a scope", func(t *testing.T) {
+		service := NewAPIKeyService(repo.NewMockAPIKeyRepo())
+		_, _, err := service.Create(ctx, APIKeySpec{Name: "client"})
+		assert.Error(t, err)
+	})
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	token := "hmn_" + strings.Repeat("ab", 32)
+	revokedAt := time.Now()
+
+	tests := []struct {
+		name    string
+		token   string
+		found   *models.APIKey
+		findErr error
+		wantErr error
+	}{
+		{name: "active key", token: token, found: &models.APIKey{ID: "key-1", Scopes: []models.Scope{models.ScopeIdentify}}},
+		{name: "unknown key", token: token, wantErr: ErrInvalidAPIKey},
+		{name: "revoked key", token: token, found: &models.APIKey{ID: "key-1", RevokedAt: &revokedAt}, wantErr: ErrInvalidAPIKey},
+		{name: "not a harmonia key", token: "Bearer nonsense", wantErr: ErrInvalidAPIKey},
+		{name: "database error", token: token, findErr: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyRepo := repo.NewMockAPIKeyRepo()
+			keyRepo.On("FindByHash", mock.Anything, hashAPIKey(tt.token)).Return(tt.found, tt.findErr).Maybe()
+			service := NewAPIKeyService(keyRepo)
+
+			key, err := service.Authenticate(ctx, tt.token)
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.findErr != nil:
+				assert.ErrorIs(t, err, tt.findErr)
+				assert.NotErrorIs(t, err, ErrInvalidAPIKey)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, "key-1", key.ID)
+			}
+		})
+	}
+}
@@ -2,21 +2,30 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math"
-	"net/http"
 	"time"
 
 	"github.com/mjibson/go-dsp/fft"
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tracing"
 	"github.com/youpy/go-wav"
 	"github.com/zeozeozeo/gomplerate"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// MaxFileSize is the largest audio file accepted for ingest
+const MaxFileSize = 10 * 1024 * 1024
+
 type AudioServiceInterface interface {
-	ValidateFile(r *bytes.Reader) (error, int)
+	ValidateFile(r *bytes.Reader) error
 	Process(raw []byte) (*AudioData, error)
+	Analyze(ctx context.Context, data []byte, progress ProgressFunc) (*Spectrogram, error)
 	ReadWAVProperties(r *bytes.Reader) (*AudioMetadata, error)
 	ConvertToMono(data []byte) ([]byte, error)
 	Resample(data []byte, targetSampleRate uint32) ([]byte, error)
@@ -65,6 +74,7 @@ type Spectrogram struct {
 	FrequencyBins []float64
 	TimeFrames    []float64
 	SampleRate    uint32
+	NumSamples    int
 }
 
 func (a *AudioService) Process(raw []byte) (*AudioData, error) {
@@ -100,23 +110,113 @@ func (a *AudioService) Process(raw []byte) (*AudioData, error) {
 	return a.Data, nil
 }
 
-func (a *AudioService) ValidateFile(r *bytes.Reader) (error, int) {
+// Analyze takes a WAV file through decode, mono, resample, normalize and spectrogram,
+// reporting each finished stage to progress.
+func (a *AudioService) Analyze(ctx context.Context, data []byte, progress ProgressFunc) (spectrogram *Spectrogram, err error) {
+	ctx, span := tracing.Start(ctx, "AudioService.Analyze", attribute.Int("bytes", len(data)))
+	defer func() { tracing.End(span, err) }()
+
+	started := time.Now()
+	metadata, err := a.ReadWAVProperties(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error getting wav file metadata: %w", err)
+	}
+	progress.report(ctx, StageDecode, int(metadata.TotalSamples), 0, started)
+
+	started = time.Now()
+	processed, err := a.ConvertToMono(data)
+	if err != nil {
+		return nil, fmt.Errorf("error converting wav file: %w", err)
+	}
+	progress.report(ctx, StageMono, a.countSamples(processed), 0, started)
+
+	started = time.Now()
+	processed, err = a.Resample(processed, TargetSampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("error resampling wav file: %w", err)
+	}
+	progress.report(ctx, StageResample, a.countSamples(processed), 0, started)
+
+	started = time.Now()
+	processed, err = a.Normalize(processed)
+	if err != nil {
+		return nil, fmt.Errorf("error normalizing wav file: %w", err)
+	}
+	progress.report(ctx, StageNormalize, a.countSamples(processed), 0, started)
+
+	started = time.Now()
+	spectrogram, err = a.Spectrogram(processed, SpectrogramWindow, SpectrogramHop)
+	if err != nil {
+		return nil, fmt.Errorf("error getting spectrogram for wav file: %w", err)
+	}
+	progress.report(ctx, StageSpectrogram, spectrogram.NumSamples, len(spectrogram.Data), started)
+
+	return spectrogram, nil
+}
+
+// countSamples is only used for progress reports, so a bad header counts as zero
+func (a *AudioService) countSamples(data []byte) int {
+	samples, err := a.GetTotalSamples(data)
+	if err != nil {
+		return 0
+	}
+	return samples
+}
+
+// ValidateFile checks an upload is a PCM WAV file no larger than MaxFileSize
+func (a *AudioService) ValidateFile(r *bytes.Reader) error {
 	if r.Len() == 0 {
-		return fmt.Errorf("empty file"), http.StatusBadRequest
+		return models.Errorf(models.ErrValidation, "empty file")
 	}
-	const maxFileSize = 10 * 1024 * 1024
-	if int64(r.Len()) > maxFileSize {
-		return fmt.Errorf("file is too large"), http.StatusBadRequest
+	if int64(r.Len()) > MaxFileSize {
+		return models.Errorf(models.ErrTooLarge, "file is too large")
 	}
 	wavReader := wav.NewReader(r)
 	format, err := wavReader.Format()
 	if err != nil {
-		return fmt.Errorf("error reading WAV format: %w", err), http.StatusInternalServerError
+		return models.Errorf(models.ErrUnsupportedFormat, "error reading WAV format: %w", err)
 	}
 	if format.AudioFormat != wav.AudioFormatPCM {
-		return fmt.Errorf("unsupported audio format: %d", format.AudioFormat), http.StatusBadRequest
+		return models.Errorf(models.ErrUnsupportedFormat, "unsupported audio format: %d", format.AudioFormat)
+	}
+	return nil
+}
+
+// PCMHash identifies a WAV file by the SHA-256 of its format and decoded samples.
+// Unlike ContentHash it ignores tags and other chunks, so the same recording
+// re-saved with new metadata hashes alike.
+func PCMHash(data []byte) (string, error) {
+	wavReader := wav.NewReader(bytes.NewReader(data))
+	format, err := wavReader.Format()
+	if err != nil {
+		return "", models.Errorf(models.ErrUnsupportedFormat, "error reading WAV format: %w", err)
+	}
+
+	hash := sha256.New()
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint16(header[0:], format.NumChannels)
+	binary.LittleEndian.PutUint32(header[2:], format.SampleRate)
+	binary.LittleEndian.PutUint16(header[6:], format.BitsPerSample)
+	hash.Write(header)
+
+	value := make([]byte, 4)
+	for {
+		samples, err := wavReader.ReadSamples()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read samples: %w", err)
+		}
+		for _, sample := range samples {
+			for ch := uint(0); ch < uint(format.NumChannels); ch++ {
+				binary.LittleEndian.PutUint32(value, uint32(int32(wavReader.IntValue(sample, ch))))
+				hash.Write(value)
+			}
+		}
 	}
-	return nil, http.StatusOK
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func (a *AudioService) GetTotalSamples(data []byte) (int, error) {
@@ -501,5 +601,6 @@ func (a *AudioService) Spectrogram(data []byte, windowSize, hopSize int) (*Spect
 		FrequencyBins: frequencyBins,
 		TimeFrames:    timeFrames,
 		SampleRate:    format.SampleRate,
+		NumSamples:    len(samples),
 	}, nil
 }
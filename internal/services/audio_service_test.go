@@ -2,12 +2,13 @@ package services
 
 import (
 	"bytes"
-	"io"
+	"fmt"
 	"math"
-	"net/http"
-	"os"
+	"math/rand"
 	"testing"
 
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/testaudio"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/youpy/go-wav"
@@ -17,48 +18,32 @@ func TestValidateFile(t *testing.T) {
 	service := AudioService{}
 
 	t.Run("valid WAV file", func(t *testing.T) {
-		// TODO: join with curr dir for relative path rather than an absolute path
-		audioFile := "/Users/owenhochwald/Documents/code/personal/backend/go/harmonia/public/audios/sample-12s.wav"
-		file, err := os.Open(audioFile)
-		if err != nil {
-			t.Skipf("Audio file not found - skipping test")
-		}
-
-		data, _ := io.ReadAll(file)
-		reader := bytes.NewReader(data)
+		data := testaudio.WAV(t, testaudio.CDStereo, testaudio.Melody(44100, 2, 1), testaudio.Melody(44100, 2, 2))
 
-		err, code := service.ValidateFile(reader)
+		err := service.ValidateFile(bytes.NewReader(data))
 
-		assert.Nil(t, err)
-		assert.Equal(t, 200, code)
+		assert.NoError(t, err)
 	})
 
 	t.Run("wrong file type", func(t *testing.T) {
-		audioFile := "/Users/owenhochwald/Documents/code/personal/backend/go/harmonia/README.md"
-		file, err := os.Open(audioFile)
-		if err != nil {
-			t.Skipf("Audio file not found - skipping test")
-		}
-
-		data, _ := io.ReadAll(file)
-		reader := bytes.NewReader(data)
+		data := []byte("# Harmonia\n\nNot a RIFF file, just some markdown.\n")
 
-		err, code := service.ValidateFile(reader)
+		err := service.ValidateFile(bytes.NewReader(data))
 
 		assert.Error(t, err)
 		assert.ErrorContains(t, err, "error reading WAV format")
-		assert.Equal(t, http.StatusInternalServerError, code)
+		assert.ErrorIs(t, err, models.ErrUnsupportedFormat)
 	})
 
 	t.Run("file too large", func(t *testing.T) {
 		data := make([]byte, 11*1024*1024)
 		reader := bytes.NewReader(data)
 
-		err, code := service.ValidateFile(reader)
+		err := service.ValidateFile(reader)
 
 		assert.Error(t, err)
 		assert.ErrorContains(t, err, "file is too large")
-		assert.Equal(t, http.StatusBadRequest, code)
+		assert.ErrorIs(t, err, models.ErrTooLarge)
 	})
 }
 
@@ -109,6 +94,32 @@ func TestConvertToMono(t *testing.T) {
 	})
 }
 
+func TestPCMHash(t *testing.T) {
+	samples := testaudio.Chord(16000, 1, 440, 1200)
+	original := testaudio.WAV(t, testaudio.Mono16k, samples)
+
+	hash, err := PCMHash(original)
+	require.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	tagged := withInfoTags(original, map[string]string{"INAM": "Retitled"})
+	require.NotEqual(t, ContentHash(original), ContentHash(tagged))
+	taggedHash, err := PCMHash(tagged)
+	require.NoError(t, err)
+	assert.Equal(t, hash, taggedHash, "tags don't change the audio")
+
+	louder := make([]float64, len(samples))
+	for i, sample := range samples {
+		louder[i] = sample * 0.9
+	}
+	otherHash, err := PCMHash(testaudio.WAV(t, testaudio.Mono16k, louder))
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, otherHash)
+
+	_, err = PCMHash([]byte("not a wav file"))
+	assert.ErrorIs(t, err, models.ErrUnsupportedFormat)
+}
+
 func TestResample(t *testing.T) {
 	service := NewAudioService()
 
@@ -331,20 +342,35 @@ func TestProcess(t *testing.T) {
 	})
 }
 
-func TestWithRealFile(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping real file test")
-	}
-
-	data, err := os.ReadFile("testdata/test.wav")
-	if err != nil {
-		t.Skip("No test file found")
-	}
-
+func TestAnalyze_Formats(t *testing.T) {
 	service := NewAudioService()
-	result, err := service.Process(data)
-	require.NoError(t, err)
-	require.NotNil(t, result)
-
-	t.Logf("Processed: %+v", result.Metadata)
+	rng := rand.New(rand.NewSource(1))
+	binWidth := float64(TargetSampleRate) / SpectrogramWindow
+
+	// Only 16 bit input: Resample truncates other depths to 16 bits rather than
+	// rescaling them, and fixing that changes the fingerprints of stored songs
+	for _, rate := range []int{8000, 16000, 22050, 44100, 48000} {
+		for _, channels := range []int{1, 2} {
+			format := testaudio.Format{SampleRate: rate, BitDepth: 16, Channels: channels}
+			frequency := 300 + rng.Float64()*3200
+
+			t.Run(fmt.Sprintf("%dHz %dch", rate, channels), func(t *testing.T) {
+				data := testaudio.WAV(t, format, testaudio.Sine(rate, 1, frequency, 0.5))
+
+				spec, err := service.Analyze(ctx, data, nil)
+				require.NoError(t, err)
+				assert.Equal(t, uint32(TargetSampleRate), spec.SampleRate)
+				assert.InDelta(t, TargetSampleRate, spec.NumSamples, 100)
+
+				frame := spec.Data[len(spec.Data)/2]
+				peakBin := 0
+				for i, mag := range frame {
+					if mag > frame[peakBin] {
+						peakBin = i
+					}
+				}
+				assert.InDelta(t, frequency, spec.FrequencyBins[peakBin], 2*binWidth)
+			})
+		}
+	}
 }
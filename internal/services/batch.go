@@ -0,0 +1,322 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+)
+
+const (
+	// MaxBatchFiles caps how many audio files a single batch may contain
+	MaxBatchFiles = 100
+	// MaxBatchSize caps the audio bytes of a batch, summed over its files
+	MaxBatchSize = 256 << 20
+)
+
+// Manifest maps audio file names to the song metadata they should be ingested with
+type Manifest map[string]models.Song
+
+type manifestEntry struct {
+	Filename string `json:"filename"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Year     int    `json:"year"`
+}
+
+// BatchFile is a file of a batch upload, an uploaded part or a ZIP member. Its
+// content is only read when needed, so a batch never holds every file in memory.
+type BatchFile struct {
+	Name string
+	Size int64 // As declared by the client or the archive, checked again while reading
+	Open func() (io.ReadCloser, error)
+}
+
+// ReadAll reads the file, failing with ErrTooLarge when it holds more than limit bytes
+func (f BatchFile) ReadAll(limit int64) ([]byte, error) {
+	if f.Size > limit {
+		return nil, errEntryTooLarge
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	// Don't trust the declared size, cap what we actually read
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, errEntryTooLarge
+	}
+
+	return content, nil
+}
+
+// Batch is the audio files of a batch upload and its manifest. Read returns one
+// file at a time and stops once MaxBatchSize bytes have been read across them.
+type Batch struct {
+	Files    []BatchFile
+	Manifest *BatchFile
+
+	remaining int64
+}
+
+// NewBatch checks the batch's file count, names and declared size before any
+// file is read
+func NewBatch(files []BatchFile, manifest *BatchFile) (*Batch, error) {
+	if len(files) > MaxBatchFiles {
+		return nil, models.Errorf(models.ErrTooLarge, "a batch can contain at most %d files", MaxBatchFiles)
+	}
+
+	seen := make(map[string]bool, len(files))
+	var total int64
+	for _, file := range files {
+		if seen[file.Name] {
+			return nil, models.Errorf(models.ErrValidation, "batch contains %q more than once", file.Name)
+		}
+		seen[file.Name] = true
+
+		// Oversized files are rejected on their own without being read
+		if file.Size <= MaxFileSize {
+			total += file.Size
+		}
+	}
+	if total > MaxBatchSize {
+		return nil, models.Errorf(models.ErrTooLarge, "batch holds %d bytes of audio, the limit is %d", total, MaxBatchSize)
+	}
+
+	return &Batch{Files: files, Manifest: manifest, remaining: MaxBatchSize}, nil
+}
+
+var errBatchTooLarge = models.Errorf(models.ErrTooLarge, "batch exceeds %d bytes of audio", MaxBatchSize)
+
+// Read reads one file of the batch, failing with ErrTooLarge past MaxFileSize or
+// once the batch has used up MaxBatchSize
+func (b *Batch) Read(file BatchFile) ([]byte, error) {
+	if b.remaining <= 0 {
+		return nil, errBatchTooLarge
+	}
+
+	content, err := file.ReadAll(min(MaxFileSize, b.remaining))
+	if errors.Is(err, errEntryTooLarge) && file.Size <= MaxFileSize && b.remaining < MaxFileSize {
+		// Within MaxFileSize, too large only for what the batch has left
+		b.remaining = 0
+		return nil, errBatchTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b.remaining -= int64(len(content))
+	return content, nil
+}
+
+// Lookup finds the metadata for a file by its path in the batch. Files missing
+// from the manifest, or listed without a title, artist or valid year, fail with
+// a validation error so they are rejected when the batch is accepted.
+func (m Manifest) Lookup(filename string) (models.Song, error) {
+	song, ok := m[CleanBatchPath(filename)]
+	if !ok {
+		return song, models.Errorf(models.ErrValidation, "file is not listed in the manifest")
+	}
+	if err := validateSongMetadata(song); err != nil {
+		return song, err
+	}
+	return song, nil
+}
+
+// CleanBatchPath normalizes the path of a file in a batch, so "a/./b.wav" and
+// "a\b.wav" both name "a/b.wav"
+func CleanBatchPath(name string) string {
+	return path.Clean(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+}
+
+// ParseManifest reads a CSV or JSON manifest. The format is taken from the file
+// extension and falls back to sniffing the content. File names are full paths
+// relative to the manifest's directory, so a manifest bundled as album/manifest.csv
+// lists album/one.wav as one.wav.
+func ParseManifest(name string, data []byte) (Manifest, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, models.Errorf(models.ErrValidation, "manifest is empty")
+	}
+
+	var entries []manifestEntry
+	var err error
+	switch {
+	case strings.EqualFold(path.Ext(name), ".json"):
+		entries, err = parseJSONManifest(trimmed)
+	case strings.EqualFold(path.Ext(name), ".csv"):
+		entries, err = parseCSVManifest(trimmed)
+	case trimmed[0] == '[' || trimmed[0] == '{':
+		entries, err = parseJSONManifest(trimmed)
+	default:
+		entries, err = parseCSVManifest(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buildManifest(path.Dir(CleanBatchPath(name)), entries)
+}
+
+// parseJSONManifest accepts either a list of entries or an object keyed by filename
+func parseJSONManifest(data []byte) ([]manifestEntry, error) {
+	var entries []manifestEntry
+
+	if data[0] == '{' {
+		var byName map[string]manifestEntry
+		if err := json.Unmarshal(data, &byName); err != nil {
+			return nil, models.Errorf(models.ErrValidation, "invalid JSON manifest: %w", err)
+		}
+		for filename, entry := range byName {
+			entry.Filename = filename
+			entries = append(entries, entry)
+		}
+	} else if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, models.Errorf(models.ErrValidation, "invalid JSON manifest: %w", err)
+	}
+
+	return entries, nil
+}
+
+func parseCSVManifest(data []byte) ([]manifestEntry, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, models.Errorf(models.ErrValidation, "invalid CSV manifest: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, models.Errorf(models.ErrValidation, "CSV manifest needs a header row and at least one entry")
+	}
+
+	columns := make(map[string]int)
+	for i, header := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	for _, required := range []string{"filename", "title", "artist"} {
+		if _, ok := columns[required]; !ok {
+			return nil, models.Errorf(models.ErrValidation, "CSV manifest is missing the %q column", required)
+		}
+	}
+
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	entries := make([]manifestEntry, 0, len(records)-1)
+	for line, record := range records[1:] {
+		entry := manifestEntry{
+			Filename: field(record, "filename"),
+			Title:    field(record, "title"),
+			Artist:   field(record, "artist"),
+			Album:    field(record, "album"),
+		}
+		if year := field(record, "year"); year != "" {
+			entry.Year, err = strconv.Atoi(year)
+			if err != nil {
+				return nil, models.Errorf(models.ErrValidation, "CSV manifest line %d: invalid year %q", line+2, year)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// buildManifest keys entries by their path in the batch, dir joined with the
+// filename they list
+func buildManifest(dir string, entries []manifestEntry) (Manifest, error) {
+	manifest := make(Manifest, len(entries))
+
+	for _, entry := range entries {
+		filename := CleanBatchPath(entry.Filename)
+		if filename == "." {
+			return nil, models.Errorf(models.ErrValidation, "manifest entry is missing a filename")
+		}
+		if path.IsAbs(filename) || filename == ".." || strings.HasPrefix(filename, "../") {
+			return nil, models.Errorf(models.ErrValidation, "manifest filename %q must be a relative path", entry.Filename)
+		}
+
+		name := path.Join(dir, filename)
+		if _, exists := manifest[name]; exists {
+			return nil, models.Errorf(models.ErrValidation, "manifest lists %q more than once", name)
+		}
+
+		manifest[name] = models.Song{
+			Title:  strings.TrimSpace(entry.Title),
+			Artist: strings.TrimSpace(entry.Artist),
+			Album:  strings.TrimSpace(entry.Album),
+			Year:   entry.Year,
+		}
+	}
+
+	return manifest, nil
+}
+
+// ExtractZip lists the audio files inside a ZIP archive along with the manifest
+// file if one is bundled (manifest.csv or manifest.json at any depth). Nothing is
+// decompressed until a file is read, and r must stay open until then.
+func ExtractZip(r io.ReaderAt, size int64) (files []BatchFile, manifest *BatchFile, err error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, models.Errorf(models.ErrUnsupportedFormat, "invalid zip archive: %w", err)
+	}
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || isHiddenPath(entry.Name) {
+			continue
+		}
+
+		base := strings.ToLower(path.Base(entry.Name))
+		isManifest := base == "manifest.csv" || base == "manifest.json"
+		if !isManifest && path.Ext(base) != ".wav" {
+			continue
+		}
+
+		file := BatchFile{
+			Name: CleanBatchPath(entry.Name),
+			Size: int64(min(entry.UncompressedSize64, math.MaxInt64)),
+			Open: entry.Open,
+		}
+		if isManifest {
+			manifest = &file
+			continue
+		}
+
+		if len(files) >= MaxBatchFiles {
+			return nil, nil, models.Errorf(models.ErrTooLarge, "archive contains more than %d audio files", MaxBatchFiles)
+		}
+		files = append(files, file)
+	}
+
+	return files, manifest, nil
+}
+
+var errEntryTooLarge = models.Errorf(models.ErrTooLarge, "file is too large")
+
+func isHiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
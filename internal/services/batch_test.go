@@ -0,0 +1,207 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseManifest(t *testing.T) {
+	expected := Manifest{
+		"one.wav": {Title: "One", Artist: "Band", Album: "Album", Year: 2020},
+		"two.wav": {Title: "Two", Artist: "Band", Album: "Album", Year: 2021},
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		data := "filename,title,artist,album,year\none.wav,One,Band,Album,2020\n./two.wav,Two,Band,Album,2021\n"
+		manifest, err := ParseManifest("manifest.csv", []byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, expected, manifest)
+	})
+
+	t.Run("JSON list", func(t *testing.T) {
+		data := `[{"filename":"one.wav","title":"One","artist":"Band","album":"Album","year":2020},
+			{"filename":"two.wav","title":"Two","artist":"Band","album":"Album","year":2021}]`
+		manifest, err := ParseManifest("manifest.json", []byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, expected, manifest)
+	})
+
+	t.Run("JSON object sniffed without extension", func(t *testing.T) {
+		data := `{"one.wav":{"title":"One","artist":"Band","album":"Album","year":2020},
+			"two.wav":{"title":"Two","artist":"Band","album":"Album","year":2021}}`
+		manifest, err := ParseManifest("manifest", []byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, expected, manifest)
+	})
+
+	t.Run("lookup uses the full path", func(t *testing.T) {
+		song, err := expected.Lookup("./one.wav")
+		require.NoError(t, err)
+		assert.Equal(t, models.Song{Title: "One", Artist: "Band", Album: "Album", Year: 2020}, song)
+
+		_, err = expected.Lookup("album/one.wav")
+		assert.ErrorContains(t, err, "not listed in the manifest", "a file of the same name in another directory is a different file")
+	})
+
+	t.Run("paths are relative to a bundled manifest", func(t *testing.T) {
+		data := "filename,title,artist,year\none.wav,One,Band,2020\ndisc2/one.wav,One Again,Band,2020\n"
+		manifest, err := ParseManifest("album/manifest.csv", []byte(data))
+		require.NoError(t, err)
+
+		song, err := manifest.Lookup("album/one.wav")
+		require.NoError(t, err)
+		assert.Equal(t, "One", song.Title)
+		song, err = manifest.Lookup("album/disc2/one.wav")
+		require.NoError(t, err)
+		assert.Equal(t, "One Again", song.Title)
+	})
+
+	t.Run("lookup rejects incomplete entries", func(t *testing.T) {
+		data := "filename,title,artist,year\nno-year.wav,One,Band,\nzero-year.wav,Two,Band,0\nno-title.wav,,Band,2020\n"
+		manifest, err := ParseManifest("manifest.csv", []byte(data))
+		require.NoError(t, err, "one bad row doesn't reject the batch")
+
+		for name, want := range map[string]string{
+			"no-year.wav":   "year must be between 1800",
+			"zero-year.wav": "year must be between 1800",
+			"no-title.wav":  "title is required",
+		} {
+			_, err := manifest.Lookup(name)
+			assert.ErrorIs(t, err, models.ErrValidation, name)
+			assert.ErrorContains(t, err, want, name)
+		}
+	})
+
+	t.Run("paths outside the batch", func(t *testing.T) {
+		_, err := ParseManifest("manifest.csv", []byte("filename,title,artist\n../one.wav,One,Band\n"))
+		assert.ErrorContains(t, err, "must be a relative path")
+	})
+
+	t.Run("CSV missing column", func(t *testing.T) {
+		_, err := ParseManifest("manifest.csv", []byte("filename,title\none.wav,One\n"))
+		assert.ErrorContains(t, err, `missing the "artist" column`)
+	})
+
+	t.Run("CSV invalid year", func(t *testing.T) {
+		_, err := ParseManifest("manifest.csv", []byte("filename,title,artist,year\none.wav,One,Band,soon\n"))
+		assert.ErrorContains(t, err, "line 2: invalid year")
+	})
+
+	t.Run("duplicate filename", func(t *testing.T) {
+		_, err := ParseManifest("manifest.csv", []byte("filename,title,artist\na/one.wav,One,Band\na/./one.wav,Again,Band\n"))
+		assert.ErrorContains(t, err, "more than once")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := ParseManifest("manifest.json", []byte("  "))
+		assert.ErrorContains(t, err, "manifest is empty")
+	})
+}
+
+func createTestZip(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := writer.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestExtractZip(t *testing.T) {
+	t.Run("audio files and bundled manifest", func(t *testing.T) {
+		data := createTestZip(t, map[string][]byte{
+			"album/one.wav":            []byte("one"),
+			"album/two.WAV":            []byte("two"),
+			"album/manifest.csv":       []byte("filename,title,artist\n"),
+			"album/cover.jpg":          []byte("jpg"),
+			"__MACOSX/album/._one.wav": []byte("junk"),
+		})
+
+		files, manifest, err := ExtractZip(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.NotNil(t, manifest)
+		assert.Equal(t, "album/manifest.csv", manifest.Name)
+
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		assert.ElementsMatch(t, []string{"album/one.wav", "album/two.WAV"}, names)
+
+		content, err := manifest.ReadAll(MaxFileSize)
+		require.NoError(t, err)
+		assert.Equal(t, "filename,title,artist\n", string(content))
+	})
+
+	t.Run("invalid archive", func(t *testing.T) {
+		_, _, err := ExtractZip(bytes.NewReader([]byte("not a zip")), 9)
+		assert.ErrorContains(t, err, "invalid zip archive")
+	})
+}
+
+// memoryFile is a batch file whose declared size may differ from its content
+func memoryFile(name string, size int64, content []byte) BatchFile {
+	return BatchFile{Name: name, Size: size, Open: func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}}
+}
+
+func TestBatch(t *testing.T) {
+	t.Run("oversized file is rejected on its own", func(t *testing.T) {
+		big := memoryFile("big.wav", MaxFileSize+1, nil)
+		small := memoryFile("small.wav", 5, []byte("small"))
+		batch, err := NewBatch([]BatchFile{big, small}, nil)
+		require.NoError(t, err)
+
+		_, err = batch.Read(big)
+		assert.ErrorIs(t, err, models.ErrTooLarge)
+		data, err := batch.Read(small)
+		require.NoError(t, err)
+		assert.Equal(t, "small", string(data))
+	})
+
+	t.Run("declared size is not trusted", func(t *testing.T) {
+		liar := memoryFile("liar.wav", 1, make([]byte, MaxFileSize+1))
+		batch, err := NewBatch([]BatchFile{liar}, nil)
+		require.NoError(t, err)
+
+		_, err = batch.Read(liar)
+		assert.ErrorIs(t, err, models.ErrTooLarge)
+	})
+
+	t.Run("stops reading past the batch limit", func(t *testing.T) {
+		// Each declares one byte, so the batch passes NewBatch
+		var files []BatchFile
+		for i := 0; i*MaxFileSize <= MaxBatchSize; i++ {
+			files = append(files, memoryFile(fmt.Sprintf("%d.wav", i), 1, make([]byte, MaxFileSize)))
+		}
+		batch, err := NewBatch(files, nil)
+		require.NoError(t, err)
+
+		read := 0
+		for _, file := range files {
+			if _, err := batch.Read(file); err != nil {
+				assert.ErrorContains(t, err, "batch exceeds")
+				continue
+			}
+			read++
+		}
+		assert.Equal(t, MaxBatchSize/MaxFileSize, read)
+	})
+
+	t.Run("rejects a file named twice", func(t *testing.T) {
+		_, err := NewBatch([]BatchFile{memoryFile("a.wav", 1, nil), memoryFile("a.wav", 1, nil)}, nil)
+		assert.ErrorIs(t, err, models.ErrValidation)
+	})
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DuplicateAction is what HandleUpload does with a near-duplicate upload
+type DuplicateAction string
+
+const (
+	// DuplicateReject fails the upload with a *DuplicateError
+	DuplicateReject DuplicateAction = "reject"
+	// DuplicateFlag saves the song with DuplicateOf set to the song it matched
+	DuplicateFlag DuplicateAction = "flag"
+)
+
+// DuplicatePolicy configures duplicate detection on ingest. Uploads whose decoded
+// audio is identical to a catalog song are always rejected; a near-duplicate is an
+// upload whose fingerprints are at least Threshold covered by a catalog song, such
+// as a re-encode or the same track under new metadata.
+type DuplicatePolicy struct {
+	Threshold float64 // Coverage from 0 to 1, 0 disables the fingerprint check
+	Action    DuplicateAction
+}
+
+// DefaultDuplicatePolicy rejects uploads half covered by a catalog song. Clips of
+// other songs rarely pass a few percent, re-encodes of the same track most of it.
+func DefaultDuplicatePolicy() DuplicatePolicy {
+	return DuplicatePolicy{Threshold: 0.5, Action: DuplicateReject}
+}
+
+// DuplicateError rejects an upload of a song the catalog already holds. It
+// matches models.ErrDuplicate with errors.Is.
+type DuplicateError struct {
+	SongID   string
+	Coverage float64 // Share of the upload's fingerprints aligning with SongID
+	Exact    bool    // The decoded audio is identical
+}
+
+func (e *DuplicateError) Error() string {
+	if e.Exact {
+		return fmt.Sprintf("duplicate of song %s: identical audio", e.SongID)
+	}
+	return fmt.Sprintf("duplicate of song %s: %.0f%% of fingerprints match", e.SongID, e.Coverage*100)
+}
+
+func (e *DuplicateError) Is(target error) bool {
+	return target == models.ErrDuplicate
+}
+
+// findExactDuplicate returns the catalog song with the same decoded audio, if any
+func (s *MusicService) findExactDuplicate(ctx context.Context, pcmHash string) (*models.Song, error) {
+	song, err := s.Repo.FindByPCMHash(ctx, pcmHash)
+	if err != nil {
+		return nil, fmt.Errorf("error checking for identical audio: %w", err)
+	}
+	return song, nil
+}
+
+// findNearDuplicate returns the best match for fingerprints when it covers at least
+// the policy's threshold of them, nil when the check is off or nothing does
+func (s *MusicService) findNearDuplicate(ctx context.Context, fingerprints []models.Fingerprint) (*Match, error) {
+	if s.Duplicates.Threshold <= 0 || len(fingerprints) == 0 {
+		return nil, nil
+	}
+
+	// Only the tenant's own catalog counts, a label may ingest a track the global
+	// catalog also has
+	ctx = tenant.With(ctx, tenant.From(ctx), false)
+	ctx, span := tracing.Start(ctx, "MusicService.findNearDuplicate", attribute.Float64("threshold", s.Duplicates.Threshold))
+	matches, err := s.FingerprintService.MatchFingerprints(ctx, fingerprints)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("error matching against the catalog: %w", err)
+	}
+
+	if len(matches) == 0 || matches[0].Confidence < s.Duplicates.Threshold {
+		return nil, nil
+	}
+	return &matches[0], nil
+}
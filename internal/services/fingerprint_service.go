@@ -1,12 +1,22 @@
 package services
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
 	"github.com/owenhochwald/harmonia/internal/models"
 	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type FingerprintServiceInterface interface {
-	GenerateFingerprints(spec *Spectrogram) ([]models.Fingerprint, error)
+	GenerateFingerprints(ctx context.Context, spec *Spectrogram, progress ProgressFunc) ([]models.Fingerprint, error)
+	SaveFingerprints(ctx context.Context, songID string, fingerprints []models.Fingerprint) error
+	MatchFingerprints(ctx context.Context, query []models.Fingerprint) ([]Match, error)
 }
 
 type FingerprintService struct {
@@ -24,6 +34,16 @@ type Peak struct {
 	Magnitude float64
 }
 
+// Match is a catalog song whose fingerprints line up with a query
+type Match struct {
+	SongID       string       `json:"song_id"`
+	Song         *models.Song `json:"song,omitempty"`
+	Score        int          `json:"score"`         // Hashes agreeing on the best time offset
+	Confidence   float64      `json:"confidence"`    // Score as a fraction of the query hashes
+	OffsetFrames int          `json:"offset_frames"` // Where the query starts in the song, in spectrogram frames
+	Offset       float64      `json:"offset"`        // Same as OffsetFrames, in seconds
+}
+
 type LandmarkPair struct {
 	Freq1      int
 	Freq2      int
@@ -31,14 +51,44 @@ type LandmarkPair struct {
 	AnchorTime int
 }
 
+// FingerprintParams are the settings that shape fingerprint hashes. Fingerprints
+// generated with different params can't be matched against each other.
+type FingerprintParams struct {
+	SampleRate      int     `json:"sample_rate"`
+	WindowSize      int     `json:"window_size"`
+	HopSize         int     `json:"hop_size"`
+	LowBandMax      int     `json:"low_band_max"`
+	MidBandMax      int     `json:"mid_band_max"`
+	TargetZone      int     `json:"target_zone"`
+	MaxPairsPerPeak int     `json:"max_pairs_per_peak"`
+	PeakThreshold   float64 `json:"peak_threshold"`
+	HashLayout      string  `json:"hash_layout"`
+}
+
+// DefaultFingerprintParams are the params NewFingerprintService uses
+func DefaultFingerprintParams() FingerprintParams {
+	return FingerprintParams{
+		SampleRate:      TargetSampleRate,
+		WindowSize:      SpectrogramWindow,
+		HopSize:         SpectrogramHop,
+		LowBandMax:      64,
+		MidBandMax:      256,
+		TargetZone:      5,
+		MaxPairsPerPeak: 5,
+		PeakThreshold:   1.5,
+		HashLayout:      "freq1:12,freq2:10,delta:10",
+	}
+}
+
 func NewFingerprintService(repo repo.FingerprintRepo) FingerprintServiceInterface {
+	params := DefaultFingerprintParams()
 	return &FingerprintService{
 		Repo:            repo,
-		lowBandMax:      64,
-		midBandMax:      256,
-		targetZone:      5,
-		maxPairsPerPeak: 5,
-		peakThreshold:   1.5,
+		lowBandMax:      params.LowBandMax,
+		midBandMax:      params.MidBandMax,
+		targetZone:      params.TargetZone,
+		maxPairsPerPeak: params.MaxPairsPerPeak,
+		peakThreshold:   params.PeakThreshold,
 	}
 }
 
@@ -153,16 +203,26 @@ func (f *FingerprintService) HashPair(pair LandmarkPair) uint32 {
 	return hash
 }
 
-func (f *FingerprintService) GenerateFingerprints(spec *Spectrogram) ([]models.Fingerprint, error) {
+// GenerateFingerprints finds the spectrogram peaks and hashes them in pairs,
+// reporting the peaks and hashes stages to progress
+func (f *FingerprintService) GenerateFingerprints(ctx context.Context, spec *Spectrogram, progress ProgressFunc) ([]models.Fingerprint, error) {
+	ctx, span := tracing.Start(ctx, "FingerprintService.GenerateFingerprints")
+	defer span.End()
+
+	started := time.Now()
 	peaks := f.FindPeaks(spec)
+	progress.report(ctx, StagePeaks, spec.NumSamples, len(peaks), started)
 
+	started = time.Now()
 	if len(peaks) == 0 {
+		progress.report(ctx, StageHashes, spec.NumSamples, 0, started)
 		return []models.Fingerprint{}, nil // Silent audio or no peaks found
 	}
 
 	pairs := f.CreateLandmarkPairs(peaks)
 
 	if len(pairs) == 0 {
+		progress.report(ctx, StageHashes, spec.NumSamples, 0, started)
 		return []models.Fingerprint{}, nil // No pairs created
 	}
 
@@ -177,6 +237,92 @@ func (f *FingerprintService) GenerateFingerprints(spec *Spectrogram) ([]models.F
 			// SongID will be set by MusicService
 		})
 	}
+	progress.report(ctx, StageHashes, spec.NumSamples, len(fingerprints), started)
 
 	return fingerprints, nil
 }
+
+// SaveFingerprints assigns the song ID to each fingerprint and persists them
+func (f *FingerprintService) SaveFingerprints(ctx context.Context, songID string, fingerprints []models.Fingerprint) error {
+	return saveFingerprints(ctx, f.Repo, songID, fingerprints)
+}
+
+// saveFingerprints is SaveFingerprints against any repo, so MusicService can save
+// through the repo of its transaction
+func saveFingerprints(ctx context.Context, fingerprintRepo repo.FingerprintRepo, songID string, fingerprints []models.Fingerprint) error {
+	id, err := strconv.ParseInt(songID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid song ID %q: %w", songID, err)
+	}
+
+	for i := range fingerprints {
+		fingerprints[i].SongID = id
+	}
+
+	return fingerprintRepo.SaveFingerprints(ctx, fingerprints)
+}
+
+// MatchFingerprints looks up the query hashes and scores each candidate song by
+// the largest number of hashes sharing the same time offset (song time - query time).
+// Matches are returned best first.
+func (f *FingerprintService) MatchFingerprints(ctx context.Context, query []models.Fingerprint) (matches []Match, err error) {
+	if len(query) == 0 {
+		return []Match{}, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "FingerprintService.MatchFingerprints", attribute.Int("query", len(query)))
+	defer func() {
+		span.SetAttributes(attribute.Int("candidates", len(matches)))
+		tracing.End(span, err)
+	}()
+
+	queryOffsets := make(map[uint32][]uint32)
+	for _, fp := range query {
+		queryOffsets[fp.Hash] = append(queryOffsets[fp.Hash], fp.TimeOffset)
+	}
+
+	hashes := make([]uint32, 0, len(queryOffsets))
+	for hash := range queryOffsets {
+		hashes = append(hashes, hash)
+	}
+
+	candidates, err := f.Repo.FindByHashes(ctx, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up hashes: %w", err)
+	}
+
+	// song ID -> offset delta -> number of aligned hashes
+	histograms := make(map[int64]map[int]int)
+	for _, candidate := range candidates {
+		histogram, ok := histograms[candidate.SongID]
+		if !ok {
+			histogram = make(map[int]int)
+			histograms[candidate.SongID] = histogram
+		}
+		for _, offset := range queryOffsets[candidate.Hash] {
+			histogram[int(candidate.TimeOffset)-int(offset)]++
+		}
+	}
+
+	matches = make([]Match, 0, len(histograms))
+	for songID, histogram := range histograms {
+		best := Match{SongID: strconv.FormatInt(songID, 10)}
+		for delta, count := range histogram {
+			if count > best.Score || (count == best.Score && delta < best.OffsetFrames) {
+				best.Score = count
+				best.OffsetFrames = delta
+			}
+		}
+		best.Confidence = float64(best.Score) / float64(len(query))
+		matches = append(matches, best)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].SongID < matches[j].SongID
+	})
+
+	return matches, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/testaudio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchFingerprints(t *testing.T) {
+	fingerprintRepo := repo.NewMockFingerprintRepo()
+	service := NewFingerprintService(fingerprintRepo)
+
+	// The query starts 100 frames into song 1; song 2 shares hashes at scattered offsets
+	query := []models.Fingerprint{
+		{Hash: 1, TimeOffset: 0},
+		{Hash: 2, TimeOffset: 5},
+		{Hash: 3, TimeOffset: 9},
+		{Hash: 4, TimeOffset: 12},
+	}
+	stored := []models.Fingerprint{
+		{SongID: 1, Hash: 1, TimeOffset: 100},
+		{SongID: 1, Hash: 2, TimeOffset: 105},
+		{SongID: 1, Hash: 3, TimeOffset: 109},
+		{SongID: 1, Hash: 4, TimeOffset: 300},
+		{SongID: 2, Hash: 1, TimeOffset: 7},
+		{SongID: 2, Hash: 2, TimeOffset: 50},
+		{SongID: 2, Hash: 3, TimeOffset: 90},
+	}
+
+	fingerprintRepo.On("FindByHashes", mock.Anything, mock.MatchedBy(func(hashes []uint32) bool {
+		return assert.ElementsMatch(t, []uint32{1, 2, 3, 4}, hashes)
+	})).Return(stored, nil).Once()
+
+	matches, err := service.MatchFingerprints(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+
+	assert.Equal(t, "1", matches[0].SongID)
+	assert.Equal(t, 3, matches[0].Score)
+	assert.Equal(t, 100, matches[0].OffsetFrames)
+	assert.InDelta(t, 0.75, matches[0].Confidence, 1e-9)
+
+	assert.Equal(t, "2", matches[1].SongID)
+	assert.Equal(t, 1, matches[1].Score)
+	fingerprintRepo.AssertExpectations(t)
+}
+
+func TestMatchFingerprints_EmptyQuery(t *testing.T) {
+	service := NewFingerprintService(repo.NewMockFingerprintRepo())
+
+	matches, err := service.MatchFingerprints(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestHashPair(t *testing.T) {
+	service := &FingerprintService{}
+
+	hash := service.HashPair(LandmarkPair{Freq1: 10, Freq2: 20, TimeDelta: 3})
+	assert.Equal(t, uint32(10<<20|20<<10|3), hash)
+
+	clamped := service.HashPair(LandmarkPair{Freq1: 5000, Freq2: 2000, TimeDelta: 2000})
+	assert.Equal(t, uint32(4095<<20|1023<<10|1023), clamped)
+}
+
+func TestIdentify_ClipsOfSynthesizedSongs(t *testing.T) {
+	songRepo, fingerprintRepo := repo.NewMemorySongRepo(), repo.NewMemoryFingerprintRepo()
+	service := NewMusicService(nil, songRepo, repo.NewMemoryUnitOfWork(songRepo, fingerprintRepo), NewAudioService(), NewFingerprintService(fingerprintRepo), DuplicatePolicy{})
+	rate := TargetSampleRate
+
+	songs := make(map[string][]float64)
+	for seed := int64(1); seed <= 3; seed++ {
+		melody := testaudio.Melody(rate, 10, seed)
+		song, err := service.HandleUpload(ctx, models.Song{
+			Title: fmt.Sprintf("Melody %d", seed), Artist: "testaudio", Year: 2024, S3Key: "melody.wav",
+		}, testaudio.WAV(t, testaudio.Mono16k, melody))
+		require.NoError(t, err)
+		songs[song.ID] = melody
+	}
+
+	for id, melody := range songs {
+		for _, start := range []float64{0, 1.6, 4.8} {
+			from := int(start * float64(rate))
+			clip := testaudio.WAV(t, testaudio.Mono16k, melody[from:from+3*rate])
+
+			matches, err := service.Identify(ctx, clip)
+			require.NoError(t, err)
+			require.NotEmpty(t, matches)
+			assert.Equal(t, id, matches[0].SongID, "song %s at %.1fs", id, start)
+			assert.InDelta(t, start, matches[0].Offset, 0.05, "song %s at %.1fs", id, start)
+		}
+	}
+}
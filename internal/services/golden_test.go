@@ -0,0 +1,198 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/testaudio"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden fingerprint files in testdata/golden")
+
+// goldenCorpus is fingerprinted by TestGoldenFingerprints. Changing an entry changes
+// its golden file, so add new entries rather than editing old ones.
+var goldenCorpus = []struct {
+	name  string
+	audio func(t *testing.T) []byte
+}{
+	{"chord-16k", func(t *testing.T) []byte {
+		return testaudio.WAV(t, testaudio.Mono16k, testaudio.Chord(16000, 2, 440, 1250, 3100))
+	}},
+	{"sweep-16k", func(t *testing.T) []byte {
+		return testaudio.WAV(t, testaudio.Mono16k, testaudio.Sweep(16000, 3, 100, 6000))
+	}},
+	{"melody-16k", func(t *testing.T) []byte {
+		return testaudio.WAV(t, testaudio.Mono16k, testaudio.Melody(16000, 5, 1))
+	}},
+	{"melody-44k-stereo", func(t *testing.T) []byte {
+		return testaudio.WAV(t, testaudio.CDStereo, testaudio.Melody(44100, 5, 2))
+	}},
+	{"burst-22k", func(t *testing.T) []byte {
+		format := testaudio.Format{SampleRate: 22050, BitDepth: 16, Channels: 1}
+		return testaudio.WAV(t, format, testaudio.Mix(testaudio.Melody(22050, 3, 3), testaudio.Burst(22050, 1, 0.5, 1.5, 3)))
+	}},
+}
+
+// goldenMinOverlap is the share of an entry's golden hashes that must still be
+// generated, and of its generated hashes that must be golden, on platforms other
+// than the one the goldens were generated on (linux/amd64, recorded in each file's
+// header). Other architectures may fuse multiply-adds in the FFT, and the rounding
+// difference can move a peak that sat on a threshold, so a few hashes are allowed
+// to differ there. On the generating platform the output must match exactly.
+const goldenMinOverlap = 0.95
+
+// TestGoldenFingerprints guards the stored hashes: any change to the spectrogram,
+// peak picking or HashPair that alters fingerprints fails here. Run
+//
+//	go test ./internal/services -run Golden -update
+//
+// to accept the new output, and re-fingerprint the catalog when you do.
+func TestGoldenFingerprints(t *testing.T) {
+	service := NewMusicService(nil, nil, nil, NewAudioService(), NewFingerprintService(repo.NewMockFingerprintRepo()), DuplicatePolicy{}).(*MusicService)
+	changed, total, failed := 0, 0, false
+
+	for _, entry := range goldenCorpus {
+		t.Run(entry.name, func(t *testing.T) {
+			fingerprints, err := service.Fingerprint(ctx, entry.audio(t), nil)
+			require.NoError(t, err)
+			require.NotEmpty(t, fingerprints)
+
+			path := filepath.Join("testdata", "golden", entry.name+".golden")
+			if *update {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, formatGolden(fingerprints), 0o644))
+				return
+			}
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err, "missing golden file, run with -update to create it")
+			platform, want, err := parseGolden(data)
+			require.NoError(t, err)
+			exact := platform == "" || platform == runtime.GOOS+"/"+runtime.GOARCH
+
+			missing, added := diffFingerprints(want, fingerprints)
+			if len(missing) == 0 && len(added) == 0 {
+				return
+			}
+
+			total += len(want)
+			changed += len(missing)
+			report := fmt.Sprintf("%d of %d golden hashes missing and %d new (%d now)\n%s",
+				len(missing), len(want), len(added), len(fingerprints), sampleDiff(missing, added, 5))
+			if exact || overlap(len(want), len(missing)) < goldenMinOverlap || overlap(len(fingerprints), len(added)) < goldenMinOverlap {
+				failed = true
+				t.Error(report)
+				return
+			}
+			t.Logf("within tolerance on %s/%s, the goldens were generated on %s: %s", runtime.GOOS, runtime.GOARCH, platform, report)
+		})
+	}
+
+	if failed {
+		t.Errorf("%d of %d golden hashes changed in the failing entries; stored fingerprints would stop matching. "+
+			"If this is intended, rerun with -update and re-fingerprint the catalog.", changed, total)
+	}
+}
+
+// overlap is the share of n fingerprints left after removing the unmatched ones
+func overlap(n, unmatched int) float64 {
+	if n == 0 {
+		return 1
+	}
+	return float64(n-unmatched) / float64(n)
+}
+
+// formatGolden writes one "offset hash" line per fingerprint, in generation order,
+// under a header naming the platform they were generated on
+func formatGolden(fingerprints []models.Fingerprint) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# generated on %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	buf.WriteString("# offset hash\n")
+	for _, fp := range fingerprints {
+		fmt.Fprintf(&buf, "%d %08x\n", fp.TimeOffset, fp.Hash)
+	}
+	return buf.Bytes()
+}
+
+// parseGolden reads a golden file and the GOOS/GOARCH it was generated on, empty
+// when the header doesn't say
+func parseGolden(data []byte) (platform string, fingerprints []models.Fingerprint, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if generated, ok := strings.CutPrefix(text, "# generated on "); ok {
+			platform = generated
+			continue
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var fp models.Fingerprint
+		if _, err := fmt.Sscanf(text, "%d %x", &fp.TimeOffset, &fp.Hash); err != nil {
+			return "", nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+	return platform, fingerprints, scanner.Err()
+}
+
+// diffFingerprints compares (offset, hash) multisets, ignoring order
+func diffFingerprints(want, got []models.Fingerprint) (missing, added []models.Fingerprint) {
+	type key struct{ offset, hash uint32 }
+	counts := make(map[key]int)
+	for _, fp := range want {
+		counts[key{fp.TimeOffset, fp.Hash}]++
+	}
+	for _, fp := range got {
+		k := key{fp.TimeOffset, fp.Hash}
+		if counts[k] > 0 {
+			counts[k]--
+		} else {
+			added = append(added, fp)
+		}
+	}
+	for _, fp := range want {
+		k := key{fp.TimeOffset, fp.Hash}
+		if counts[k] > 0 {
+			counts[k]--
+			missing = append(missing, fp)
+		}
+	}
+	return missing, added
+}
+
+func sampleDiff(missing, added []models.Fingerprint, limit int) string {
+	byOffset := func(fps []models.Fingerprint) {
+		sort.Slice(fps, func(i, j int) bool { return fps[i].TimeOffset < fps[j].TimeOffset })
+	}
+	byOffset(missing)
+	byOffset(added)
+
+	var b strings.Builder
+	for i, fp := range missing {
+		if i == limit {
+			fmt.Fprintf(&b, "  ... %d more missing\n", len(missing)-limit)
+			break
+		}
+		fmt.Fprintf(&b, "  - %d %08x\n", fp.TimeOffset, fp.Hash)
+	}
+	for i, fp := range added {
+		if i == limit {
+			fmt.Fprintf(&b, "  ... %d more new\n", len(added)-limit)
+			break
+		}
+		fmt.Fprintf(&b, "  + %d %08x\n", fp.TimeOffset, fp.Hash)
+	}
+	return b.String()
+}
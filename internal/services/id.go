@@ -0,0 +1,16 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newID returns a random 128-bit ID in hex. Jobs and API keys are identified by
+// these, so changing the format changes both.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
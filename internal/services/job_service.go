@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/storage"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"github.com/owenhochwald/harmonia/pkg/logger"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrQueueFull    = errors.New("ingest queue is full")
+	ErrShuttingDown = errors.New("ingest is shutting down")
+)
+
+// JobLease is how long a running job stays claimed by its worker without being
+// renewed. Workers renew it while they run, so it only runs out when a replica
+// dies or is interrupted, and another replica then takes the job over.
+const JobLease = time.Minute
+
+type JobServiceInterface interface {
+	Submit(ctx context.Context, song models.Song, data []byte) (*models.Job, error)
+	GetJob(ctx context.Context, id string) (*models.Job, error)
+	Start(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+	Subscribe(id string) (<-chan JobProgress, func())
+}
+
+// JobProgress is a pipeline stage finished by a running job
+type JobProgress struct {
+	JobID     string `json:"job_id"`
+	Stage     Stage  `json:"stage"`
+	Step      int    `json:"step"`  // Position of the stage in the pipeline, from 1
+	Steps     int    `json:"steps"` // Number of stages in the pipeline
+	Samples   int    `json:"samples"`
+	Count     int    `json:"count,omitempty"`
+	ElapsedMs int64  `json:"elapsed_ms"` // Time spent in the stage
+	TotalMs   int64  `json:"total_ms"`   // Time since the job started running
+}
+
+// JobService stores uploaded audio and runs the ingest pipeline on a bounded
+// pool of workers. Job state lives in the JobRepo so pending work survives restarts.
+// Workers claim a job before running it, so replicas sharing the JobRepo (and the
+// Storage) never ingest a job twice.
+type JobService struct {
+	Storage      storage.Storage
+	Repo         repo.JobRepo
+	MusicService MusicServiceInterface
+	Logger       zerolog.Logger
+
+	workers  int
+	lease    time.Duration
+	queue    chan string
+	wg       sync.WaitGroup
+	progress *progressBroker
+
+	stopping chan struct{} // Closed by Shutdown, workers take no new jobs after that
+	stopOnce sync.Once
+	cancel   context.CancelFunc // Interrupts running jobs, set by Start
+}
+
+func NewJobService(storage storage.Storage, repo repo.JobRepo, musicService MusicServiceInterface, log zerolog.Logger, workers, queueSize int) JobServiceInterface {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	return &JobService{
+		Storage:      storage,
+		Repo:         repo,
+		MusicService: musicService,
+		Logger:       log,
+		workers:      workers,
+		lease:        JobLease,
+		queue:        make(chan string, queueSize),
+		progress:     newProgressBroker(),
+		stopping:     make(chan struct{}),
+	}
+}
+
+// Submit stores the audio, records a queued job and hands it to the workers.
+// ErrQueueFull is returned (the job marked failed and its audio deleted) when the
+// queue has no room, and ErrShuttingDown once Shutdown has been called.
+func (s *JobService) Submit(ctx context.Context, song models.Song, data []byte) (submitted *models.Job, err error) {
+	ctx, span := tracing.Start(ctx, "JobService.Submit")
+	defer func() { tracing.End(span, err) }()
+
+	if s.isStopping() {
+		return nil, ErrShuttingDown
+	}
+
+	if err := validateSongMetadata(song); err != nil {
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, fmt.Errorf("error generating job id: %w", err)
+	}
+	span.SetAttributes(attribute.String("job.id", id))
+	ctx = logger.WithContext(ctx, logger.FromContextOr(ctx, s.Logger).With().Str("job_id", id).Logger())
+
+	key := fmt.Sprintf("uploads/%s.wav", id)
+	if err := s.Storage.Upload(ctx, key, data); err != nil {
+		return nil, fmt.Errorf("error storing audio: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := models.Job{
+		ID:        id,
+		Status:    models.JobQueued,
+		Title:     song.Title,
+		Artist:    song.Artist,
+		Album:     song.Album,
+		Year:      song.Year,
+		S3Key:     key,
+		TenantID:  tenant.From(ctx),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.Repo.SaveJob(ctx, job); err != nil {
+		s.discardAudio(ctx, key)
+		return nil, fmt.Errorf("error saving job: %w", err)
+	}
+
+	select {
+	case s.queue <- job.ID:
+		logger.FromContext(ctx).Info().Msg("ingest job queued")
+		return &job, nil
+	default:
+		// The job is never run, so nothing would ever read or remove its audio
+		s.discardAudio(ctx, key)
+		s.finish(ctx, &job, nil, ErrQueueFull)
+		return &job, ErrQueueFull
+	}
+}
+
+// discardAudio deletes the stored audio of a job that won't run. A failure is only
+// logged, the caller already has an error to return.
+func (s *JobService) discardAudio(ctx context.Context, key string) {
+	if err := s.Storage.Delete(ctx, key); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Str("key", key).Msg("failed to delete audio of unqueued job")
+	}
+}
+
+// GetJob returns a job of the tenant in ctx, nil for jobs of other tenants
+func (s *JobService) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	job, err := s.Repo.FindById(ctx, id)
+	if err != nil || job == nil || job.TenantID != tenant.From(ctx) {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Subscribe streams the progress of a job. The latest event is replayed straight away,
+// and the channel is closed once the job stops running. Call the returned func to unsubscribe.
+func (s *JobService) Subscribe(id string) (<-chan JobProgress, func()) {
+	return s.progress.subscribe(id)
+}
+
+// Start launches the workers and re-enqueues queued jobs and running jobs whose
+// lease ran out, then looks for abandoned jobs again every lease. Workers stop
+// once ctx is cancelled or Shutdown is called.
+func (s *JobService) Start(ctx context.Context) error {
+	pending, err := s.abandonedJobs(ctx, time.Time{})
+	if err != nil {
+		return fmt.Errorf("error loading pending jobs: %w", err)
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.work(ctx)
+	}
+
+	if len(pending) > 0 {
+		s.Logger.Info().Int("jobs", len(pending)).Msg("resuming pending ingest jobs")
+		go s.resume(ctx, pending)
+	}
+
+	s.wg.Add(1)
+	go s.sweep(ctx)
+
+	return nil
+}
+
+// abandonedJobs lists the running jobs whose lease ran out and the jobs queued
+// before queuedBefore. Jobs queued since may still be in another replica's queue.
+func (s *JobService) abandonedJobs(ctx context.Context, queuedBefore time.Time) ([]models.Job, error) {
+	jobs, err := s.Repo.FindByStatus(ctx, models.JobQueued, models.JobRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	// ClaimJob checks the lease again, this only avoids queueing jobs that are held
+	expired := time.Now().UTC().Add(-s.lease)
+	abandoned := jobs[:0]
+	for _, job := range jobs {
+		switch {
+		case job.Status == models.JobRunning && job.UpdatedAt.Before(expired):
+		case job.Status == models.JobQueued && (queuedBefore.IsZero() || job.UpdatedAt.Before(queuedBefore)):
+		default:
+			continue
+		}
+		abandoned = append(abandoned, job)
+	}
+	return abandoned, nil
+}
+
+// sweep queues the jobs other workers abandoned, such as those of a replica that
+// died, once per lease. Jobs are skipped while the queue is full.
+func (s *JobService) sweep(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.lease)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopping:
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := s.abandonedJobs(ctx, time.Now().UTC().Add(-s.lease))
+		if err != nil {
+			s.Logger.Error().Err(err).Msg("failed to look for abandoned ingest jobs")
+			continue
+		}
+		for _, job := range jobs {
+			select {
+			case s.queue <- job.ID:
+				s.Logger.Info().Str("job_id", job.ID).Str("status", string(job.Status)).Msg("resuming abandoned ingest job")
+			default:
+			}
+		}
+	}
+}
+
+// Shutdown stops taking new jobs and waits for the running ones to finish. If ctx
+// ends first the running jobs are interrupted and left running, so a worker takes
+// them over once their lease runs out; their transactions roll back, so no partial
+// song is saved. Jobs still queued stay queued in the JobRepo for the same reason.
+func (s *JobService) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if s.cancel != nil {
+			s.cancel()
+		}
+		return fmt.Errorf("ingest jobs still running: %w", ctx.Err())
+	}
+}
+
+func (s *JobService) isStopping() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *JobService) resume(ctx context.Context, jobs []models.Job) {
+	for _, job := range jobs {
+		select {
+		case s.queue <- job.ID:
+		case <-ctx.Done():
+			return
+		case <-s.stopping:
+			return
+		}
+	}
+}
+
+func (s *JobService) work(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopping:
+			return
+		case id := <-s.queue:
+			if s.isStopping() {
+				// Lost the race with Shutdown, the job is still queued in the repo
+				return
+			}
+			s.process(ctx, id)
+		}
+	}
+}
+
+func (s *JobService) process(ctx context.Context, id string) {
+	log := s.Logger.With().Str("job_id", id).Logger()
+	ctx = logger.WithContext(ctx, log)
+
+	job, err := s.Repo.ClaimJob(ctx, id, s.lease)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to claim job")
+		return
+	}
+	if job == nil {
+		log.Debug().Msg("job finished or claimed by another worker")
+		return
+	}
+
+	defer s.progress.done(id)
+
+	// The job ingests into the catalog of the tenant that submitted it
+	ctx = tenant.With(ctx, job.TenantID, false)
+
+	// Jobs run after their request has finished, so each starts its own trace;
+	// job.id ties it to the JobService.Submit span
+	ctx, span := tracing.Start(ctx, "JobService.process", attribute.String("job.id", id))
+	defer span.End()
+
+	stopRenewing := s.renew(ctx, id)
+	defer stopRenewing()
+
+	data, err := s.Storage.Download(ctx, job.S3Key)
+	if err != nil {
+		s.finish(ctx, job, nil, fmt.Errorf("error loading audio: %w", err))
+		return
+	}
+
+	started := time.Now()
+	ctx = WithProgress(ctx, func(event ProgressEvent) {
+		s.progress.publish(JobProgress{
+			JobID:     id,
+			Stage:     event.Stage,
+			Step:      event.Stage.Step(),
+			Steps:     len(Stages),
+			Samples:   event.Samples,
+			Count:     event.Count,
+			ElapsedMs: event.Elapsed.Milliseconds(),
+			TotalMs:   time.Since(started).Milliseconds(),
+		})
+	})
+
+	song, err := s.MusicService.HandleUpload(ctx, job.Song(), data)
+	if ctx.Err() != nil {
+		// Interrupted by shutdown, leave the job running so Start picks it up again
+		return
+	}
+	tracing.Fail(span, err)
+	s.finish(ctx, job, song, err)
+}
+
+// renew keeps the lease of a running job until the returned func is called
+func (s *JobService) renew(ctx context.Context, id string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Repo.RenewJob(ctx, id); err != nil && ctx.Err() == nil {
+					logger.FromContext(ctx).Error().Err(err).Msg("failed to renew job lease")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (s *JobService) finish(ctx context.Context, job *models.Job, song *models.Song, err error) {
+	var duplicate *DuplicateError
+	switch {
+	case errors.As(err, &duplicate):
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+		job.DuplicateOf = duplicate.SongID
+	case err != nil:
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = models.JobSucceeded
+		job.SongID = song.ID
+		job.DuplicateOf = song.DuplicateOf
+	}
+	job.UpdatedAt = time.Now().UTC()
+
+	if err := s.Repo.UpdateJob(ctx, *job); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("failed to record job result")
+		return
+	}
+
+	logger.FromContext(ctx).Info().Str("status", string(job.Status)).Str("song_id", job.SongID).Str("duplicate_of", job.DuplicateOf).Msg("ingest job finished")
+}
+
+// progressSubscriberBuffer is how many events a slow subscriber can fall behind before
+// events are dropped for it
+const progressSubscriberBuffer = 16
+
+// progressBroker fans job progress out to subscribers and remembers the latest
+// event of each running job for late subscribers
+type progressBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan JobProgress]struct{}
+	latest      map[string]JobProgress
+}
+
+func newProgressBroker() *progressBroker {
+	return &progressBroker{
+		subscribers: make(map[string]map[chan JobProgress]struct{}),
+		latest:      make(map[string]JobProgress),
+	}
+}
+
+func (b *progressBroker) subscribe(id string) (<-chan JobProgress, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan JobProgress, progressSubscriberBuffer)
+	if event, ok := b.latest[id]; ok {
+		ch <- event
+	}
+
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = make(map[chan JobProgress]struct{})
+	}
+	b.subscribers[id][ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id][ch]; ok {
+			delete(b.subscribers[id], ch)
+			close(ch)
+		}
+		if len(b.subscribers[id]) == 0 {
+			delete(b.subscribers, id)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+func (b *progressBroker) publish(event JobProgress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.latest[event.JobID] = event
+	for ch := range b.subscribers[event.JobID] {
+		select {
+		case ch <- event:
+		default:
+			// Never block the pipeline on a slow client
+		}
+	}
+}
+
+// done closes every subscription to a job once it stops running
+func (b *progressBroker) done(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[id] {
+		close(ch)
+	}
+	delete(b.subscribers, id)
+	delete(b.latest, id)
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/storage"
+	"github.com/owenhochwald/harmonia/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupJobService(queueSize int) (*JobService, *repo.MockJobRepo, *MockMusicService) {
+	jobRepo := repo.NewMockJobRepo()
+	musicService := &MockMusicService{}
+	service := NewJobService(MockStorage{}, jobRepo, musicService, zerolog.Nop(), 1, queueSize).(*JobService)
+	return service, jobRepo, musicService
+}
+
+func TestJobService_Submit(t *testing.T) {
+	t.Run("queues job", func(t *testing.T) {
+		service, jobRepo, _ := setupJobService(1)
+		jobRepo.On("SaveJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool {
+			return j.Status == models.JobQueued && j.Title == "title"
+		})).Return(nil).Once()
+
+		job, err := service.Submit(context.Background(), MockSongFactory(), []byte("audio"))
+		require.NoError(t, err)
+		assert.Equal(t, models.JobQueued, job.Status)
+		assert.Equal(t, "uploads/"+job.ID+".wav", job.S3Key)
+		assert.Equal(t, job.ID, <-service.queue)
+		jobRepo.AssertExpectations(t)
+	})
+
+	t.Run("rejects when queue is full", func(t *testing.T) {
+		service, jobRepo, _ := setupJobService(1)
+		local, err := storage.NewLocalStorage(t.TempDir())
+		require.NoError(t, err)
+		service.Storage = local
+		service.queue <- "already-queued"
+		jobRepo.On("SaveJob", mock.Anything, mock.Anything).Return(nil).Once()
+		jobRepo.On("UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool {
+			return j.Status == models.JobFailed
+		})).Return(nil).Once()
+
+		job, err := service.Submit(context.Background(), MockSongFactory(), []byte("audio"))
+		assert.ErrorIs(t, err, ErrQueueFull)
+		assert.Equal(t, models.JobFailed, job.Status)
+		jobRepo.AssertExpectations(t)
+
+		_, err = local.Download(context.Background(), job.S3Key)
+		assert.Error(t, err, "the audio of the refused job is deleted")
+	})
+
+	t.Run("records the tenant", func(t *testing.T) {
+		service, jobRepo, _ := setupJobService(1)
+		jobRepo.On("SaveJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool {
+			return j.TenantID == "acme"
+		})).Return(nil).Once()
+
+		job, err := service.Submit(tenant.With(context.Background(), "acme", true), MockSongFactory(), []byte("audio"))
+		require.NoError(t, err)
+		assert.Equal(t, "acme", job.TenantID)
+		jobRepo.AssertExpectations(t)
+	})
+
+	t.Run("rejects malformed song", func(t *testing.T) {
+		service, _, _ := setupJobService(1)
+		_, err := service.Submit(context.Background(), models.Song{}, []byte("audio"))
+		assert.ErrorContains(t, err, "malformed song")
+	})
+}
+
+func TestJobService_Process(t *testing.T) {
+	newJob := func() *models.Job {
+		return &models.Job{ID: "job-1", Status: models.JobRunning, Title: "title", Artist: "artist", Year: 2025, S3Key: "uploads/job-1.wav"}
+	}
+
+	t.Run("records song on success", func(t *testing.T) {
+		service, jobRepo, musicService := setupJobService(1)
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(newJob(), nil).Once()
+		jobRepo.On("UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool {
+			return j.Status == models.JobSucceeded && j.SongID == "42"
+		})).Return(nil).Once()
+		musicService.On("HandleUpload", mock.Anything, mock.Anything, []byte("mock data")).Return(&models.Song{ID: "42"}, nil).Once()
+
+		service.process(context.Background(), "job-1")
+
+		jobRepo.AssertExpectations(t)
+		musicService.AssertExpectations(t)
+	})
+
+	t.Run("records error on failure", func(t *testing.T) {
+		service, jobRepo, musicService := setupJobService(1)
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(newJob(), nil).Once()
+		jobRepo.On("UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool {
+			return j.Status == models.JobFailed && j.Error == "bad audio"
+		})).Return(nil).Once()
+		musicService.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("bad audio")).Once()
+
+		service.process(context.Background(), "job-1")
+
+		jobRepo.AssertExpectations(t)
+	})
+
+	t.Run("records the song a duplicate matched", func(t *testing.T) {
+		service, jobRepo, musicService := setupJobService(1)
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(newJob(), nil).Once()
+		jobRepo.On("UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool {
+			return j.Status == models.JobFailed && j.DuplicateOf == "7" && j.Error == "duplicate of song 7: 80% of fingerprints match"
+		})).Return(nil).Once()
+		musicService.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).Return(nil, &DuplicateError{SongID: "7", Coverage: 0.8}).Once()
+
+		service.process(context.Background(), "job-1")
+
+		jobRepo.AssertExpectations(t)
+	})
+
+	t.Run("records flagged duplicates", func(t *testing.T) {
+		service, jobRepo, musicService := setupJobService(1)
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(newJob(), nil).Once()
+		jobRepo.On("UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool {
+			return j.Status == models.JobSucceeded && j.SongID == "42" && j.DuplicateOf == "7"
+		})).Return(nil).Once()
+		musicService.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).Return(&models.Song{ID: "42", DuplicateOf: "7"}, nil).Once()
+
+		service.process(context.Background(), "job-1")
+
+		jobRepo.AssertExpectations(t)
+	})
+
+	t.Run("ingests into the job's tenant", func(t *testing.T) {
+		service, jobRepo, musicService := setupJobService(1)
+		job := newJob()
+		job.TenantID = "acme"
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(job, nil).Once()
+		jobRepo.On("UpdateJob", mock.Anything, mock.Anything).Return(nil).Once()
+		musicService.On("HandleUpload", mock.MatchedBy(func(ctx context.Context) bool {
+			return tenant.From(ctx) == "acme"
+		}), mock.Anything, mock.Anything).Return(&models.Song{ID: "42"}, nil).Once()
+
+		service.process(context.Background(), "job-1")
+
+		musicService.AssertExpectations(t)
+	})
+
+	t.Run("skips jobs it can't claim", func(t *testing.T) {
+		// Finished, or running on another replica
+		service, jobRepo, musicService := setupJobService(1)
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(nil, nil).Once()
+
+		service.process(context.Background(), "job-1")
+
+		jobRepo.AssertExpectations(t)
+		musicService.AssertNotCalled(t, "HandleUpload", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestJobService_Start_ResumesPendingJobs(t *testing.T) {
+	service, jobRepo, musicService := setupJobService(4)
+	job := func(id string, status models.JobStatus, updated time.Time) models.Job {
+		return models.Job{ID: id, Status: status, Title: "title", Artist: "artist", Year: 2025, S3Key: "uploads/" + id + ".wav", UpdatedAt: updated}
+	}
+	now := time.Now().UTC()
+	pending := []models.Job{
+		job("queued", models.JobQueued, now),
+		job("expired", models.JobRunning, now.Add(-2*JobLease)),
+		job("held", models.JobRunning, now), // Running on a live replica
+	}
+
+	finished := make(chan string, 2)
+	jobRepo.On("FindByStatus", mock.Anything, []models.JobStatus{models.JobQueued, models.JobRunning}).Return(pending, nil).Once()
+	for _, j := range pending[:2] {
+		claimed := j
+		claimed.Status = models.JobRunning
+		jobRepo.On("ClaimJob", mock.Anything, j.ID, JobLease).Return(&claimed, nil).Once()
+	}
+	jobRepo.On("UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool { return j.Status == models.JobSucceeded })).
+		Return(nil).Twice().Run(func(args mock.Arguments) { finished <- args.Get(1).(models.Job).ID })
+	musicService.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).Return(&models.Song{ID: "1"}, nil).Twice()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, service.Start(ctx))
+
+	var resumed []string
+	for range 2 {
+		select {
+		case id := <-finished:
+			resumed = append(resumed, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("pending job was not resumed")
+		}
+	}
+	assert.ElementsMatch(t, []string{"queued", "expired"}, resumed)
+	jobRepo.AssertExpectations(t)
+	jobRepo.AssertNotCalled(t, "ClaimJob", mock.Anything, "held", mock.Anything)
+}
+
+func TestJobService_RenewsLease(t *testing.T) {
+	service, jobRepo, musicService := setupJobService(1)
+	service.lease = 30 * time.Millisecond
+	job := &models.Job{ID: "job-1", Status: models.JobRunning, Title: "title", Artist: "artist", Year: 2025, S3Key: "uploads/job-1.wav"}
+
+	renewed := make(chan struct{}, 1)
+	jobRepo.On("ClaimJob", mock.Anything, "job-1", service.lease).Return(job, nil).Once()
+	jobRepo.On("RenewJob", mock.Anything, "job-1").Return(nil).Run(func(mock.Arguments) {
+		select {
+		case renewed <- struct{}{}:
+		default:
+		}
+	})
+	jobRepo.On("UpdateJob", mock.Anything, mock.Anything).Return(nil).Once()
+	musicService.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { <-renewed }).
+		Return(&models.Song{ID: "1"}, nil).Once()
+
+	done := make(chan struct{})
+	go func() {
+		service.process(context.Background(), "job-1")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lease was not renewed while the job ran")
+	}
+	jobRepo.AssertExpectations(t)
+}
+
+func TestJobService_Subscribe(t *testing.T) {
+	t.Run("streams progress until the job finishes", func(t *testing.T) {
+		service, jobRepo, musicService := setupJobService(1)
+		job := &models.Job{ID: "job-1", Status: models.JobRunning, Title: "title", Artist: "artist", S3Key: "uploads/job-1.wav"}
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(job, nil).Once()
+		jobRepo.On("UpdateJob", mock.Anything, mock.Anything).Return(nil).Once()
+		musicService.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				progress := ProgressFromContext(args.Get(0).(context.Context))
+				progress(ProgressEvent{Stage: StageDecode, Samples: 100})
+				progress(ProgressEvent{Stage: StagePersist, Samples: 100, Count: 3})
+			}).
+			Return(&models.Song{ID: "1"}, nil).Once()
+
+		events, unsubscribe := service.Subscribe("job-1")
+		defer unsubscribe()
+		service.process(context.Background(), "job-1")
+
+		var received []JobProgress
+		for event := range events {
+			received = append(received, event)
+		}
+		require.Len(t, received, 2)
+		assert.Equal(t, JobProgress{JobID: "job-1", Stage: StageDecode, Step: 1, Steps: len(Stages), Samples: 100}, received[0])
+		assert.Equal(t, StagePersist, received[1].Stage)
+		assert.Equal(t, len(Stages), received[1].Step)
+		assert.Equal(t, 3, received[1].Count)
+	})
+
+	t.Run("replays the latest event", func(t *testing.T) {
+		service, _, _ := setupJobService(1)
+		service.progress.publish(JobProgress{JobID: "job-1", Stage: StageDecode})
+		service.progress.publish(JobProgress{JobID: "job-1", Stage: StageMono})
+
+		events, unsubscribe := service.Subscribe("job-1")
+		assert.Equal(t, StageMono, (<-events).Stage)
+
+		unsubscribe()
+		_, open := <-events
+		assert.False(t, open)
+	})
+}
+
+func TestJobService_Shutdown(t *testing.T) {
+	startWithJob := func(t *testing.T, upload func(ctx context.Context)) (*JobService, *repo.MockJobRepo) {
+		service, jobRepo, musicService := setupJobService(4)
+		job := &models.Job{ID: "job-1", Status: models.JobQueued, Title: "title", Artist: "artist", Year: 2025, S3Key: "uploads/job-1.wav"}
+		started := make(chan struct{})
+
+		jobRepo.On("FindByStatus", mock.Anything, mock.Anything).Return([]models.Job{*job}, nil).Once()
+		jobRepo.On("ClaimJob", mock.Anything, "job-1", JobLease).Return(job, nil).Once()
+		musicService.On("HandleUpload", mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				close(started)
+				upload(args.Get(0).(context.Context))
+			}).
+			Return(&models.Song{ID: "1"}, nil).Once()
+
+		require.NoError(t, service.Start(context.Background()))
+		<-started
+		return service, jobRepo
+	}
+
+	t.Run("waits for running jobs", func(t *testing.T) {
+		release := make(chan struct{})
+		service, jobRepo := startWithJob(t, func(context.Context) { <-release })
+		jobRepo.On("UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool { return j.Status == models.JobSucceeded })).Return(nil).Once()
+
+		done := make(chan error)
+		go func() { done <- service.Shutdown(context.Background()) }()
+
+		select {
+		case <-done:
+			t.Fatal("Shutdown returned before the job finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		require.NoError(t, <-done)
+		jobRepo.AssertExpectations(t)
+	})
+
+	t.Run("interrupts running jobs at the deadline", func(t *testing.T) {
+		service, jobRepo := startWithJob(t, func(ctx context.Context) { <-ctx.Done() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := service.Shutdown(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// The job is left running for a worker to take over once its lease runs out
+		service.wg.Wait()
+		jobRepo.AssertNotCalled(t, "UpdateJob", mock.Anything, mock.MatchedBy(func(j models.Job) bool { return j.Status != models.JobRunning }))
+	})
+
+	t.Run("refuses new jobs", func(t *testing.T) {
+		service, _, _ := setupJobService(1)
+		require.NoError(t, service.Shutdown(context.Background()))
+
+		_, err := service.Submit(context.Background(), MockSongFactory(), []byte("audio"))
+		assert.ErrorIs(t, err, ErrShuttingDown)
+	})
+}
+
+func TestJobService_GetJob(t *testing.T) {
+	service, jobRepo, _ := setupJobService(1)
+	jobRepo.On("FindById", mock.Anything, "job-1").Return(&models.Job{ID: "job-1", TenantID: "acme"}, nil)
+
+	job, err := service.GetJob(tenant.With(context.Background(), "acme", false), "job-1")
+	require.NoError(t, err)
+	assert.NotNil(t, job)
+
+	job, err = service.GetJob(tenant.With(context.Background(), "other", true), "job-1")
+	require.NoError(t, err)
+	assert.Nil(t, job, "jobs of other tenants are hidden")
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+)
+
+// ReadWAVTags reads song metadata from the RIFF INFO chunk of a WAV file
+// (INAM title, IART artist, IPRD album, ICRD date). Fields without a tag are left empty.
+func ReadWAVTags(data []byte) (models.Song, error) {
+	var song models.Song
+
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return song, models.Errorf(models.ErrUnsupportedFormat, "not a WAV file")
+	}
+
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := offset + 8
+		if size < 0 || body+size > len(data) {
+			break
+		}
+
+		if id == "LIST" && size >= 4 && string(data[body:body+4]) == "INFO" {
+			readInfoTags(data[body+4:body+size], &song)
+		}
+
+		// Chunks are padded to an even size
+		offset = body + size + size%2
+	}
+
+	return song, nil
+}
+
+func readInfoTags(info []byte, song *models.Song) {
+	for offset := 0; offset+8 <= len(info); {
+		id := string(info[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(info[offset+4 : offset+8]))
+		body := offset + 8
+		if size < 0 || body+size > len(info) {
+			return
+		}
+
+		value := strings.TrimSpace(string(bytes.TrimRight(info[body:body+size], "\x00")))
+		switch id {
+		case "INAM":
+			song.Title = value
+		case "IART":
+			song.Artist = value
+		case "IPRD":
+			song.Album = value
+		case "ICRD":
+			song.Year = parseYear(value)
+		}
+
+		offset = body + size + size%2
+	}
+}
+
+// parseYear takes the year from a date such as "1997" or "1997-05-21"
+func parseYear(value string) int {
+	if len(value) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(value[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// FilenamePattern extracts song metadata from a file path, for example
+// "{artist}/{album}/{track} - {title}". Supported fields are {title}, {artist},
+// {album}, {year}, {track} and {_}; the last two are matched and ignored.
+type FilenamePattern struct {
+	pattern  string
+	regex    *regexp.Regexp
+	fields   []string
+	fullPath bool
+}
+
+var patternFieldRegex = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+func ParseFilenamePattern(pattern string) (*FilenamePattern, error) {
+	pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+	if pattern == "" {
+		return nil, errors.New("filename pattern is empty")
+	}
+
+	var expr strings.Builder
+	var fields []string
+	expr.WriteString("^")
+
+	last := 0
+	for _, loc := range patternFieldRegex.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		last = loc[1]
+
+		field := pattern[loc[2]:loc[3]]
+		switch field {
+		case "title", "artist", "album":
+			expr.WriteString(`([^/]+?)`)
+		case "year":
+			expr.WriteString(`(\d{4})`)
+		case "track":
+			expr.WriteString(`(\d+)`)
+		case "_":
+			expr.WriteString(`([^/]*?)`)
+		default:
+			return nil, fmt.Errorf("unknown field {%s} in filename pattern", field)
+		}
+		fields = append(fields, field)
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+
+	if len(fields) == 0 {
+		return nil, errors.New("filename pattern has no fields")
+	}
+
+	return &FilenamePattern{
+		pattern:  pattern,
+		regex:    regexp.MustCompile(expr.String()),
+		fields:   fields,
+		fullPath: strings.Contains(pattern, "/"),
+	}, nil
+}
+
+// Match applies the pattern to a slash-separated path relative to the library root,
+// without its extension. Patterns without a "/" only look at the file name.
+func (p *FilenamePattern) Match(relPath string) (models.Song, bool) {
+	var song models.Song
+
+	name := strings.TrimSuffix(relPath, path.Ext(relPath))
+	if !p.fullPath {
+		name = path.Base(name)
+	} else if depth := strings.Count(p.pattern, "/") + 1; strings.Count(name, "/")+1 > depth {
+		// Only match the trailing segments so the pattern works below any prefix
+		parts := strings.Split(name, "/")
+		name = strings.Join(parts[len(parts)-depth:], "/")
+	}
+
+	groups := p.regex.FindStringSubmatch(name)
+	if groups == nil {
+		return song, false
+	}
+
+	for i, field := range p.fields {
+		value := strings.TrimSpace(groups[i+1])
+		switch field {
+		case "title":
+			song.Title = value
+		case "artist":
+			song.Artist = value
+		case "album":
+			song.Album = value
+		case "year":
+			song.Year = parseYear(value)
+		}
+	}
+
+	return song, true
+}
+
+func (p *FilenamePattern) String() string {
+	return p.pattern
+}
+
+// MergeMetadata fills the empty fields of song from fallback
+func MergeMetadata(song, fallback models.Song) models.Song {
+	if song.Title == "" {
+		song.Title = fallback.Title
+	}
+	if song.Artist == "" {
+		song.Artist = fallback.Artist
+	}
+	if song.Album == "" {
+		song.Album = fallback.Album
+	}
+	if song.Year == 0 {
+		song.Year = fallback.Year
+	}
+	return song
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withInfoTags appends a LIST/INFO chunk to a WAV file and fixes up the RIFF size
+func withInfoTags(data []byte, tags map[string]string) []byte {
+	info := []byte("INFO")
+	for id, value := range tags {
+		body := append([]byte(value), 0)
+		if len(body)%2 == 1 {
+			body = append(body, 0)
+		}
+		info = append(info, id...)
+		info = binary.LittleEndian.AppendUint32(info, uint32(len(body)))
+		info = append(info, body...)
+	}
+
+	out := append([]byte{}, data...)
+	out = append(out, "LIST"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(info)))
+	out = append(out, info...)
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out
+}
+
+func TestReadWAVTags(t *testing.T) {
+	wavData := createToneWAV(t, 16000, 440)
+
+	t.Run("reads INFO chunk", func(t *testing.T) {
+		tagged := withInfoTags(wavData, map[string]string{
+			"INAM": "Song",
+			"IART": "Artist",
+			"IPRD": "Album",
+			"ICRD": "1997-05-21",
+		})
+
+		song, err := ReadWAVTags(tagged)
+		require.NoError(t, err)
+		assert.Equal(t, models.Song{Title: "Song", Artist: "Artist", Album: "Album", Year: 1997}, song)
+	})
+
+	t.Run("untagged file", func(t *testing.T) {
+		song, err := ReadWAVTags(wavData)
+		require.NoError(t, err)
+		assert.Equal(t, models.Song{}, song)
+	})
+
+	t.Run("not a WAV file", func(t *testing.T) {
+		_, err := ReadWAVTags([]byte("ID3 not a wav"))
+		assert.Error(t, err)
+	})
+}
+
+func TestFilenamePattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    models.Song
+		matched bool
+	}{
+		{
+			name:    "file name",
+			pattern: "{artist} - {title}",
+			path:    "library/Band - Some Song.wav",
+			want:    models.Song{Artist: "Band", Title: "Some Song"},
+			matched: true,
+		},
+		{
+			name:    "directories",
+			pattern: "{artist}/{year} - {album}/{track} {title}",
+			path:    "music/Band/1999 - Record/03 Third Song.wav",
+			want:    models.Song{Artist: "Band", Album: "Record", Year: 1999, Title: "Third Song"},
+			matched: true,
+		},
+		{
+			name:    "no match",
+			pattern: "{artist} - {title}",
+			path:    "untitled.wav",
+			matched: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := ParseFilenamePattern(tt.pattern)
+			require.NoError(t, err)
+
+			song, ok := pattern.Match(tt.path)
+			assert.Equal(t, tt.matched, ok)
+			assert.Equal(t, tt.want, song)
+		})
+	}
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		_, err := ParseFilenamePattern("{composer} - {title}")
+		assert.ErrorContains(t, err, "unknown field")
+	})
+}
+
+func TestMergeMetadata(t *testing.T) {
+	tags := models.Song{Title: "Tagged"}
+	fallback := models.Song{Title: "From name", Artist: "Band", Year: 2001}
+
+	assert.Equal(t, models.Song{Title: "Tagged", Artist: "Band", Year: 2001}, MergeMetadata(tags, fallback))
+}
@@ -1,78 +1,230 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/owenhochwald/harmonia/internal/metrics"
 	"github.com/owenhochwald/harmonia/internal/models"
 	"github.com/owenhochwald/harmonia/internal/repo"
 	"github.com/owenhochwald/harmonia/internal/storage"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// TargetSampleRate is the rate audio is resampled to before fingerprinting
+	TargetSampleRate = 16000
+	// SpectrogramWindow and SpectrogramHop are the STFT window and hop sizes, in samples
+	SpectrogramWindow = 2048
+	SpectrogramHop    = 512
+	// MaxMatches caps how many candidates Identify returns
+	MaxMatches = 5
 )
 
 type MusicServiceInterface interface {
-	HandleUpload(data []byte) (*models.Song, error)
-	Identify(ctx context.Context, hash string) ([]models.Song, error)
+	HandleUpload(ctx context.Context, song models.Song, data []byte) (*models.Song, error)
+	Identify(ctx context.Context, data []byte) ([]Match, error)
 }
 
 type MusicService struct {
 	Storage            storage.Storage
 	Repo               repo.SongRepo
+	UnitOfWork         repo.UnitOfWork
 	AudioService       AudioServiceInterface
 	FingerprintService FingerprintServiceInterface
+	Duplicates         DuplicatePolicy
 }
 
-func NewMusicService(storage storage.Storage, repo repo.SongRepo, audioService AudioServiceInterface, fingerprintService FingerprintServiceInterface) MusicServiceInterface {
+func NewMusicService(storage storage.Storage, repo repo.SongRepo, unitOfWork repo.UnitOfWork, audioService AudioServiceInterface, fingerprintService FingerprintServiceInterface, duplicates DuplicatePolicy) MusicServiceInterface {
 	return &MusicService{
 		Storage:            storage,
 		Repo:               repo,
+		UnitOfWork:         unitOfWork,
 		AudioService:       audioService,
 		FingerprintService: fingerprintService,
+		Duplicates:         duplicates,
 	}
 }
 
-func (s *MusicService) HandleUpload(data []byte) (*models.Song, error) {
-	_, err := s.AudioService.ReadWAVProperties(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("error getting wav file metadata: %w", err)
+// HandleUpload fingerprints the audio and persists it along with the song metadata,
+// in one transaction so a failure never leaves a song without its fingerprints.
+// A song ID is reserved from the repo when the song does not carry one. Uploads
+// already in the tenant's catalog fail with a *DuplicateError, or are saved with
+// DuplicateOf set when the policy flags near-duplicates.
+func (s *MusicService) HandleUpload(ctx context.Context, song models.Song, data []byte) (saved *models.Song, err error) {
+	ctx, span := tracing.Start(ctx, "MusicService.HandleUpload", attribute.Int("bytes", len(data)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateSongMetadata(song); err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, models.Errorf(models.ErrValidation, "empty data")
 	}
 
-	processed, err := s.AudioService.ConvertToMono(data)
+	// Identical audio is caught before the expensive pipeline runs
+	song.PCMHash, err = PCMHash(data)
 	if err != nil {
-		return nil, fmt.Errorf("error converting wav file: %w", err)
+		return nil, err
 	}
-	processed, err = s.AudioService.Resample(processed, 16000)
+	existing, err := s.findExactDuplicate(ctx, song.PCMHash)
 	if err != nil {
-		return nil, fmt.Errorf("error resampling wav file: %w", err)
+		return nil, err
 	}
-	processed, err = s.AudioService.Normalize(processed)
+	if existing != nil {
+		return nil, &DuplicateError{SongID: existing.ID, Coverage: 1, Exact: true}
+	}
+
+	progress := ProgressFromContext(ctx)
+	samples := 0
+	fingerprints, err := s.Fingerprint(ctx, data, func(event ProgressEvent) {
+		samples = event.Samples
+		if progress != nil {
+			progress(event)
+		}
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error normalizing wav file: %w", err)
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	spectrogram, err := s.AudioService.Spectrogram(processed, 2048, 512)
+	match, err := s.findNearDuplicate(ctx, fingerprints)
 	if err != nil {
-		return nil, fmt.Errorf("error getting spectrogram for wav file: %w", err)
+		return nil, err
+	}
+	if match != nil {
+		if s.Duplicates.Action != DuplicateFlag {
+			return nil, &DuplicateError{SongID: match.SongID, Coverage: match.Confidence}
+		}
+		song.DuplicateOf = match.SongID
+		span.SetAttributes(attribute.String("song.duplicate_of", match.SongID))
 	}
 
-	_, err = s.FingerprintService.GenerateFingerprints(spectrogram)
+	started := time.Now()
+	if song.ID == "" {
+		song.ID, err = s.Repo.NextID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error reserving song id: %w", err)
+		}
+	}
+	if song.CreatedAt.IsZero() {
+		song.CreatedAt = time.Now().UTC()
+	}
+	if song.ContentHash == "" {
+		song.ContentHash = ContentHash(data)
+	}
 
-	song := models.Song{}
+	span.SetAttributes(attribute.String("song.id", song.ID))
 
-	//song := models.Song{
-	//	// add title
-	//	// add artist
-	//	// add album
-	//	// add year
-	//
-	//}
+	err = s.UnitOfWork.WithTx(ctx, func(tx repo.Repos) error {
+		if err := tx.Songs.SaveSong(ctx, song); err != nil {
+			return fmt.Errorf("error saving song: %w", err)
+		}
 
-	s.Repo.SaveSong(song)
+		if err := saveFingerprints(ctx, tx.Fingerprints, song.ID, fingerprints); err != nil {
+			return fmt.Errorf("error saving fingerprints: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	progress.report(ctx, StagePersist, samples, len(fingerprints), started)
+	metrics.FingerprintsPerUpload.Observe(float64(len(fingerprints)))
 
 	return &song, nil
 }
 
-// TODO: Implement full functionality
-func (s *MusicService) Identify(ctx context.Context, hash string) ([]models.Song, error) {
-	return nil, nil
+// ContentHash identifies an audio file by the SHA-256 of its bytes
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validateSongMetadata(song models.Song) error {
+	if strings.TrimSpace(song.Title) == "" {
+		return models.Errorf(models.ErrValidation, "malformed song: title is required")
+	}
+	if strings.TrimSpace(song.Artist) == "" {
+		return models.Errorf(models.ErrValidation, "malformed song: artist is required")
+	}
+	// The range the repos accept, checked here so it fails before the audio is stored
+	if maxYear := time.Now().Year() + 1; song.Year < 1800 || song.Year > maxYear {
+		return models.Errorf(models.ErrValidation, "malformed song: year must be between 1800 and %d, got %d", maxYear, song.Year)
+	}
+	return nil
+}
+
+// Fingerprint runs the audio pipeline on a WAV file and returns its fingerprints,
+// reporting each stage to progress
+func (s *MusicService) Fingerprint(ctx context.Context, data []byte, progress ProgressFunc) ([]models.Fingerprint, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+
+	spectrogram, err := s.AudioService.Analyze(ctx, data, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints, err := s.FingerprintService.GenerateFingerprints(ctx, spectrogram, progress)
+	if err != nil {
+		return nil, fmt.Errorf("error generating fingerprints: %w", err)
+	}
+
+	return fingerprints, nil
+}
+
+// Identify fingerprints an audio clip and returns the best matching songs, best first
+func (s *MusicService) Identify(ctx context.Context, data []byte) (matches []Match, err error) {
+	ctx, span := tracing.Start(ctx, "MusicService.Identify", attribute.Int("bytes", len(data)))
+	defer func() {
+		if len(matches) > 0 {
+			span.SetAttributes(attribute.String("match.song_id", matches[0].SongID), attribute.Int("match.score", matches[0].Score))
+		}
+		tracing.End(span, err)
+	}()
+
+	fingerprints, err := s.Fingerprint(ctx, data, ProgressFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fingerprints) == 0 {
+		return []Match{}, nil
+	}
+
+	matches, err = s.FingerprintService.MatchFingerprints(ctx, fingerprints)
+	if err != nil {
+		return nil, fmt.Errorf("error matching fingerprints: %w", err)
+	}
+
+	if len(matches) > MaxMatches {
+		matches = matches[:MaxMatches]
+	}
+
+	for i := range matches {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		song, err := s.Repo.FindById(ctx, matches[i].SongID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading matched song: %w", err)
+		}
+		matches[i].Song = song
+		matches[i].Offset = float64(matches[i].OffsetFrames) * SpectrogramHop / TargetSampleRate
+	}
+
+	return matches, nil
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/owenhochwald/harmonia/internal/models"
+	"github.com/stretchr/testify/mock"
 )
 
 type MockStorage struct{}
@@ -21,6 +22,10 @@ func (m MockStorage) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+func (m MockStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
 type MockRepository struct{}
 
 func (m MockRepository) FindById(id int) error {
@@ -52,3 +57,23 @@ func MockSongFactory() models.Song {
 		CreatedAt:   time.Now(),
 	}
 }
+
+type MockMusicService struct {
+	mock.Mock
+}
+
+func (m *MockMusicService) HandleUpload(ctx context.Context, song models.Song, data []byte) (*models.Song, error) {
+	args := m.Called(ctx, song, data)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Song), args.Error(1)
+}
+
+func (m *MockMusicService) Identify(ctx context.Context, data []byte) ([]Match, error) {
+	args := m.Called(ctx, data)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]Match), args.Error(1)
+}
@@ -2,11 +2,18 @@ package services
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/owenhochwald/harmonia/internal/models"
 	"github.com/owenhochwald/harmonia/internal/repo"
+	"github.com/owenhochwald/harmonia/internal/testaudio"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var (
@@ -16,54 +23,263 @@ var (
 )
 
 func setupService() (*MusicService, context.Context, models.Song) {
+	songRepo := repo.NewMockSongRepo()
+	fingerprintRepo := repo.NewMockFingerprintRepo()
+	unitOfWork := repo.NewMockUnitOfWork(repo.Repos{Songs: songRepo, Fingerprints: fingerprintRepo})
+	unitOfWork.On("WithTx", mock.Anything).Return(nil).Maybe()
+	songRepo.On("FindByPCMHash", mock.Anything, mock.Anything).Return(nil, nil).Maybe()
+
 	service = &MusicService{
-		Storage: MockStorage{},
-		Repo:    &repo.MockSongRepo{},
+		Storage:            MockStorage{},
+		Repo:               songRepo,
+		UnitOfWork:         unitOfWork,
+		AudioService:       NewAudioService(),
+		FingerprintService: NewFingerprintService(fingerprintRepo),
 	}
 	testSong = MockSongFactory()
 
 	return service, ctx, testSong
 }
 
+func createToneWAV(t *testing.T, sampleRate int, frequencies ...float64) []byte {
+	format := testaudio.Format{SampleRate: sampleRate, BitDepth: 16, Channels: 1}
+	return testaudio.WAV(t, format, testaudio.Chord(sampleRate, 1, frequencies...))
+}
+
 func TestHandleUpload_Success(t *testing.T) {
 	service, ctx, testSong := setupService()
-	err := service.HandleUpload(ctx, testSong, []byte("test data"))
-	assert.Nil(t, err)
-	assert.NoError(t, err)
+	songRepo := service.Repo.(*repo.MockSongRepo)
+	fingerprintRepo := service.FingerprintService.(*FingerprintService).Repo.(*repo.MockFingerprintRepo)
+
+	testSong.ID = ""
+	songRepo.On("NextID", mock.Anything).Return("7", nil).Once()
+	songRepo.On("SaveSong", mock.Anything, mock.MatchedBy(func(s models.Song) bool { return s.ID == "7" })).Return(nil).Once()
+	fingerprintRepo.On("SaveFingerprints", mock.Anything, mock.MatchedBy(func(fps []models.Fingerprint) bool {
+		for _, fp := range fps {
+			if fp.SongID != 7 {
+				return false
+			}
+		}
+		return true
+	})).Return(nil).Once()
+
+	song, err := service.HandleUpload(ctx, testSong, createToneWAV(t, 16000, 440, 1200, 3000))
+	require.NoError(t, err)
+	assert.Equal(t, "7", song.ID)
+	assert.Equal(t, testSong.Title, song.Title)
+	songRepo.AssertExpectations(t)
+	fingerprintRepo.AssertExpectations(t)
+	assert.Equal(t, 1, service.UnitOfWork.(*repo.MockUnitOfWork).Commits)
+}
+
+func TestHandleUpload_RollsBackWhenFingerprintsFail(t *testing.T) {
+	service, ctx, testSong := setupService()
+	songRepo := service.Repo.(*repo.MockSongRepo)
+	fingerprintRepo := service.FingerprintService.(*FingerprintService).Repo.(*repo.MockFingerprintRepo)
+	unitOfWork := service.UnitOfWork.(*repo.MockUnitOfWork)
+
+	songRepo.On("SaveSong", mock.Anything, mock.Anything).Return(nil).Once()
+	fingerprintRepo.On("SaveFingerprints", mock.Anything, mock.Anything).Return(errors.New("connection reset")).Once()
+
+	_, err := service.HandleUpload(ctx, testSong, createToneWAV(t, 16000, 440, 1200, 3000))
+	assert.ErrorContains(t, err, "error saving fingerprints")
+	assert.Equal(t, 0, unitOfWork.Commits)
+	assert.Equal(t, 1, unitOfWork.Rollbacks, "the song is not kept without its fingerprints")
+}
+
+func TestHandleUpload_ReportsProgress(t *testing.T) {
+	service, ctx, testSong := setupService()
+	songRepo := service.Repo.(*repo.MockSongRepo)
+	fingerprintRepo := service.FingerprintService.(*FingerprintService).Repo.(*repo.MockFingerprintRepo)
+	songRepo.On("SaveSong", mock.Anything, mock.Anything).Return(nil).Once()
+	fingerprintRepo.On("SaveFingerprints", mock.Anything, mock.Anything).Return(nil).Once()
+
+	var events []ProgressEvent
+	ctx = WithProgress(ctx, func(event ProgressEvent) { events = append(events, event) })
+
+	_, err := service.HandleUpload(ctx, testSong, createToneWAV(t, 44100, 440, 1200, 3000))
+	require.NoError(t, err)
+
+	stages := make([]Stage, len(events))
+	for i, event := range events {
+		stages[i] = event.Stage
+	}
+	assert.Equal(t, Stages, stages)
+
+	assert.Equal(t, 44100, events[0].Samples, "decode counts source samples")
+	assert.Equal(t, 16000, events[2].Samples, "resample counts target samples")
+	assert.NotZero(t, events[len(events)-1].Count, "persist counts fingerprints")
 }
 
 func TestHandleUpload_Fail_EmptyData(t *testing.T) {
 	service, ctx, testSong := setupService()
-	err := service.HandleUpload(ctx, testSong, nil)
-	assert.ErrorContains(t, err, "Empty data")
+	_, err := service.HandleUpload(ctx, testSong, nil)
+	assert.ErrorContains(t, err, "empty data")
 }
 
 func TestHandleUpload_Fail_MalformedSong(t *testing.T) {
 	service, ctx, _ := setupService()
-	err := service.HandleUpload(ctx, models.Song{}, nil)
-	assert.ErrorContains(t, err, "Malformed song")
+	_, err := service.HandleUpload(ctx, models.Song{}, nil)
+	assert.ErrorContains(t, err, "malformed song")
+}
+
+func TestHandleUpload_RejectsIdenticalAudio(t *testing.T) {
+	service, ctx, testSong := setupService()
+	songRepo := service.Repo.(*repo.MockSongRepo)
+	data := createToneWAV(t, 16000, 440, 1200, 3000)
+	pcmHash, err := PCMHash(data)
+	require.NoError(t, err)
+
+	songRepo.ExpectedCalls = nil
+	songRepo.On("FindByPCMHash", mock.Anything, pcmHash).Return(&models.Song{ID: "3"}, nil).Once()
+
+	_, err = service.HandleUpload(ctx, testSong, data)
+	assert.ErrorIs(t, err, models.ErrDuplicate)
+	var duplicate *DuplicateError
+	require.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, DuplicateError{SongID: "3", Coverage: 1, Exact: true}, *duplicate)
+	songRepo.AssertNotCalled(t, "SaveSong", mock.Anything, mock.Anything)
+}
+
+func TestHandleUpload_NearDuplicates(t *testing.T) {
+	rate := TargetSampleRate
+	melody := testaudio.Melody(rate, 10, 1)
+	// The same recording, a little noisier, as from a re-encode
+	reencoded := testaudio.WAV(t, testaudio.Mono16k, testaudio.Mix(melody, testaudio.Noise(rate, 10, 0.01, 9)))
+
+	newService := func(policy DuplicatePolicy) MusicServiceInterface {
+		songs, fingerprints := repo.NewMemorySongRepo(), repo.NewMemoryFingerprintRepo()
+		service := NewMusicService(nil, songs, repo.NewMemoryUnitOfWork(songs, fingerprints), NewAudioService(), NewFingerprintService(fingerprints), policy)
+		original, err := service.HandleUpload(ctx, models.Song{Title: "Melody", Artist: "testaudio", Year: 2024, S3Key: "melody.wav"},
+			testaudio.WAV(t, testaudio.Mono16k, melody))
+		require.NoError(t, err)
+		require.Equal(t, "1", original.ID)
+		return service
+	}
+	upload := models.Song{Title: "Melody (Remastered)", Artist: "testaudio", Year: 2025, S3Key: "melody-2.wav"}
+
+	t.Run("rejects", func(t *testing.T) {
+		service := newService(DefaultDuplicatePolicy())
+
+		_, err := service.HandleUpload(ctx, upload, reencoded)
+		var duplicate *DuplicateError
+		require.ErrorAs(t, err, &duplicate)
+		assert.Equal(t, "1", duplicate.SongID)
+		assert.False(t, duplicate.Exact)
+		assert.GreaterOrEqual(t, duplicate.Coverage, 0.5)
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		service := newService(DuplicatePolicy{Threshold: 0.5, Action: DuplicateFlag})
+
+		song, err := service.HandleUpload(ctx, upload, reencoded)
+		require.NoError(t, err)
+		assert.Equal(t, "2", song.ID)
+		assert.Equal(t, "1", song.DuplicateOf)
+	})
+
+	t.Run("accepts other songs", func(t *testing.T) {
+		service := newService(DefaultDuplicatePolicy())
+
+		song, err := service.HandleUpload(ctx, upload, testaudio.WAV(t, testaudio.Mono16k, testaudio.Melody(rate, 10, 2)))
+		require.NoError(t, err)
+		assert.Empty(t, song.DuplicateOf)
+	})
+
+	t.Run("can be turned off", func(t *testing.T) {
+		service := newService(DuplicatePolicy{})
+
+		song, err := service.HandleUpload(ctx, upload, reencoded)
+		require.NoError(t, err)
+		assert.Empty(t, song.DuplicateOf)
+	})
 }
 
 func TestMusicService_Identify_Success(t *testing.T) {
 	service, ctx, testSong := setupService()
+	songRepo := service.Repo.(*repo.MockSongRepo)
+	fingerprintRepo := service.FingerprintService.(*FingerprintService).Repo.(*repo.MockFingerprintRepo)
+
+	clip := createToneWAV(t, 16000, 440, 1200, 3000)
+	stored, err := service.Fingerprint(ctx, clip, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, stored)
+	for i := range stored {
+		stored[i].SongID = 1
+	}
 
-	songs, err := service.Identify(ctx, "test song fingerprint")
-	assert.Nil(t, err)
-	assert.Equal(t, testSong, songs[0])
+	testSong.ID = "1"
+	fingerprintRepo.On("FindByHashes", mock.Anything, mock.Anything).Return(stored, nil).Once()
+	songRepo.On("FindById", mock.Anything, "1").Return(&testSong, nil).Once()
+
+	matches, err := service.Identify(ctx, clip)
+	require.NoError(t, err)
+	require.NotEmpty(t, matches)
+	assert.Equal(t, "1", matches[0].SongID)
+	assert.Equal(t, testSong, *matches[0].Song)
+	assert.Equal(t, 0, matches[0].OffsetFrames)
+	assert.GreaterOrEqual(t, matches[0].Confidence, 1.0)
 }
 
 func TestMusicService_Identify_Fail_MissingRecord(t *testing.T) {
-	service, ctx, testSong := setupService()
+	service, ctx, _ := setupService()
+	fingerprintRepo := service.FingerprintService.(*FingerprintService).Repo.(*repo.MockFingerprintRepo)
+	fingerprintRepo.On("FindByHashes", mock.Anything, mock.Anything).Return([]models.Fingerprint{}, nil).Once()
 
-	songs, err := service.Identify(ctx, "missing song")
-	assert.ErrorContains(t, err, "No found record")
-	assert.NotEqual(t, testSong, songs[0])
+	matches, err := service.Identify(ctx, createToneWAV(t, 16000, 440, 1200, 3000))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
 }
 
 func TestMusicService_Identify_Fail_MalformedHash(t *testing.T) {
-	service, ctx, testSong := setupService()
+	service, ctx, _ := setupService()
+
+	_, err := service.Identify(ctx, nil)
+	assert.ErrorContains(t, err, "empty data")
+
+	_, err = service.Identify(ctx, []byte("not a wav file"))
+	assert.ErrorContains(t, err, "error getting wav file metadata")
+}
+
+func TestIdentify_TracesPipeline(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, _, song := setupService()
+	songs, fingerprints := repo.NewMemorySongRepo(), repo.NewMemoryFingerprintRepo()
+	service := NewMusicService(nil, songs, repo.NewMemoryUnitOfWork(songs, fingerprints), NewAudioService(), NewFingerprintService(fingerprints), DuplicatePolicy{})
+	_, err := service.HandleUpload(ctx, song, createToneWAV(t, 16000, 440, 1200, 3000))
+	require.NoError(t, err)
+
+	uploadSpans := len(recorder.Ended())
+
+	_, err = service.Identify(ctx, createToneWAV(t, 16000, 440, 1200, 3000))
+	require.NoError(t, err)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended()[uploadSpans:] {
+		spans[span.Name()] = span
+	}
+	parent := func(name string) string {
+		span, ok := spans[name]
+		require.True(t, ok, "missing span %s", name)
+		for other, candidate := range spans {
+			if candidate.SpanContext().SpanID() == span.Parent().SpanID() {
+				return other
+			}
+		}
+		return ""
+	}
 
-	songs, err := service.Identify(ctx, "")
-	assert.ErrorContains(t, err, "Malformed hash")
-	assert.NotEqual(t, testSong, songs[0])
+	assert.Equal(t, "", parent("MusicService.Identify"))
+	assert.Equal(t, "MusicService.Identify", parent("AudioService.Analyze"))
+	assert.Equal(t, "AudioService.Analyze", parent("stage spectrogram"))
+	assert.Equal(t, "MusicService.Identify", parent("FingerprintService.GenerateFingerprints"))
+	assert.Equal(t, "FingerprintService.GenerateFingerprints", parent("stage hashes"))
+	assert.Equal(t, "MusicService.Identify", parent("FingerprintService.MatchFingerprints"))
+	// Repo spans are opened by the SQL repos, the memory repos used here have none
+	assert.NotContains(t, spans, "SongRepo.FindById")
 }
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/owenhochwald/harmonia/internal/metrics"
+	"github.com/owenhochwald/harmonia/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Stage is a step of the ingest pipeline
+type Stage string
+
+const (
+	StageDecode      Stage = "decode"
+	StageMono        Stage = "mono"
+	StageResample    Stage = "resample"
+	StageNormalize   Stage = "normalize"
+	StageSpectrogram Stage = "spectrogram"
+	StagePeaks       Stage = "peaks"
+	StageHashes      Stage = "hashes"
+	StagePersist     Stage = "persist"
+)
+
+// Stages lists the pipeline stages in the order they run
+var Stages = []Stage{
+	StageDecode,
+	StageMono,
+	StageResample,
+	StageNormalize,
+	StageSpectrogram,
+	StagePeaks,
+	StageHashes,
+	StagePersist,
+}
+
+// Step is the 1-based position of the stage in Stages, or 0 if unknown
+func (s Stage) Step() int {
+	for i, stage := range Stages {
+		if stage == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ProgressEvent reports a finished pipeline stage
+type ProgressEvent struct {
+	Stage   Stage
+	Samples int           // Audio samples the stage produced or worked on
+	Count   int           // Items the stage produced: frames, peaks, hashes or fingerprints saved
+	Elapsed time.Duration // Time spent in the stage
+}
+
+// ProgressFunc receives pipeline progress. A nil ProgressFunc discards events.
+type ProgressFunc func(ProgressEvent)
+
+// report also records the stage duration and a span for it under ctx, so it runs
+// even without a listener
+func (fn ProgressFunc) report(ctx context.Context, stage Stage, samples, count int, started time.Time) {
+	elapsed := time.Since(started)
+	metrics.StageDuration.WithLabelValues(string(stage)).Observe(elapsed.Seconds())
+
+	tracing.Record(ctx, "stage "+string(stage), started, attribute.Int("samples", samples), attribute.Int("count", count))
+
+	if fn == nil {
+		return
+	}
+	fn(ProgressEvent{
+		Stage:   stage,
+		Samples: samples,
+		Count:   count,
+		Elapsed: elapsed,
+	})
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context that carries fn to the services handling a request
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ProgressFromContext returns the ProgressFunc stored by WithProgress, or nil
+func ProgressFromContext(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/youpy/go-wav"
+)
+
+// StreamOptions controls how a live stream is identified
+type StreamOptions struct {
+	Window        time.Duration // Most recent audio considered on each pass
+	Hop           time.Duration // New audio required before running another pass
+	MinAudio      time.Duration // Audio needed before the first pass
+	Threshold     float64       // Confidence a candidate needs to be reported
+	MinScore      int           // Aligned hashes a candidate needs to be reported
+	ConfirmPasses int           // Consecutive passes with the same top song before it is final
+}
+
+func DefaultStreamOptions() StreamOptions {
+	return StreamOptions{
+		Window:        10 * time.Second,
+		Hop:           time.Second,
+		MinAudio:      3 * time.Second,
+		Threshold:     0.05,
+		MinScore:      10,
+		ConfirmPasses: 2,
+	}
+}
+
+// StreamPass is the outcome of one identification pass over the window
+type StreamPass struct {
+	Candidates []Match `json:"candidates"`
+	Final      *Match  `json:"final,omitempty"`
+	AudioSecs  float64 `json:"audio_seconds"`
+}
+
+// StreamIdentifier identifies a live mono 16-bit PCM stream by re-running
+// Identify over a sliding window every time enough new audio has arrived.
+type StreamIdentifier struct {
+	Music      MusicServiceInterface
+	SampleRate int
+	Options    StreamOptions
+
+	window    []int16
+	pending   int
+	received  int
+	best      *Match
+	lastTop   string
+	confirmed int
+}
+
+func NewStreamIdentifier(music MusicServiceInterface, sampleRate int, opts StreamOptions) (*StreamIdentifier, error) {
+	if sampleRate <= 0 {
+		return nil, errors.New("sample rate must be positive")
+	}
+	if opts.Window <= 0 || opts.Hop <= 0 {
+		return nil, errors.New("window and hop must be positive")
+	}
+
+	return &StreamIdentifier{
+		Music:      music,
+		SampleRate: sampleRate,
+		Options:    opts,
+	}, nil
+}
+
+// Write appends samples to the window. It returns a pass when one was run,
+// or nil when more audio is needed first.
+func (s *StreamIdentifier) Write(ctx context.Context, samples []int16) (*StreamPass, error) {
+	s.window = append(s.window, samples...)
+	s.pending += len(samples)
+	s.received += len(samples)
+
+	if limit := s.samples(s.Options.Window); len(s.window) > limit {
+		s.window = append(s.window[:0], s.window[len(s.window)-limit:]...)
+	}
+
+	if s.received < s.samples(s.Options.MinAudio) || s.pending < s.samples(s.Options.Hop) {
+		return nil, nil
+	}
+
+	return s.run(ctx)
+}
+
+// Flush runs a last pass over whatever audio is buffered
+func (s *StreamIdentifier) Flush(ctx context.Context) (*StreamPass, error) {
+	if len(s.window) < SpectrogramWindow {
+		return &StreamPass{Candidates: []Match{}, AudioSecs: s.seconds()}, nil
+	}
+	return s.run(ctx)
+}
+
+// Best is the strongest candidate reported so far, if any
+func (s *StreamIdentifier) Best() *Match {
+	return s.best
+}
+
+func (s *StreamIdentifier) run(ctx context.Context) (*StreamPass, error) {
+	s.pending = 0
+
+	matches, err := s.Music.Identify(ctx, EncodePCM16(s.window, uint32(s.SampleRate), 1))
+	if err != nil {
+		return nil, fmt.Errorf("error identifying stream: %w", err)
+	}
+
+	pass := &StreamPass{Candidates: []Match{}, AudioSecs: s.seconds()}
+	for _, match := range matches {
+		if match.Confidence >= s.Options.Threshold && match.Score >= s.Options.MinScore {
+			pass.Candidates = append(pass.Candidates, match)
+		}
+	}
+
+	if len(pass.Candidates) == 0 {
+		s.lastTop, s.confirmed = "", 0
+		return pass, nil
+	}
+
+	top := pass.Candidates[0]
+	if s.best == nil || top.Score >= s.best.Score {
+		s.best = &top
+	}
+
+	if top.SongID == s.lastTop {
+		s.confirmed++
+	} else {
+		s.lastTop, s.confirmed = top.SongID, 1
+	}
+
+	if s.confirmed >= max(s.Options.ConfirmPasses, 1) {
+		pass.Final = &top
+	}
+
+	return pass, nil
+}
+
+func (s *StreamIdentifier) samples(d time.Duration) int {
+	return int(d.Seconds() * float64(s.SampleRate))
+}
+
+func (s *StreamIdentifier) seconds() float64 {
+	return float64(s.received) / float64(s.SampleRate)
+}
+
+// EncodePCM16 wraps interleaved 16-bit samples in a WAV container
+func EncodePCM16(samples []int16, sampleRate uint32, channels uint16) []byte {
+	frames := len(samples) / int(channels)
+	wavSamples := make([]wav.Sample, frames)
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < int(channels) && ch < 2; ch++ {
+			wavSamples[i].Values[ch] = int(samples[i*int(channels)+ch])
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := wav.NewWriter(&buf, uint32(frames), channels, sampleRate, 16)
+	// Writing to a bytes.Buffer can't fail
+	_ = writer.WriteSamples(wavSamples)
+
+	return buf.Bytes()
+}
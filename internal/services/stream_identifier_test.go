@@ -0,0 +1,91 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/youpy/go-wav"
+)
+
+func TestStreamIdentifier(t *testing.T) {
+	opts := StreamOptions{
+		Window:        2 * time.Second,
+		Hop:           500 * time.Millisecond,
+		MinAudio:      time.Second,
+		Threshold:     0.1,
+		MinScore:      5,
+		ConfirmPasses: 2,
+	}
+	chunk := make([]int16, 8000) // 500ms at 16kHz
+
+	t.Run("waits for enough audio then confirms a match", func(t *testing.T) {
+		music := &MockMusicService{}
+		identifier, err := NewStreamIdentifier(music, 16000, opts)
+		require.NoError(t, err)
+
+		music.On("Identify", mock.Anything, mock.Anything).Return([]Match{
+			{SongID: "1", Score: 20, Confidence: 0.4},
+			{SongID: "2", Score: 3, Confidence: 0.05},
+		}, nil)
+
+		pass, err := identifier.Write(context.Background(), chunk)
+		require.NoError(t, err)
+		assert.Nil(t, pass, "no pass before MinAudio")
+
+		pass, err = identifier.Write(context.Background(), chunk)
+		require.NoError(t, err)
+		require.NotNil(t, pass)
+		require.Len(t, pass.Candidates, 1, "weak candidates are filtered out")
+		assert.Equal(t, "1", pass.Candidates[0].SongID)
+		assert.Nil(t, pass.Final)
+		assert.InDelta(t, 1.0, pass.AudioSecs, 1e-9)
+
+		pass, err = identifier.Write(context.Background(), chunk)
+		require.NoError(t, err)
+		require.NotNil(t, pass)
+		require.NotNil(t, pass.Final)
+		assert.Equal(t, "1", pass.Final.SongID)
+		assert.Equal(t, "1", identifier.Best().SongID)
+	})
+
+	t.Run("keeps only the window", func(t *testing.T) {
+		music := &MockMusicService{}
+		identifier, err := NewStreamIdentifier(music, 16000, opts)
+		require.NoError(t, err)
+
+		var lastClip []byte
+		music.On("Identify", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			lastClip = args.Get(1).([]byte)
+		}).Return([]Match{}, nil)
+
+		for i := 0; i < 10; i++ {
+			_, err := identifier.Write(context.Background(), chunk)
+			require.NoError(t, err)
+		}
+
+		reader := wav.NewReader(bytes.NewReader(lastClip))
+		duration, err := reader.Duration()
+		require.NoError(t, err)
+		assert.Equal(t, opts.Window, duration)
+		assert.Nil(t, identifier.Best())
+	})
+
+	t.Run("flush with too little audio", func(t *testing.T) {
+		identifier, err := NewStreamIdentifier(&MockMusicService{}, 16000, opts)
+		require.NoError(t, err)
+
+		pass, err := identifier.Flush(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, pass.Candidates)
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewStreamIdentifier(&MockMusicService{}, 0, opts)
+		assert.Error(t, err)
+	})
+}
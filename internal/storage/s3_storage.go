@@ -6,4 +6,6 @@ type Storage interface {
 	Upload(ctx context.Context, key string, data []byte) error
 	Download(ctx context.Context, key string) ([]byte, error)
 	Delete(ctx context.Context, key string) error
+	// Ping checks the backend is reachable without touching any object
+	Ping(ctx context.Context) error
 }
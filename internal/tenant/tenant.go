@@ -0,0 +1,57 @@
+// Package tenant carries the catalog a request works on through its context.
+// Each label's songs live in a catalog of its own; the Global catalog is shared,
+// and tenants may be allowed to search it alongside theirs. Repos read the tenant
+// from the context, so every query is scoped without threading IDs through each
+// call, the same way pipeline progress travels with the context.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Global is the shared catalog, and the catalog of requests carrying no tenant,
+// such as command line tools or a server running without API keys
+const Global = "global"
+
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+type contextKey struct{}
+
+type scope struct {
+	id           string
+	searchGlobal bool
+}
+
+// With scopes ctx to the catalog of tenant id. With searchGlobal, lookups also
+// search the Global catalog; writes always go to id.
+func With(ctx context.Context, id string, searchGlobal bool) context.Context {
+	return context.WithValue(ctx, contextKey{}, scope{id: id, searchGlobal: searchGlobal})
+}
+
+// From returns the tenant whose catalog ctx writes to, Global when none is set
+func From(ctx context.Context) string {
+	if s, ok := ctx.Value(contextKey{}).(scope); ok && s.id != "" {
+		return s.id
+	}
+	return Global
+}
+
+// Search returns the catalogs lookups in ctx may read: the tenant's own, then
+// Global when the tenant may search it
+func Search(ctx context.Context) []string {
+	id := From(ctx)
+	if s, ok := ctx.Value(contextKey{}).(scope); ok && s.searchGlobal && id != Global {
+		return []string{id, Global}
+	}
+	return []string{id}
+}
+
+// Validate checks id is usable as a tenant: lowercase letters, digits, "-" and "_"
+func Validate(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid tenant %q, use up to 63 lowercase letters, digits, - and _", id)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScope(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, Global, From(ctx))
+	assert.Equal(t, []string{Global}, Search(ctx))
+
+	label := With(ctx, "acme", false)
+	assert.Equal(t, "acme", From(label))
+	assert.Equal(t, []string{"acme"}, Search(label))
+
+	shared := With(ctx, "acme", true)
+	assert.Equal(t, "acme", From(shared), "writes stay in the tenant's catalog")
+	assert.Equal(t, []string{"acme", Global}, Search(shared))
+
+	assert.Equal(t, []string{Global}, Search(With(ctx, Global, true)))
+}
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{"acme", "global", "label-2", "a_b"} {
+		assert.NoError(t, Validate(id), id)
+	}
+	for _, id := range []string{"", "Acme", "-acme", "a b", "a/b"} {
+		assert.Error(t, Validate(id), id)
+	}
+}
@@ -0,0 +1,105 @@
+// Package testaudio builds audio for tests in memory, so the audio and fingerprint
+// pipelines can be exercised across formats without binary fixtures. Signals are
+// mono float64 samples in [-1, 1]; WAV encodes them at any rate, bit depth and
+// channel count. Everything is deterministic for a given seed.
+package testaudio
+
+import (
+	"math"
+	"math/rand"
+)
+
+func length(sampleRate int, seconds float64) int {
+	return int(math.Round(seconds * float64(sampleRate)))
+}
+
+func Silence(sampleRate int, seconds float64) []float64 {
+	return make([]float64, length(sampleRate, seconds))
+}
+
+func Sine(sampleRate int, seconds, freq, amplitude float64) []float64 {
+	samples := make([]float64, length(sampleRate, seconds))
+	for i := range samples {
+		samples[i] = amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))
+	}
+	return samples
+}
+
+// Chord sums equal-amplitude sines, peaking at 0.8
+func Chord(sampleRate int, seconds float64, freqs ...float64) []float64 {
+	parts := make([][]float64, len(freqs))
+	for i, freq := range freqs {
+		parts[i] = Sine(sampleRate, seconds, freq, 0.8/float64(len(freqs)))
+	}
+	return Mix(parts...)
+}
+
+// Sweep glides logarithmically from one frequency to another
+func Sweep(sampleRate int, seconds, from, to float64) []float64 {
+	samples := make([]float64, length(sampleRate, seconds))
+	k := math.Log(to / from)
+	phase := 0.0
+	for i := range samples {
+		t := float64(i) / float64(len(samples))
+		phase += 2 * math.Pi * from * math.Exp(k*t) / float64(sampleRate)
+		samples[i] = 0.8 * math.Sin(phase)
+	}
+	return samples
+}
+
+// Noise is uniform white noise
+func Noise(sampleRate int, seconds, amplitude float64, seed int64) []float64 {
+	rng := rand.New(rand.NewSource(seed))
+	samples := make([]float64, length(sampleRate, seconds))
+	for i := range samples {
+		samples[i] = amplitude * (rng.Float64()*2 - 1)
+	}
+	return samples
+}
+
+// Burst is a noise burst surrounded by silence
+func Burst(sampleRate int, before, burst, after float64, seed int64) []float64 {
+	return Concat(Silence(sampleRate, before), Noise(sampleRate, burst, 0.8, seed), Silence(sampleRate, after))
+}
+
+// Melody is a sequence of random quarter-second two-note chords, one low and one high.
+// Different seeds give songs that don't share fingerprints.
+func Melody(sampleRate int, seconds float64, seed int64) []float64 {
+	rng := rand.New(rand.NewSource(seed))
+	samples := make([]float64, length(sampleRate, seconds))
+	noteLength := sampleRate / 4
+
+	var low, high float64
+	for i := range samples {
+		if i%noteLength == 0 {
+			low = 200 + rng.Float64()*1800
+			high = 2000 + rng.Float64()*3000
+		}
+		t := float64(i) / float64(sampleRate)
+		samples[i] = 0.4*math.Sin(2*math.Pi*low*t) + 0.2*math.Sin(2*math.Pi*high*t)
+	}
+	return samples
+}
+
+func Concat(parts ...[]float64) []float64 {
+	var out []float64
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+// Mix adds signals together; the result is as long as the longest
+func Mix(parts ...[]float64) []float64 {
+	size := 0
+	for _, part := range parts {
+		size = max(size, len(part))
+	}
+	out := make([]float64, size)
+	for _, part := range parts {
+		for i, v := range part {
+			out[i] += v
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package testaudio
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youpy/go-wav"
+)
+
+func TestWAV_RoundTrip(t *testing.T) {
+	signal := Concat(Sweep(8000, 0.25, 100, 3000), Burst(8000, 0.05, 0.1, 0.05, 1), Chord(8000, 0.25, 440, 660))
+
+	for _, bits := range []int{8, 16, 24, 32} {
+		for _, channels := range []int{1, 2, 6} {
+			format := Format{SampleRate: 8000, BitDepth: bits, Channels: channels}
+			t.Run(fmt.Sprintf("%dbit %dch", bits, channels), func(t *testing.T) {
+				data := WAV(t, format, signal)
+				assert.Len(t, data, 44+len(signal)*channels*bits/8)
+
+				decoded, samples := Decode(t, data)
+				assert.Equal(t, format, decoded)
+				require.Len(t, samples, channels)
+
+				tolerance := 1.5 / float64(int(1)<<(bits-1))
+				for ch := range samples {
+					require.Len(t, samples[ch], len(signal))
+					assert.InDeltaSlice(t, signal, samples[ch], tolerance)
+				}
+			})
+		}
+	}
+}
+
+func TestWAV_ReadableByDecoder(t *testing.T) {
+	left, right := Sine(22050, 0.1, 440, 0.5), Sine(22050, 0.1, 880, 0.25)
+	data := WAV(t, Format{SampleRate: 22050, BitDepth: 16, Channels: 2}, left, right)
+
+	reader := wav.NewReader(bytes.NewReader(data))
+	format, err := reader.Format()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(2), format.NumChannels)
+	assert.Equal(t, uint32(22050), format.SampleRate)
+
+	samples, err := reader.ReadSamples(uint32(len(left)))
+	require.NoError(t, err)
+	require.Len(t, samples, len(left))
+	assert.InDelta(t, left[10]*32767, reader.IntValue(samples[10], 0), 1)
+	assert.InDelta(t, right[10]*32767, reader.IntValue(samples[10], 1), 1)
+}
+
+func TestSignals(t *testing.T) {
+	assert.Len(t, Silence(16000, 0.5), 8000)
+	assert.Len(t, Burst(16000, 0.1, 0.2, 0.3, 1), 9600)
+	assert.Equal(t, Melody(16000, 1, 7), Melody(16000, 1, 7), "deterministic for a seed")
+	assert.NotEqual(t, Melody(16000, 1, 7), Melody(16000, 1, 8))
+	assert.Len(t, Mix(Silence(100, 1), Silence(100, 2)), 200)
+
+	for _, v := range Chord(16000, 1, 220, 330, 440, 550) {
+		require.LessOrEqual(t, v, 0.8+1e-9)
+	}
+}
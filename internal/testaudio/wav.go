@@ -0,0 +1,129 @@
+package testaudio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// Format describes the PCM layout of a generated WAV file
+type Format struct {
+	SampleRate int
+	BitDepth   int // 8, 16, 24 or 32
+	Channels   int
+}
+
+var (
+	Mono16k  = Format{SampleRate: 16000, BitDepth: 16, Channels: 1}
+	CDStereo = Format{SampleRate: 44100, BitDepth: 16, Channels: 2}
+)
+
+// WAV encodes signals as a canonical 44 byte header PCM file. A single signal is copied
+// to every channel, otherwise there must be one per channel. Samples are clipped to
+// [-1, 1], and 8 bit audio is unsigned as the format requires.
+func WAV(t testing.TB, format Format, channels ...[]float64) []byte {
+	t.Helper()
+
+	switch format.BitDepth {
+	case 8, 16, 24, 32:
+	default:
+		t.Fatalf("testaudio: unsupported bit depth %d", format.BitDepth)
+	}
+	if format.SampleRate <= 0 || format.Channels <= 0 {
+		t.Fatalf("testaudio: invalid format %+v", format)
+	}
+	if len(channels) == 1 {
+		for len(channels) < format.Channels {
+			channels = append(channels, channels[0])
+		}
+	}
+	if len(channels) != format.Channels {
+		t.Fatalf("testaudio: got %d signals for %d channels", len(channels), format.Channels)
+	}
+
+	frames := len(channels[0])
+	for _, channel := range channels {
+		if len(channel) != frames {
+			t.Fatalf("testaudio: channels have different lengths")
+		}
+	}
+
+	bytesPerSample := format.BitDepth / 8
+	blockAlign := bytesPerSample * format.Channels
+	dataSize := frames * blockAlign
+
+	var buf bytes.Buffer
+	buf.Grow(44 + dataSize)
+	le := binary.LittleEndian
+	buf.WriteString("RIFF")
+	binary.Write(&buf, le, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, le, uint32(16))
+	binary.Write(&buf, le, uint16(1)) // PCM
+	binary.Write(&buf, le, uint16(format.Channels))
+	binary.Write(&buf, le, uint32(format.SampleRate))
+	binary.Write(&buf, le, uint32(format.SampleRate*blockAlign))
+	binary.Write(&buf, le, uint16(blockAlign))
+	binary.Write(&buf, le, uint16(format.BitDepth))
+	buf.WriteString("data")
+	binary.Write(&buf, le, uint32(dataSize))
+
+	full := math.Pow(2, float64(format.BitDepth-1)) - 1
+	sample := make([]byte, 4)
+	for i := 0; i < frames; i++ {
+		for _, channel := range channels {
+			value := int32(math.Round(math.Max(-1, math.Min(1, channel[i])) * full))
+			if format.BitDepth == 8 {
+				value += 128
+			}
+			le.PutUint32(sample, uint32(value))
+			buf.Write(sample[:bytesPerSample])
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// Decode reads a file written by WAV back into one signal per channel
+func Decode(t testing.TB, data []byte) (Format, [][]float64) {
+	t.Helper()
+
+	if len(data) < 44 || string(data[0:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " || string(data[36:40]) != "data" {
+		t.Fatalf("testaudio: not a canonical WAV file")
+	}
+	le := binary.LittleEndian
+	format := Format{
+		Channels:   int(le.Uint16(data[22:24])),
+		SampleRate: int(le.Uint32(data[24:28])),
+		BitDepth:   int(le.Uint16(data[34:36])),
+	}
+
+	bytesPerSample := format.BitDepth / 8
+	body := data[44:]
+	frames := len(body) / (bytesPerSample * format.Channels)
+	full := math.Pow(2, float64(format.BitDepth-1)) - 1
+
+	channels := make([][]float64, format.Channels)
+	for ch := range channels {
+		channels[ch] = make([]float64, frames)
+	}
+	sample := make([]byte, 4)
+	for i := 0; i < frames; i++ {
+		for ch := range channels {
+			offset := (i*format.Channels + ch) * bytesPerSample
+			clear(sample)
+			copy(sample, body[offset:offset+bytesPerSample])
+
+			// Shift up and back down to sign extend
+			shift := 32 - format.BitDepth
+			value := int32(le.Uint32(sample)<<shift) >> shift
+			if format.BitDepth == 8 {
+				value = int32(sample[0]) - 128
+			}
+			channels[ch][i] = float64(value) / full
+		}
+	}
+
+	return format, channels
+}
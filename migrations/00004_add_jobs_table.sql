@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS jobs
+(
+    id         TEXT PRIMARY KEY,
+    status     TEXT      NOT NULL,
+    title      TEXT      NOT NULL,
+    artist     TEXT      NOT NULL,
+    album      TEXT      NOT NULL DEFAULT '',
+    year       INTEGER   NOT NULL,
+    s3_key     TEXT      NOT NULL,
+    song_id    TEXT,
+    error      TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS idx_jobs_status;
+DROP TABLE IF EXISTS jobs;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- Fingerprints live in their own table, songs are saved without a blob
+ALTER TABLE songs ALTER COLUMN fingerprint DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+UPDATE songs SET fingerprint = '' WHERE fingerprint IS NULL;
+ALTER TABLE songs ALTER COLUMN fingerprint SET NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- SHA-256 of the ingested file, used to skip files that were already ingested
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS content_hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_songs_content_hash ON songs(content_hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS idx_songs_content_hash;
+ALTER TABLE songs DROP COLUMN IF EXISTS content_hash;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id         TEXT PRIMARY KEY,
+    name       TEXT      NOT NULL,
+    prefix     TEXT      NOT NULL,
+    key_hash   TEXT      NOT NULL UNIQUE, -- SHA-256 of the key, the key itself is never stored
+    scopes     TEXT[]    NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- Requests per API key, scope and UTC day, checked against the daily quotas
+CREATE TABLE IF NOT EXISTS api_key_usage
+(
+    api_key_id TEXT    NOT NULL REFERENCES api_keys (id) ON DELETE CASCADE,
+    scope      TEXT    NOT NULL,
+    day        DATE    NOT NULL,
+    requests   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, scope, day)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS api_key_usage;
+-- +goose StatementEnd
@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- Every catalog row belongs to a tenant; existing rows form the shared global catalog.
+-- Fingerprints repeat their song's tenant so hash lookups filter without a join.
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'global';
+ALTER TABLE fingerprints ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'global';
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'global';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'global';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS search_global BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Two labels may ingest the same file, duplicates are only skipped within a catalog
+DROP INDEX IF EXISTS idx_songs_content_hash;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_songs_tenant_content_hash ON songs(tenant_id, content_hash);
+
+DROP INDEX IF EXISTS idx_fingerprints_hash;
+CREATE INDEX IF NOT EXISTS idx_fingerprints_hash_tenant ON fingerprints(hash, tenant_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- Without tenant_id every row falls back into one catalog: tenant keys would read it all and
+-- content hashes that two tenants share would break the global unique index. Refuse before
+-- touching anything; remove or move the tenant rows first to roll back.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM songs WHERE tenant_id <> 'global')
+        OR EXISTS (SELECT 1 FROM api_keys WHERE tenant_id <> 'global')
+        OR EXISTS (SELECT 1 FROM jobs WHERE tenant_id <> 'global') THEN
+        RAISE EXCEPTION 'cannot roll back 00009_add_tenants: songs, API keys or jobs belong to tenants other than global'
+            USING HINT = 'Delete those rows or move them to the global tenant, then roll back again.';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_fingerprints_hash_tenant;
+CREATE INDEX IF NOT EXISTS idx_fingerprints_hash ON fingerprints(hash);
+
+DROP INDEX IF EXISTS idx_songs_tenant_content_hash;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_songs_content_hash ON songs(content_hash);
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS search_global;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE jobs DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE fingerprints DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE songs DROP COLUMN IF EXISTS tenant_id;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- SHA-256 of the decoded PCM, so a re-upload of the same audio is caught whatever its tags
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS pcm_hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_songs_tenant_pcm_hash ON songs(tenant_id, pcm_hash);
+
+-- The catalog song a near-duplicate upload matched, when duplicates are flagged rather than rejected
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS duplicate_of TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS duplicate_of TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE jobs DROP COLUMN IF EXISTS duplicate_of;
+ALTER TABLE songs DROP COLUMN IF EXISTS duplicate_of;
+DROP INDEX IF EXISTS idx_songs_tenant_pcm_hash;
+ALTER TABLE songs DROP COLUMN IF EXISTS pcm_hash;
+-- +goose StatementEnd
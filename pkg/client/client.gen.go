@@ -0,0 +1,330 @@
+// Code generated by clientgen from api/openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// BatchResponse is the outcome of a batch upload
+type BatchResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of one file of a batch upload
+type BatchResult struct {
+	Filename string `json:"filename"`
+	Status   string `json:"status"`
+	JobID    string `json:"job_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Error code, as in problem responses
+	Code string `json:"code,omitempty"`
+}
+
+// BatchUploadRequest is a batch of songs to ingest
+type BatchUploadRequest struct {
+	// Audio files, named as in the manifest
+	File []File
+	// A ZIP of audio files, optionally with a manifest.csv or manifest.json
+	Archive *File
+	// CSV or JSON manifest with filename, title, artist, album and year. Filenames are full paths within the batch
+	Manifest *File
+}
+
+func (r BatchUploadRequest) writeForm(f *formWriter) {
+	for _, file := range r.File {
+		f.file("file", file)
+	}
+	if r.Archive != nil {
+		f.file("archive", *r.Archive)
+	}
+	if r.Manifest != nil {
+		f.file("manifest", *r.Manifest)
+	}
+}
+
+// ComponentStatus is the health of one dependency
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// IdentifyRequest is a clip to identify
+type IdentifyRequest struct {
+	// PCM WAV clip
+	File File
+}
+
+func (r IdentifyRequest) writeForm(f *formWriter) {
+	f.file("file", r.File)
+}
+
+// IdentifyResponse is a clip's matches, best first
+type IdentifyResponse struct {
+	Matches []Match `json:"matches"`
+}
+
+// Job is an asynchronous ingest of an uploaded file
+type Job struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+	Year   int    `json:"year"`
+	S3Key  string `json:"s3_key"`
+	// Set once the job succeeds
+	SongID string `json:"song_id,omitempty"`
+	// Set once the job fails
+	Error string `json:"error,omitempty"`
+	// Catalog song the upload duplicates, whether rejected or flagged
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Catalog the song is ingested into
+	TenantID  string    `json:"tenant_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobProgress is a finished pipeline stage of a job
+type JobProgress struct {
+	JobID string `json:"job_id"`
+	Stage string `json:"stage"`
+	// Position of the stage in the pipeline, from 1
+	Step int `json:"step"`
+	// Number of stages in the pipeline
+	Steps   int `json:"steps"`
+	Samples int `json:"samples"`
+	Count   int `json:"count,omitempty"`
+	// Time spent in the stage
+	ElapsedMs int64 `json:"elapsed_ms"`
+	// Time since the job started running
+	TotalMs int64 `json:"total_ms"`
+}
+
+// Liveness is the liveness of the process
+type Liveness struct {
+	Status string `json:"status"`
+}
+
+// Match is a catalog song whose fingerprints line up with the query
+type Match struct {
+	SongID string `json:"song_id"`
+	Song   *Song  `json:"song,omitempty"`
+	// Hashes agreeing on the best time offset
+	Score int `json:"score"`
+	// Score as a fraction of the query hashes
+	Confidence float64 `json:"confidence"`
+	// Where the query starts in the song, in spectrogram frames
+	OffsetFrames int `json:"offset_frames"`
+	// Same as offset_frames, in seconds
+	Offset float64 `json:"offset"`
+}
+
+// Problem is an RFC 7807 problem document
+type Problem struct {
+	// URI identifying the problem type, urn:harmonia:error:<code>
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Seconds to wait, on 429 responses
+	RetryAfter int `json:"retry_after,omitempty"`
+	// The job a rejected upload was recorded as
+	JobID string `json:"job_id,omitempty"`
+}
+
+// Readiness is the readiness of the process and its dependencies
+type Readiness struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Song is a catalog song
+type Song struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+	Year   int    `json:"year"`
+	// Where the ingested audio is stored
+	S3Key       string `json:"s3_key"`
+	Fingerprint []byte `json:"fingerprint"`
+	// SHA-256 of the ingested file
+	ContentHash string `json:"content_hash,omitempty"`
+	// SHA-256 of the decoded audio
+	PcmHash string `json:"pcm_hash,omitempty"`
+	// Song this one was flagged as a near-duplicate of
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Catalog the song belongs to
+	TenantID  string    `json:"tenant_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SongList is a page of catalog songs
+type SongList struct {
+	Songs []Song `json:"songs"`
+}
+
+// StreamMessage is a message on the identify WebSocket
+type StreamMessage struct {
+	Type       string  `json:"type"`
+	Candidates []Match `json:"candidates,omitempty"`
+	Match      *Match  `json:"match,omitempty"`
+	// Why a result was sent
+	Reason       string  `json:"reason,omitempty"`
+	AudioSeconds float64 `json:"audio_seconds"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// UploadAccepted is a queued ingest
+type UploadAccepted struct {
+	Message string `json:"message"`
+	JobID   string `json:"job_id"`
+	Job     Job    `json:"job"`
+}
+
+// UploadRequest is a song to ingest
+type UploadRequest struct {
+	// PCM WAV file
+	File   File
+	Title  string
+	Artist string
+	Album  string
+	Year   int
+}
+
+func (r UploadRequest) writeForm(f *formWriter) {
+	f.file("file", r.File)
+	f.field("title", r.Title, true)
+	f.field("artist", r.Artist, true)
+	f.field("album", r.Album, false)
+	f.field("year", r.Year, true)
+}
+
+// Identify calls POST /api/identify: identify an audio clip
+func (c *Client) Identify(ctx context.Context, body IdentifyRequest) (*IdentifyResponse, error) {
+	path := "/api/identify"
+	req := request{method: http.MethodPost, path: path, decode: []int{200}}
+	req.form = body.writeForm
+	var result IdentifyResponse
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// GetJob calls GET /api/jobs/{id}: get an ingest job
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	path := fmt.Sprintf("/api/jobs/%s", url.PathEscape(id))
+	req := request{method: http.MethodGet, path: path, decode: []int{200}}
+	var result Job
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// ListSongsParams are the query parameters of ListSongs
+type ListSongsParams struct {
+	Limit int
+}
+
+// ListSongs calls GET /api/songs: list catalog songs
+func (c *Client) ListSongs(ctx context.Context, params ListSongsParams) (*SongList, error) {
+	path := "/api/songs"
+	req := request{method: http.MethodGet, path: path, decode: []int{200}}
+	req.query = url.Values{}
+	setQuery(req.query, "limit", params.Limit)
+	var result SongList
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// GetSong calls GET /api/songs/{id}: get a catalog song
+func (c *Client) GetSong(ctx context.Context, id string) (*Song, error) {
+	path := fmt.Sprintf("/api/songs/%s", url.PathEscape(id))
+	req := request{method: http.MethodGet, path: path, decode: []int{200}}
+	var result Song
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// UploadSong calls POST /api/upload: queue a song for ingest
+func (c *Client) UploadSong(ctx context.Context, body UploadRequest) (*UploadAccepted, error) {
+	path := "/api/upload"
+	req := request{method: http.MethodPost, path: path, decode: []int{202}}
+	req.form = body.writeForm
+	var result UploadAccepted
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// UploadBatch calls POST /api/upload/batch: queue several songs for ingest
+func (c *Client) UploadBatch(ctx context.Context, body BatchUploadRequest) (*BatchResponse, error) {
+	path := "/api/upload/batch"
+	req := request{method: http.MethodPost, path: path, decode: []int{202, 207, 422}}
+	req.form = body.writeForm
+	var result BatchResponse
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// GetHealth calls GET /health: liveness probe, same as /livez
+func (c *Client) GetHealth(ctx context.Context) (*Liveness, error) {
+	path := "/health"
+	req := request{method: http.MethodGet, path: path, decode: []int{200}}
+	var result Liveness
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// GetLiveness calls GET /livez: liveness probe
+func (c *Client) GetLiveness(ctx context.Context) (*Liveness, error) {
+	path := "/livez"
+	req := request{method: http.MethodGet, path: path, decode: []int{200}}
+	var result Liveness
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
+
+// GetReadiness calls GET /readyz: readiness probe
+func (c *Client) GetReadiness(ctx context.Context) (*Readiness, error) {
+	path := "/readyz"
+	req := request{method: http.MethodGet, path: path, decode: []int{200, 503}}
+	var result Readiness
+	decoded, err := c.do(ctx, req, &result)
+	if !decoded {
+		return nil, err
+	}
+	return &result, err
+}
@@ -0,0 +1,185 @@
+// Package client is a Go client for the Harmonia HTTP API. The types and
+// methods in client.gen.go are generated from api/openapi.json; this file holds
+// the transport they share.
+//
+//	c := client.New("https://harmonia.example.com", os.Getenv("HARMONIA_API_KEY"))
+//	result, err := c.Identify(ctx, client.IdentifyRequest{File: client.File{Name: "clip.wav", Data: f}})
+//
+// Failed requests return an *Error carrying the server's problem document.
+package client
+
+//go:generate go run ../../internal/clientgen -spec ../../api/openapi.json -out client.gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// problemContentType is the media type of the server's error bodies
+const problemContentType = "application/problem+json"
+
+type Client struct {
+	BaseURL    string
+	APIKey     string // Sent as a bearer token when set
+	HTTPClient *http.Client
+}
+
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// File is an uploaded file part
+type File struct {
+	Name string
+	Data io.Reader
+}
+
+// Error is a response with a 4xx or 5xx status. Problem is nil when the server
+// didn't answer with a problem document, such as a proxy error page.
+type Error struct {
+	StatusCode int
+	Problem    *Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem == nil {
+		return fmt.Sprintf("harmonia: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Problem.Detail == "" {
+		return fmt.Sprintf("harmonia: %d %s (%s)", e.StatusCode, e.Problem.Title, e.Problem.Code)
+	}
+	return fmt.Sprintf("harmonia: %d %s: %s", e.StatusCode, e.Problem.Code, e.Problem.Detail)
+}
+
+// request describes a call made by a generated method
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	form   func(*formWriter) // Multipart body
+	json   any               // JSON body
+	decode []int             // Statuses whose body is the operation's result
+}
+
+// do sends req and decodes the body into out when the status is one of
+// req.decode. A 4xx or 5xx status is returned as an *Error even then, as when a
+// batch is rejected with its per-file results.
+func (c *Client) do(ctx context.Context, req request, out any) (bool, error) {
+	target := c.BaseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	var body io.Reader
+	var contentType string
+	switch {
+	case req.form != nil:
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
+		contentType = writer.FormDataContentType()
+		go func() {
+			f := &formWriter{writer: writer}
+			req.form(f)
+			if f.err == nil {
+				f.err = writer.Close()
+			}
+			pw.CloseWithError(f.err)
+		}()
+		body = pr
+	case req.json != nil:
+		data, err := json.Marshal(req.json)
+		if err != nil {
+			return false, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, body)
+	if err != nil {
+		return false, err
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	decoded := false
+	if slices.Contains(req.decode, resp.StatusCode) {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return false, fmt.Errorf("failed to decode %d response: %w", resp.StatusCode, err)
+		}
+		decoded = true
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == problemContentType {
+			var problem Problem
+			if json.NewDecoder(resp.Body).Decode(&problem) == nil {
+				apiErr.Problem = &problem
+			}
+		}
+		return decoded, apiErr
+	}
+	if !decoded {
+		return false, fmt.Errorf("harmonia: unexpected status %d", resp.StatusCode)
+	}
+	return true, nil
+}
+
+// formWriter writes the parts of a multipart body, keeping the first error
+type formWriter struct {
+	writer *multipart.Writer
+	err    error
+}
+
+func (f *formWriter) file(name string, file File) {
+	if f.err != nil {
+		return
+	}
+	part, err := f.writer.CreateFormFile(name, file.Name)
+	if err == nil {
+		_, err = io.Copy(part, file.Data)
+	}
+	f.err = err
+}
+
+// field writes value, skipping a zero value unless the field is required
+func (f *formWriter) field(name string, value any, required bool) {
+	if f.err != nil || (!required && reflect.ValueOf(value).IsZero()) {
+		return
+	}
+	f.err = f.writer.WriteField(name, fmt.Sprint(value))
+}
+
+// setQuery adds value to query unless it's the zero value, so unset parameters
+// take the server's defaults
+func setQuery(query url.Values, name string, value any) {
+	if reflect.ValueOf(value).IsZero() {
+		return
+	}
+	query.Set(name, fmt.Sprint(value))
+}
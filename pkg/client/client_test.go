@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "hmn_test")
+}
+
+func TestClient_UploadSong(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/upload", r.URL.Path)
+		assert.Equal(t, "Bearer hmn_test", r.Header.Get("Authorization"))
+
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "song.wav", header.Filename)
+		assert.Equal(t, "RIFF", string(data))
+		assert.Equal(t, "Song", r.PostFormValue("title"))
+		assert.Equal(t, "1999", r.PostFormValue("year"))
+		assert.NotContains(t, r.PostForm, "album", "optional fields are left out when empty")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"message":"accepted","job_id":"job-1","job":{"id":"job-1","status":"queued"}}`)
+	})
+
+	accepted, err := c.UploadSong(ctx, UploadRequest{
+		File:   File{Name: "song.wav", Data: strings.NewReader("RIFF")},
+		Title:  "Song",
+		Artist: "Artist",
+		Year:   1999,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", accepted.JobID)
+	assert.Equal(t, "queued", accepted.Job.Status)
+}
+
+func TestClient_ListSongs(t *testing.T) {
+	var queries []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		io.WriteString(w, `{"songs":[{"id":"1","title":"Song"}]}`)
+	})
+
+	list, err := c.ListSongs(ctx, ListSongsParams{Limit: 5})
+	require.NoError(t, err)
+	require.Len(t, list.Songs, 1)
+	assert.Equal(t, "Song", list.Songs[0].Title)
+
+	_, err = c.ListSongs(ctx, ListSongsParams{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"limit=5", ""}, queries, "unset parameters take the server's defaults")
+}
+
+func TestClient_Errors(t *testing.T) {
+	t.Run("decodes problems", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/songs/a%2Fb", r.URL.EscapedPath())
+			w.Header().Set("Content-Type", problemContentType)
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"type":"urn:harmonia:error:not_found","title":"Not Found","status":404,"code":"not_found","detail":"song a/b not found"}`)
+		})
+
+		song, err := c.GetSong(ctx, "a/b")
+		assert.Nil(t, song)
+		var apiErr *Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		require.NotNil(t, apiErr.Problem)
+		assert.Equal(t, "not_found", apiErr.Problem.Code)
+		assert.Equal(t, "harmonia: 404 not_found: song a/b not found", err.Error())
+	})
+
+	t.Run("keeps results sent with an error status", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			io.WriteString(w, `{"accepted":0,"rejected":1,"results":[{"filename":"a.wav","status":"rejected","code":"unsupported_format"}]}`)
+		})
+
+		batch, err := c.UploadBatch(ctx, BatchUploadRequest{File: []File{{Name: "a.wav", Data: strings.NewReader("x")}}})
+		var apiErr *Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+		require.NotNil(t, batch)
+		assert.Equal(t, "unsupported_format", batch.Results[0].Code)
+	})
+
+	t.Run("handles bodies that aren't problems", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		})
+
+		_, err := c.GetJob(ctx, "job-1")
+		var apiErr *Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Nil(t, apiErr.Problem)
+		assert.Equal(t, "harmonia: 502 Bad Gateway", err.Error())
+	})
+}
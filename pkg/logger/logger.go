@@ -1,15 +1,41 @@
 package logger
 
 import (
+	"context"
+	"io"
 	"os"
 
 	"github.com/rs/zerolog"
 )
 
+// fallback logs work that carries no logger in its context, such as the command line tools
+var fallback = zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+type contextKey struct{}
+
 func NewLogger(env string) zerolog.Logger {
-	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	var out io.Writer = os.Stderr
 	if env == "dev" {
-		logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		out = zerolog.ConsoleWriter{Out: os.Stderr}
+	}
+	return zerolog.New(out).With().Timestamp().Logger()
+}
+
+// WithContext returns ctx carrying log, so services and repos log with the fields
+// of the request or job they run for
+func WithContext(ctx context.Context, log zerolog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, log)
+}
+
+// FromContext returns the logger carried by ctx, or a plain stderr logger
+func FromContext(ctx context.Context) *zerolog.Logger {
+	return FromContextOr(ctx, fallback)
+}
+
+// FromContextOr returns the logger carried by ctx, or def when it carries none
+func FromContextOr(ctx context.Context, def zerolog.Logger) *zerolog.Logger {
+	if log, ok := ctx.Value(contextKey{}).(zerolog.Logger); ok {
+		return &log
 	}
-	return logger
+	return &def
 }
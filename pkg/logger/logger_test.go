@@ -0,0 +1,23 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	var out, def bytes.Buffer
+	ctx := WithContext(context.Background(), zerolog.New(&out))
+
+	FromContext(ctx).Info().Msg("carried")
+	FromContextOr(ctx, zerolog.New(&def)).Info().Msg("carried")
+	FromContextOr(context.Background(), zerolog.New(&def)).Info().Msg("default")
+
+	assert.Equal(t, 2, bytes.Count(out.Bytes(), []byte("carried")))
+	assert.Contains(t, def.String(), "default")
+	assert.NotContains(t, def.String(), "carried")
+}